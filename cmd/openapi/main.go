@@ -0,0 +1,175 @@
+// openapi 导出服务的 openapi 文档，并比较两份文档之间的兼容性差异
+//
+//	go run github.com/ihezebin/olympus/cmd/openapi export -pkg ./cmd/server -format yaml -o openapi.yaml
+//	go run github.com/ihezebin/olympus/cmd/openapi diff -fail-on-breaking base.yaml openapi.yaml
+//
+// export 编译服务的 main 包后通过 OLYMPUS_OPENAPI_EXPORT 环境变量运行，
+// httpserver 在 Run 时只导出文档并返回 httpserver.ErrOpenAPIExported，不会监听端口；
+// 文档导出后服务的其他任务可能仍在运行，export 会结束该进程。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/httpserver"
+	"github.com/ihezebin/olympus/httpserver/apidiff"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "diff":
+		err = diff(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  openapi export -pkg <main package> [-format json|yaml] [-o file]
+  openapi diff [-json] [-fail-on-breaking] <base spec> <revision spec>`)
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	pkg := fs.String("pkg", ".", "main package of the service")
+	format := fs.String("format", string(httpserver.OpenAPIFormatJSON), "output format: json or yaml")
+	output := fs.String("o", "", "output file, default stdout")
+	_ = fs.Parse(args)
+
+	// 服务本身可能向标准输出打印日志，所以先导出到临时文件
+	dir, err := os.MkdirTemp("", "openapi-export-*")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir err")
+	}
+	defer os.RemoveAll(dir)
+	tmpPath := filepath.Join(dir, "openapi."+*format)
+	binPath := filepath.Join(dir, "server")
+
+	build := exec.Command("go", "build", "-o", binPath, *pkg)
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	if err = build.Run(); err != nil {
+		return errors.Wrapf(err, "build package %s err", *pkg)
+	}
+
+	cmd := exec.Command(binPath, fs.Args()...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", httpserver.OpenAPIExportEnv, *format),
+		fmt.Sprintf("%s=%s", httpserver.OpenAPIExportOutputEnv, tmpPath),
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		return errors.Wrapf(err, "run package %s err", *pkg)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	if err = waitExported(tmpPath, exited, cmd.Process); err != nil {
+		return errors.Wrapf(err, "run package %s err", *pkg)
+	}
+
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "read exported spec err")
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(*output), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "make dir of %s err", *output)
+	}
+	return os.WriteFile(*output, data, 0o644)
+}
+
+// waitExported 等待文档写入或进程退出，文档通过重命名写入，出现时内容已经完整，
+// 导出后结束进程，避免服务的其他任务一直运行
+func waitExported(path string, exited <-chan error, process *os.Process) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			// main 可能将 ErrOpenAPIExported 当作错误退出，文档存在时忽略退出码
+			if _, statErr := os.Stat(path); statErr == nil {
+				return nil
+			}
+			if err == nil {
+				err = errors.New("exited without exporting, make sure it calls Run of httpserver")
+			}
+			return err
+		case <-ticker.C:
+			if _, err := os.Stat(path); err == nil {
+				_ = process.Kill()
+				<-exited
+				return nil
+			}
+		}
+	}
+}
+
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as json")
+	failOnBreaking := fs.Bool("fail-on-breaking", false, "exit with code 1 when breaking changes are found")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	base, err := apidiff.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	revision, err := apidiff.Load(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	report := apidiff.Diff(base, revision)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(report); err != nil {
+			return errors.Wrap(err, "encode report err")
+		}
+	} else {
+		for _, change := range report.Changes {
+			fmt.Println(change.String())
+		}
+		fmt.Printf("%d changes, %d breaking\n", len(report.Changes), len(report.Breaking()))
+	}
+
+	if *failOnBreaking && report.HasBreaking() {
+		return errors.New("breaking changes found")
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// replay 将 middleware.Recorder 录制的请求回放到本地服务，并比较响应与录制时的差异
+//
+//	go run github.com/ihezebin/olympus/cmd/replay -target http://localhost:8080 -H "Authorization: Bearer xxx" -ignore ..request_id records.jsonl
+//
+// 录制时脱敏的 header 不会回放，需要通过 -H 重新指定；有差异或请求失败时以 1 退出。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/httpserver/middleware"
+	"github.com/ihezebin/olympus/httpserver/replay"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	target := fs.String("target", "http://localhost:8080", "base url of the local server")
+	route := fs.String("route", "", "only replay records of the route, e.g. /users/:id")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each request")
+	asJSON := fs.Bool("json", false, "print the report as json")
+	opts := []replay.Option{}
+	fs.Func("H", "header of replayed requests, e.g. \"Authorization: Bearer xxx\", can be repeated", func(value string) error {
+		key, val, ok := strings.Cut(value, ":")
+		if !ok {
+			return errors.Errorf("invalid header %q", value)
+		}
+		opts = append(opts, replay.WithHeader(strings.TrimSpace(key), strings.TrimSpace(val)))
+		return nil
+	})
+	fs.Func("ignore", "json path not compared, e.g. data.updated_at or ..request_id, can be repeated", func(value string) error {
+		opts = append(opts, replay.WithIgnoreJSONPaths(value))
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: replay [-target url] [-route route] [-H header] [-ignore path] [-json] <records>...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	entries := make([]middleware.HAREntry, 0)
+	for _, path := range fs.Args() {
+		loaded, err := replay.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range loaded {
+			if *route == "" || entry.Route == *route {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	opts = append(opts, replay.WithClient(&http.Client{Timeout: *timeout}))
+	report, err := replay.Replay(context.Background(), *target, entries, opts...)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(report); err != nil {
+			return errors.Wrap(err, "encode report err")
+		}
+	} else {
+		for _, result := range report.Results {
+			fmt.Println(result.String())
+		}
+		fmt.Printf("%d replayed, %d failed\n", len(report.Results), len(report.Failed()))
+	}
+
+	if len(report.Failed()) > 0 {
+		return errors.New("responses differ from records")
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/ihezebin/olympus/httpserver"
+)
+
+// GatewayRegister 将 grpc-gateway 生成的 handler 注册到 mux，conn 连接当前的 grpc 服务
+type GatewayRegister func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// initGateway conn 延迟建立连接，服务 Run 之后才可用
+func (s *server) initGateway(ctx context.Context) error {
+	target := fmt.Sprintf("passthrough:///127.0.0.1:%d", s.options.Port)
+	if s.options.Listener != nil {
+		target = "passthrough:///" + s.options.Listener.Addr().String()
+	}
+	dialOptions := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(OtelUnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(OtelStreamClientInterceptor()),
+	}, s.options.GatewayDialOptions...)
+	conn, err := grpc.NewClient(target, dialOptions...)
+	if err != nil {
+		return errors.Wrap(err, "new gateway client conn err")
+	}
+	s.shutdowns = append(s.shutdowns, func(context.Context) error {
+		return conn.Close()
+	})
+
+	s.gateway = runtime.NewServeMux(s.options.GatewayMuxOptions...)
+	for _, register := range s.options.GatewayRegisters {
+		if err = register(ctx, s.gateway, conn); err != nil {
+			return errors.Wrap(err, "register gateway handler err")
+		}
+	}
+	return nil
+}
+
+// GatewayMux grpc-gateway 的 ServeMux，没有通过 WithGateway 注册 handler 时为 nil
+func (s *server) GatewayMux() *runtime.ServeMux {
+	return s.gateway
+}
+
+// Gateway 将 gateway 挂载到 httpserver 的 prefix 下，gateway 收到的是完整的请求路径，prefix 需要与 proto 中 http 规则的前缀一致，
+// 请求经过 httpserver 的中间件，trace context 会通过 metadata 传递给 grpc 服务
+//
+//	httpServer.RegisterRoutes(grpcServer.Gateway("/v1"))
+func (s *server) Gateway(prefix string) httpserver.RegisterRoutes {
+	return &gatewayRoutes{prefix: "/" + strings.Trim(prefix, "/"), mux: s.gateway}
+}
+
+type gatewayRoutes struct {
+	prefix string
+	mux    *runtime.ServeMux
+}
+
+func (g *gatewayRoutes) RegisterRoutes(router httpserver.Router) {
+	if g.mux == nil {
+		return
+	}
+	handler := gin.WrapH(g.mux)
+	router.Kernel().Any(strings.TrimRight(g.prefix, "/")+"/*path", handler)
+}
@@ -0,0 +1,279 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/ihezebin/olympus/httpserver"
+	"github.com/ihezebin/olympus/logger"
+)
+
+const instrumentationName = "github.com/ihezebin/olympus/grpcserver"
+
+// metadataCarrier 在 grpc metadata 中传递 trace context
+type metadataCarrier metadata.MD
+
+var _ propagation.TextMapCarrier = metadataCarrier{}
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// serverStream 替换 stream 的 context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// OtelUnaryServerInterceptor 从 metadata 中提取 trace context，每个请求一个 server span
+func OtelUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		defer span.End()
+
+		resp, err = handler(ctx, req)
+		endServerSpan(span, err)
+		return resp, err
+	}
+}
+
+func OtelStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(stream.Context(), info.FullMethod)
+		defer span.End()
+
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		endServerSpan(span, err)
+		return err
+	}
+}
+
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	service, method := splitFullMethod(fullMethod)
+	return otel.Tracer(instrumentationName).Start(ctx, strings.TrimPrefix(fullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", method),
+		),
+	)
+}
+
+func endServerSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if err != nil && isServerError(code) {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+}
+
+// OtelUnaryClientInterceptor 向 metadata 注入 trace context，gateway 连接 grpc 服务时使用
+func OtelUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(injectOutgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func OtelStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(injectOutgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+func injectOutgoing(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// MetricsUnaryServerInterceptor 记录请求数与耗时，维度为方法与状态码
+func MetricsUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	metrics := newServerMetrics()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		metrics.record(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func MetricsStreamServerInterceptor() grpc.StreamServerInterceptor {
+	metrics := newServerMetrics()
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		metrics.record(stream.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+type serverMetrics struct {
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	meter := otel.Meter(instrumentationName)
+	requests, err := meter.Int64Counter("rpc.server.requests", metric.WithDescription("grpc 请求数"))
+	if err != nil {
+		logger.WithError(err).Error(context.Background(), "new grpc requests counter err")
+	}
+	duration, err := meter.Float64Histogram("rpc.server.duration", metric.WithDescription("grpc 请求耗时"), metric.WithUnit("ms"))
+	if err != nil {
+		logger.WithError(err).Error(context.Background(), "new grpc duration histogram err")
+	}
+	return &serverMetrics{requests: requests, duration: duration}
+}
+
+func (m *serverMetrics) record(ctx context.Context, fullMethod string, start time.Time, err error) {
+	service, method := splitFullMethod(fullMethod)
+	attrs := metric.WithAttributes(
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+		attribute.String("rpc.grpc.status_code", status.Code(err).String()),
+	)
+	if m.requests != nil {
+		m.requests.Add(ctx, 1, attrs)
+	}
+	if m.duration != nil {
+		m.duration.Record(ctx, float64(time.Since(start).Microseconds())/1000, attrs)
+	}
+}
+
+// LoggingUnaryServerInterceptor 每个请求一行日志，包含方法、状态码与耗时，trace_id 由 logger 从 context 获取
+func LoggingUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRequest(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func LoggingStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		logRequest(stream.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logRequest(ctx context.Context, fullMethod string, start time.Time, err error) {
+	// 健康检查请求频繁，不记录
+	if strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") {
+		return
+	}
+	code := status.Code(err)
+	fields := map[string]interface{}{
+		"method":  fullMethod,
+		"code":    code.String(),
+		"latency": time.Since(start).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["remote"] = p.Addr.String()
+	}
+
+	log := logger.WithFields(fields)
+	if err != nil {
+		log = log.WithError(err)
+	}
+	if isServerError(code) {
+		log.Error(ctx, "grpc request")
+		return
+	}
+	log.Info(ctx, "grpc request")
+}
+
+// RecoveryUnaryServerInterceptor handler panic 时记录堆栈并返回 codes.Internal
+func RecoveryUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(ctx, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func RecoveryStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(stream.Context(), r)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+func recoverPanic(ctx context.Context, r any) error {
+	stack := httpserver.PanicStack()
+	logger.WithFields(map[string]interface{}{
+		"panic": fmt.Sprintf("%v", r),
+		"stack": stack,
+	}).Errorf(ctx, "panic recovered: %v", r)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("exception.stacktrace", strings.Join(stack, "\n")))
+	return status.Error(codes.Internal, "Internal Server Error")
+}
+
+func splitFullMethod(fullMethod string) (service string, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "", fullMethod
+}
+
+// isServerError 与 http 5xx 对应的状态码
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/runner"
+)
+
+type server struct {
+	*grpc.Server
+	options   *ServerOptions
+	health    *health.Server
+	gateway   *runtime.ServeMux
+	shutdowns []ShutdownFunc
+}
+
+type ShutdownFunc func(context.Context) error
+
+var _ runner.Task = &server{}
+
+// NewServer 创建 grpc 服务，内置 otel、metrics、logging、recovery 拦截器，通过 RegisterService 注册服务后交给 runner 运行
+func NewServer(ctx context.Context, opts ...ServerOption) (*server, error) {
+	options := mergeServerOptions(opts...)
+	if options.ServiceName == "" {
+		options.ServiceName = "olympus grpcserver"
+	}
+
+	shutdowns := make([]ShutdownFunc, 0)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if options.TraceExporter != nil {
+		tp := trace.NewTracerProvider(
+			trace.WithBatcher(options.TraceExporter),
+			trace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(options.ServiceName))),
+		)
+		otel.SetTracerProvider(tp)
+		shutdowns = append(shutdowns, tp.Shutdown)
+	}
+
+	// otel 在最外层，recovery 在最内层，panic 转换后的状态码也会记录到 span、metrics 与日志
+	unary := []grpc.UnaryServerInterceptor{OtelUnaryServerInterceptor()}
+	stream := []grpc.StreamServerInterceptor{OtelStreamServerInterceptor()}
+	if options.Metrics {
+		unary = append(unary, MetricsUnaryServerInterceptor())
+		stream = append(stream, MetricsStreamServerInterceptor())
+	}
+	unary = append(unary, LoggingUnaryServerInterceptor(), RecoveryUnaryServerInterceptor())
+	stream = append(stream, LoggingStreamServerInterceptor(), RecoveryStreamServerInterceptor())
+	unary = append(unary, options.UnaryInterceptors...)
+	stream = append(stream, options.StreamInterceptors...)
+
+	grpcOptions := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, options.GRPCOptions...)
+	kernel := grpc.NewServer(grpcOptions...)
+
+	s := &server{
+		Server:    kernel,
+		options:   options,
+		shutdowns: shutdowns,
+	}
+
+	if options.Health {
+		s.health = health.NewServer()
+		// Run 之前为 NOT_SERVING
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		healthpb.RegisterHealthServer(kernel, s.health)
+	}
+	if options.Reflection {
+		reflection.Register(kernel)
+	}
+
+	if len(options.GatewayRegisters) > 0 {
+		if err := s.initGateway(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *server) Name() string {
+	return fmt.Sprintf("grpcserver[%s]", s.options.ServiceName)
+}
+
+// Health 设置各个服务的健康状态，service 为空表示整个服务
+func (s *server) Health() *health.Server {
+	return s.health
+}
+
+func (s *server) Run(ctx context.Context) error {
+	listener := s.options.Listener
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", fmt.Sprintf(":%d", s.options.Port))
+		if err != nil {
+			return errors.Wrapf(err, "listen port %d err", s.options.Port)
+		}
+	}
+
+	if s.health != nil {
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		for name := range s.GetServiceInfo() {
+			s.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+
+	logger.Infof(ctx, "grpc server is starting in %s", listener.Addr())
+	if err := s.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		logger.WithError(err).Error(ctx, "grpc server Serve err")
+		return err
+	}
+	logger.Info(ctx, "grpc server closed")
+	return nil
+}
+
+// Close 先标记为 NOT_SERVING，再等待请求处理完成，超过 ShutdownTimeout 或 ctx 的截止时间时强制关闭；
+// runner 调用 Close 时 ctx 已经取消，因此只沿用 ctx 的值与未过期的截止时间
+func (s *server) Close(ctx context.Context) error {
+	timeout := s.options.ShutdownTimeout
+	if deadline, ok := ctx.Deadline(); ok && ctx.Err() == nil {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	if s.health != nil {
+		s.health.Shutdown()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+
+	for _, shutdown := range s.shutdowns {
+		if err := shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package grpcserver
+
+import (
+	"net"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+type ServerOptions struct {
+	Port        uint   `json:"port" yaml:"port" toml:"port"`
+	ServiceName string `json:"service_name" yaml:"service_name" toml:"service_name"`
+	// Listener 不为空时不再监听 Port，例如测试中使用 bufconn
+	Listener net.Listener `json:"-" yaml:"-" toml:"-"`
+	// Metrics 通过全局的 MeterProvider 记录请求数与耗时，与 httpserver 一起运行时由其 /metrics 暴露
+	Metrics bool `json:"metrics" yaml:"metrics" toml:"metrics"`
+	// Health 注册 grpc.health.v1.Health 服务，Run 后为 SERVING，Close 时为 NOT_SERVING
+	Health bool `json:"health" yaml:"health" toml:"health"`
+	// Reflection 注册 grpc reflection 服务，方便 grpcurl 等工具调试
+	Reflection bool `json:"reflection" yaml:"reflection" toml:"reflection"`
+	// ShutdownTimeout Close 时等待请求处理完成的最长时间，超过后强制关闭，默认 10s
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// TraceExporter 单独运行时设置全局的 TracerProvider，与 httpserver 一起运行时不需要设置
+	TraceExporter      trace.SpanExporter             `json:"-" yaml:"-" toml:"-"`
+	UnaryInterceptors  []grpc.UnaryServerInterceptor  `json:"-" yaml:"-" toml:"-"`
+	StreamInterceptors []grpc.StreamServerInterceptor `json:"-" yaml:"-" toml:"-"`
+	GRPCOptions        []grpc.ServerOption            `json:"-" yaml:"-" toml:"-"`
+	// GatewayRegisters 不为空时创建 grpc-gateway 的 ServeMux，通过 Gateway 挂载到 httpserver
+	GatewayRegisters   []GatewayRegister        `json:"-" yaml:"-" toml:"-"`
+	GatewayMuxOptions  []runtime.ServeMuxOption `json:"-" yaml:"-" toml:"-"`
+	GatewayDialOptions []grpc.DialOption        `json:"-" yaml:"-" toml:"-"`
+}
+
+type ServerOption func(*ServerOptions)
+
+func mergeServerOptions(opts ...ServerOption) *ServerOptions {
+	opt := &ServerOptions{
+		Port:            9090,
+		Metrics:         true,
+		Health:          true,
+		ShutdownTimeout: 10 * time.Second,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithPort(port uint) ServerOption {
+	return func(o *ServerOptions) {
+		o.Port = port
+	}
+}
+
+func WithServiceName(name string) ServerOption {
+	return func(o *ServerOptions) {
+		o.ServiceName = name
+	}
+}
+
+func WithListener(listener net.Listener) ServerOption {
+	return func(o *ServerOptions) {
+		o.Listener = listener
+	}
+}
+
+func WithMetrics(enable bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.Metrics = enable
+	}
+}
+
+func WithHealth(enable bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.Health = enable
+	}
+}
+
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.ShutdownTimeout = timeout
+	}
+}
+
+func WithReflection() ServerOption {
+	return func(o *ServerOptions) {
+		o.Reflection = true
+	}
+}
+
+// WithTraceExporter 设置 trace exporter，与 httpserver.WithTraceExporter 相同
+func WithTraceExporter(exporter trace.SpanExporter) ServerOption {
+	return func(o *ServerOptions) {
+		o.TraceExporter = exporter
+	}
+}
+
+// WithUnaryInterceptors 追加在内置的 otel、metrics、logging、recovery 拦截器之后
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) ServerOption {
+	return func(o *ServerOptions) {
+		o.UnaryInterceptors = append(o.UnaryInterceptors, interceptors...)
+	}
+}
+
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) ServerOption {
+	return func(o *ServerOptions) {
+		o.StreamInterceptors = append(o.StreamInterceptors, interceptors...)
+	}
+}
+
+func WithGRPCOptions(opts ...grpc.ServerOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.GRPCOptions = append(o.GRPCOptions, opts...)
+	}
+}
+
+// WithGateway 注册 grpc-gateway 生成的 handler，例如
+//
+//	WithGateway(func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+//		return pb.RegisterUserServiceHandler(ctx, mux, conn)
+//	})
+func WithGateway(registers ...GatewayRegister) ServerOption {
+	return func(o *ServerOptions) {
+		o.GatewayRegisters = append(o.GatewayRegisters, registers...)
+	}
+}
+
+func WithGatewayMuxOptions(opts ...runtime.ServeMuxOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.GatewayMuxOptions = append(o.GatewayMuxOptions, opts...)
+	}
+}
+
+// WithGatewayDialOptions gateway 连接 grpc 服务的选项，默认不使用 TLS
+func WithGatewayDialOptions(opts ...grpc.DialOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.GatewayDialOptions = append(o.GatewayDialOptions, opts...)
+	}
+}
@@ -0,0 +1,199 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/ihezebin/olympus/httpserver"
+	"github.com/ihezebin/olympus/logger"
+)
+
+var ctx = context.Background()
+
+// pingServer 手写的 ServiceDesc，避免测试依赖 protoc 生成的代码
+type pingServer struct {
+	traceIDs chan trace.TraceID
+}
+
+var pingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Ping",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Ping", Handler: pingHandler("Ping", func(s *pingServer, ctx context.Context) error {
+			s.traceIDs <- trace.SpanContextFromContext(ctx).TraceID()
+			return nil
+		})},
+		{MethodName: "Panic", Handler: pingHandler("Panic", func(s *pingServer, ctx context.Context) error {
+			panic("ping panic")
+		})},
+	},
+}
+
+func pingHandler(method string, fn func(s *pingServer, ctx context.Context) error) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := &emptypb.Empty{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			return &emptypb.Empty{}, fn(srv.(*pingServer), ctx)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Ping/" + method}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+func TestServer(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	})
+	exporter := tracetest.NewInMemoryExporter()
+
+	ping := &pingServer{traceIDs: make(chan trace.TraceID, 1)}
+	server, err := NewServer(ctx,
+		WithServiceName("test_grpc"),
+		WithListener(listener),
+		WithTraceExporter(exporter),
+		WithGatewayDialOptions(dialer),
+		WithGateway(func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+			return mux.HandlePath(http.MethodGet, "/v1/ping", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+				if err := conn.Invoke(r.Context(), "/test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+					runtime.HTTPError(r.Context(), mux, &runtime.JSONPb{}, w, r, err)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.RegisterService(&pingServiceDesc, ping)
+
+	go func() {
+		if err := server.Run(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if err := server.Close(closeCtx); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn", dialer,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(OtelUnaryClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 客户端的 trace context 通过 metadata 传递给服务端
+	traceID := trace.TraceID{1, 2, 3}
+	parent := trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	if err = conn.Invoke(parent, "/test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ping.traceIDs; got != traceID {
+		t.Fatalf("trace id should be propagated: %s", got)
+	}
+
+	output := &bytes.Buffer{}
+	logger.ResetLoggerWithOptions(logger.WithOutput(output))
+	err = conn.Invoke(ctx, "/test.Ping/Panic", &emptypb.Empty{}, &emptypb.Empty{})
+	logger.ResetLoggerWithOptions()
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("panic should be converted to Internal: %v", err)
+	}
+	// 与 httpserver 的 Recovery 一样通过 stack 字段记录从 panic 处开始的调用栈
+	if !strings.Contains(output.String(), `"stack":["github.com/ihezebin/olympus/grpcserver.`) {
+		t.Fatalf("panic stack should be logged: %s", output.String())
+	}
+
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "test.Ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("unexpected health status: %s", health.GetStatus())
+	}
+
+	// gateway 挂载到 httpserver，请求经过 httpserver 的 span 后转发给 grpc 服务
+	httpServer, err := httpserver.NewServer(ctx, httpserver.WithServiceName("test_gateway"), httpserver.WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer.RegisterRoutes(server.Gateway("/v1"))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/ping", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	w := httptest.NewRecorder()
+	httpServer.Engine().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected gateway status: %d %s", w.Code, w.Body.String())
+	}
+	if got := <-ping.traceIDs; got.String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Fatalf("trace id should be propagated through gateway: %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	httpServer.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown gateway path should be 404: %d", w.Code)
+	}
+}
+
+func TestClose(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithListener(bufconn.Listen(1024*1024)), WithShutdownTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shutdownErr error
+	server.shutdowns = append(server.shutdowns, func(ctx context.Context) error {
+		shutdownErr = ctx.Err()
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	// runner 先取消 ctx 再调用 Close，shutdown 仍然需要可用的 ctx
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = server.Close(cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if shutdownErr != nil {
+		t.Fatalf("shutdown should not get a cancelled ctx: %v", shutdownErr)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -33,6 +33,9 @@ func NewClient(opts ...Option) *resty.Client {
 	if options.Otel {
 		c.OnBeforeRequest(OtelMiddleware())
 	}
+	if options.RequestId {
+		c.OnBeforeRequest(RequestIdMiddleware())
+	}
 
 	if options.Debug {
 		c.SetDebug(true)
@@ -4,6 +4,8 @@ import (
 	"github.com/go-resty/resty/v2"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/ihezebin/olympus/requestid"
 )
 
 func OtelMiddleware() resty.RequestMiddleware {
@@ -17,3 +19,14 @@ func OtelMiddleware() resty.RequestMiddleware {
 		return nil
 	}
 }
+
+// RequestIdMiddleware 将 context 中的请求 ID 通过 X-Request-Id 传递给下游，请求已设置时不覆盖
+func RequestIdMiddleware() resty.RequestMiddleware {
+	return func(client *resty.Client, request *resty.Request) error {
+		id := requestid.FromContext(request.Context())
+		if id != "" && request.Header.Get(requestid.Header) == "" {
+			request.Header.Set(requestid.Header, id)
+		}
+		return nil
+	}
+}
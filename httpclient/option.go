@@ -3,20 +3,22 @@ package httpclient
 import "time"
 
 type Options struct {
-	Otel    bool
-	Host    string
-	Timeout time.Duration
-	Debug   bool
+	Otel      bool
+	RequestId bool
+	Host      string
+	Timeout   time.Duration
+	Debug     bool
 }
 
 type Option func(*Options)
 
 func mergeOptions(opts ...Option) *Options {
 	options := &Options{
-		Otel:    true,
-		Host:    "",
-		Timeout: 10 * time.Second,
-		Debug:   false,
+		Otel:      true,
+		RequestId: true,
+		Host:      "",
+		Timeout:   10 * time.Second,
+		Debug:     false,
 	}
 	for _, opt := range opts {
 		opt(options)
@@ -30,6 +32,13 @@ func WithOtel(enabled bool) Option {
 	}
 }
 
+// WithRequestId 是否传递 context 中的请求 ID，默认开启
+func WithRequestId(enabled bool) Option {
+	return func(o *Options) {
+		o.RequestId = enabled
+	}
+}
+
 func WithHost(host string) Option {
 	return func(o *Options) {
 		o.Host = host
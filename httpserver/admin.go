@@ -0,0 +1,431 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/config"
+	"github.com/ihezebin/olympus/httpserver/middleware"
+	"github.com/ihezebin/olympus/logger"
+)
+
+// DefaultAdminRedactKeys 配置中 key 包含这些字符串（不区分大小写）时隐藏值
+var DefaultAdminRedactKeys = []string{"password", "passwd", "secret", "token", "key", "dsn", "credential", "private"}
+
+const adminRedacted = "******"
+
+type AdminOptions struct {
+	// Prefix 管理接口的路由前缀，默认 /admin
+	Prefix string
+	// Port 大于 0 时管理接口在独立的端口上提供，不经过业务的中间件，否则注册在服务的路由上
+	Port uint
+	// Host 独立端口监听的地址，默认 127.0.0.1 只允许本机访问，监听其他地址时必须通过 Token 或 Middlewares 保护
+	Host string
+	// Token 不为空时请求需要携带 Authorization: Bearer {Token}
+	Token string
+	// Middlewares 管理接口的中间件，例如 allowIPs、basic auth 等访问限制
+	Middlewares []gin.HandlerFunc
+	// Config 通过 /config 展示的配置，为 *config.Config 时展示所有的配置项
+	Config any
+	// RedactKeys 需要隐藏值的配置 key，默认 DefaultAdminRedactKeys
+	RedactKeys []string
+	// Recorder 不为空时通过 {prefix}/recorder/routes 运行时开关路由的录制
+	Recorder *middleware.Recorder
+}
+
+type AdminOption func(*AdminOptions)
+
+func mergeAdminOptions(opts ...AdminOption) *AdminOptions {
+	opt := &AdminOptions{
+		Prefix:     "/admin",
+		Host:       "127.0.0.1",
+		RedactKeys: DefaultAdminRedactKeys,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithAdminPrefix(prefix string) AdminOption {
+	return func(o *AdminOptions) {
+		o.Prefix = prefix
+	}
+}
+
+// WithAdminPort 管理接口在独立的端口上提供，避免暴露到公网
+func WithAdminPort(port uint) AdminOption {
+	return func(o *AdminOptions) {
+		o.Port = port
+	}
+}
+
+// WithAdminHost 独立端口监听的地址，例如 0.0.0.0 或内网 IP，需要同时通过 WithAdminToken 或 WithAdminMiddlewares 保护
+func WithAdminHost(host string) AdminOption {
+	return func(o *AdminOptions) {
+		o.Host = host
+	}
+}
+
+// WithAdminToken 请求需要携带 Authorization: Bearer {token}，否则返回 401
+func WithAdminToken(token string) AdminOption {
+	return func(o *AdminOptions) {
+		o.Token = token
+	}
+}
+
+func WithAdminMiddlewares(middlewares ...gin.HandlerFunc) AdminOption {
+	return func(o *AdminOptions) {
+		o.Middlewares = append(o.Middlewares, middlewares...)
+	}
+}
+
+// WithAdminConfig 通过 /config 展示的配置，可以是 *config.Config 或 Load 后的结构体
+func WithAdminConfig(cfg any) AdminOption {
+	return func(o *AdminOptions) {
+		o.Config = cfg
+	}
+}
+
+// WithAdminRedactKeys 追加需要隐藏值的配置 key
+func WithAdminRedactKeys(keys ...string) AdminOption {
+	return func(o *AdminOptions) {
+		o.RedactKeys = append(append([]string{}, o.RedactKeys...), keys...)
+	}
+}
+
+// WithAdminRecorder 通过管理接口修改路由的录制采样比例
+func WithAdminRecorder(recorder *middleware.Recorder) AdminOption {
+	return func(o *AdminOptions) {
+		o.Recorder = recorder
+	}
+}
+
+// AdminLogLevel GET、PUT {prefix}/log/level 响应的数据，RevertAt 为 ttl 到期恢复级别的时间
+type AdminLogLevel struct {
+	Level    logger.Level `json:"level"`
+	RevertAt *time.Time   `json:"revert_at,omitempty"`
+}
+
+// AdminRoute GET {prefix}/routes 响应的数据，Middlewares 为路由处理函数之前按顺序执行的中间件
+type AdminRoute struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+}
+
+type AdminModule struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// AdminBuildInfo GET {prefix}/build 响应的数据，来自 debug.ReadBuildInfo
+type AdminBuildInfo struct {
+	ServiceName string            `json:"service_name"`
+	GoVersion   string            `json:"go_version"`
+	Path        string            `json:"path"`
+	Main        AdminModule       `json:"main"`
+	Settings    map[string]string `json:"settings"`
+	Deps        []AdminModule     `json:"deps"`
+	StartedAt   time.Time         `json:"started_at"`
+	Uptime      string            `json:"uptime"`
+}
+
+// registerAdmin 注册管理接口，Port 大于 0 时创建独立的 http.Server，由 Run 启动；
+// 注册在服务的路由上或独立端口监听非本机地址时必须通过 WithAdminToken 或 WithAdminMiddlewares 保护
+func (s *server) registerAdmin() error {
+	options := mergeAdminOptions(s.options.AdminOptions...)
+	protected := options.Token != "" || len(options.Middlewares) > 0
+	if options.Port == 0 && !protected {
+		return errors.Errorf("admin routes %s are not protected, use WithAdminToken, WithAdminMiddlewares or WithAdminPort", options.Prefix)
+	}
+	if options.Port > 0 && !protected && !loopbackHost(options.Host) {
+		return errors.Errorf("admin server on %s is not protected, use WithAdminToken or WithAdminMiddlewares", options.Host)
+	}
+
+	guards := make([]gin.HandlerFunc, 0, len(options.Middlewares)+1)
+	if options.Token != "" {
+		guards = append(guards, adminToken(options.Token))
+	}
+	guards = append(guards, options.Middlewares...)
+
+	var router gin.IRouter = s.engine
+	if options.Port > 0 {
+		engine := gin.New()
+		engine.Use(Recovery())
+		router = engine
+		s.admin = &http.Server{
+			Handler:           engine,
+			Addr:              net.JoinHostPort(options.Host, strconv.FormatUint(uint64(options.Port), 10)),
+			ReadHeaderTimeout: s.options.ReadHeaderTimeout,
+		}
+		s.shutdowns = append([]ShutdownFunc{s.admin.Shutdown}, s.shutdowns...)
+	}
+	group := router.Group(options.Prefix, guards...)
+
+	startedAt := time.Now()
+	routes := map[string]gin.HandlerFunc{
+		http.MethodGet + " /log/level": adminHandler(func(c *gin.Context, _ EmptyType) (AdminLogLevel, error) {
+			return adminLogLevel(), nil
+		}),
+		http.MethodPut + " /log/level": adminHandler(func(c *gin.Context, req adminLogLevelRequest) (AdminLogLevel, error) {
+			return setAdminLogLevel(c, req)
+		}),
+		http.MethodGet + " /routes": adminHandler(func(c *gin.Context, _ EmptyType) ([]AdminRoute, error) {
+			return adminRoutes(s.engine), nil
+		}),
+		http.MethodGet + " /build": adminHandler(func(c *gin.Context, _ EmptyType) (AdminBuildInfo, error) {
+			return adminBuildInfo(s.options.ServiceName, startedAt), nil
+		}),
+		http.MethodGet + " /config": adminHandler(func(c *gin.Context, _ EmptyType) (any, error) {
+			return adminConfig(c.Request.Context(), options)
+		}),
+	}
+	if options.Recorder != nil {
+		routes[http.MethodGet+" /recorder/routes"] = adminHandler(func(c *gin.Context, _ EmptyType) (map[string]float64, error) {
+			return options.Recorder.RouteSampleRates(), nil
+		})
+		routes[http.MethodPut+" /recorder/routes"] = adminHandler(func(c *gin.Context, req adminRecorderRequest) (map[string]float64, error) {
+			if req.SampleRate == nil {
+				options.Recorder.ResetRouteSampleRate(req.Method, req.Route)
+			} else {
+				options.Recorder.SetRouteSampleRate(req.Method, req.Route, *req.SampleRate)
+			}
+			logger.Warnf(c.Request.Context(), "record sample rate of %s %s changed by admin", req.Method, req.Route)
+			return options.Recorder.RouteSampleRates(), nil
+		})
+	}
+	for route, handler := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		group.Handle(method, path, handler)
+		if options.Port == 0 {
+			// 服务过载时管理接口仍然可用
+			s.admission.set(method, strings.TrimRight(options.Prefix, "/")+path, PriorityCritical)
+		}
+	}
+	return nil
+}
+
+// adminHandler 管理接口不生成 openapi 文档，只使用 NewHandler 的绑定与响应
+func adminHandler[RequestT any, ResponseT any](handler Handler[RequestT, ResponseT]) gin.HandlerFunc {
+	_, _, _, _, _, _, handlerFunc := NewHandler(handler)()
+	return handlerFunc
+}
+
+func adminToken(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+			body := &Body[EmptyType]{}
+			body.WithErr(ErrWithUnAuthorized())
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+		c.Next()
+	}
+}
+
+// loopbackHost host 为空时监听所有地址，不是本机地址
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type adminLogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+	// TTL 到期后恢复为修改前的级别，例如 10m，为空时永久生效
+	TTL string `json:"ttl"`
+}
+
+type adminRecorderRequest struct {
+	// Method 为 * 时对所有方法生效
+	Method string `json:"method" binding:"required"`
+	// Route gin 的路由模板，例如 /users/:id
+	Route string `json:"route" binding:"required"`
+	// SampleRate 为空时恢复默认的采样比例，为 0 时关闭录制
+	SampleRate *float64 `json:"sample_rate"`
+}
+
+func adminLogLevel() AdminLogLevel {
+	level := AdminLogLevel{Level: logger.GetLevel()}
+	if at := logger.LevelRevertAt(); !at.IsZero() {
+		level.RevertAt = &at
+	}
+	return level
+}
+
+func setAdminLogLevel(c *gin.Context, req adminLogLevelRequest) (AdminLogLevel, error) {
+	level, err := logger.ParseLevel(strings.ToLower(req.Level))
+	if err != nil {
+		return AdminLogLevel{}, NewError(CodeBadRequest, err.Error()).WithStatus(http.StatusBadRequest)
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			return AdminLogLevel{}, NewError(CodeBadRequest, fmt.Sprintf("invalid ttl %q", req.TTL)).WithStatus(http.StatusBadRequest)
+		}
+	}
+	if err = logger.SetLevel(level, ttl); err != nil {
+		return AdminLogLevel{}, errors.Wrap(err, "set log level err")
+	}
+	logger.Warnf(c.Request.Context(), "log level changed to %s by admin, ttl: %s", level, ttl)
+	return adminLogLevel(), nil
+}
+
+// adminRoutes gin 只暴露路由最后一个处理函数，完整的处理链从路由树中读取，读取失败时中间件为空
+func adminRoutes(engine *gin.Engine) []AdminRoute {
+	chains := ginHandlerChains(engine)
+	infos := engine.Routes()
+	routes := make([]AdminRoute, 0, len(infos))
+	for _, info := range infos {
+		route := AdminRoute{Method: info.Method, Path: info.Path, Handler: info.Handler, Middlewares: []string{}}
+		if chain := chains[info.Method+" "+info.Path]; len(chain) > 0 {
+			route.Middlewares = chain[:len(chain)-1]
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// ginHandlerChains 通过反射读取 gin.Engine 未导出的路由树，key 为 method path，value 为处理函数名
+func ginHandlerChains(engine *gin.Engine) (chains map[string][]string) {
+	chains = make(map[string][]string)
+	defer func() {
+		// gin 的内部结构变化时不影响路由列表
+		if r := recover(); r != nil {
+			logger.Warnf(context.Background(), "read gin route trees err: %v", r)
+		}
+	}()
+
+	var walk func(method string, node reflect.Value)
+	walk = func(method string, node reflect.Value) {
+		if node.Kind() == reflect.Pointer {
+			if node.IsNil() {
+				return
+			}
+			node = node.Elem()
+		}
+		if handlers := node.FieldByName("handlers"); handlers.Len() > 0 {
+			names := make([]string, 0, handlers.Len())
+			for i := 0; i < handlers.Len(); i++ {
+				names = append(names, runtime.FuncForPC(handlers.Index(i).Pointer()).Name())
+			}
+			chains[method+" "+node.FieldByName("fullPath").String()] = names
+		}
+		children := node.FieldByName("children")
+		for i := 0; i < children.Len(); i++ {
+			walk(method, children.Index(i))
+		}
+	}
+
+	trees := reflect.ValueOf(engine).Elem().FieldByName("trees")
+	for i := 0; i < trees.Len(); i++ {
+		tree := trees.Index(i)
+		walk(tree.FieldByName("method").String(), tree.FieldByName("root"))
+	}
+	return chains
+}
+
+func adminBuildInfo(serviceName string, startedAt time.Time) AdminBuildInfo {
+	info := AdminBuildInfo{
+		ServiceName: serviceName,
+		GoVersion:   runtime.Version(),
+		Settings:    map[string]string{},
+		Deps:        []AdminModule{},
+		StartedAt:   startedAt,
+		Uptime:      time.Since(startedAt).Round(time.Second).String(),
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	info.Path = build.Path
+	info.Main = AdminModule{Path: build.Main.Path, Version: build.Main.Version, Sum: build.Main.Sum}
+	for _, setting := range build.Settings {
+		info.Settings[setting.Key] = setting.Value
+	}
+	for _, dep := range build.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		info.Deps = append(info.Deps, AdminModule{Path: dep.Path, Version: dep.Version, Sum: dep.Sum})
+	}
+	return info
+}
+
+// adminConfig 配置转换为 json 后隐藏 RedactKeys 的值
+func adminConfig(ctx context.Context, options *AdminOptions) (any, error) {
+	if options.Config == nil {
+		return nil, NewError(CodeNotFound, "config is not set, use WithAdminConfig").WithStatus(http.StatusNotFound)
+	}
+	cfg := options.Config
+	if c, ok := cfg.(*config.Config); ok {
+		cfg = c.Kernel().AllSettings()
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		logger.WithError(err).Error(ctx, "failed to marshal admin config")
+		return nil, ErrorWithInternalServer()
+	}
+	var settings any
+	if err = json.Unmarshal(data, &settings); err != nil {
+		logger.WithError(err).Error(ctx, "failed to unmarshal admin config")
+		return nil, ErrorWithInternalServer()
+	}
+	return redactConfig(settings, options.RedactKeys), nil
+}
+
+func redactConfig(value any, keys []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if redactKey(key, keys) {
+				v[key] = adminRedacted
+				continue
+			}
+			v[key] = redactConfig(item, keys)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactConfig(item, keys)
+		}
+	}
+	return value
+}
+
+func redactKey(key string, keys []string) bool {
+	key = strings.ToLower(key)
+	for _, k := range keys {
+		if strings.Contains(key, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,365 @@
+package httpserver
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+// Priority 路由的优先级，并发接近上限时先拒绝低优先级的请求，PriorityCritical 不会被拒绝
+type Priority int
+
+const (
+	PriorityLow      Priority = -1
+	PriorityNormal   Priority = 0
+	PriorityHigh     Priority = 1
+	PriorityCritical Priority = 2
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// DefaultCriticalPaths 默认不会被拒绝的路径，以 / 结尾表示前缀匹配
+var DefaultCriticalPaths = []string{"/health", "/metrics", "/debug/pprof/"}
+
+type AdmissionOptions struct {
+	// Limiter 并发上限，默认为 NewStaticLimiter(1000)
+	Limiter Limiter
+	// Reserve 为高优先级请求保留的比例，普通请求最多使用 1-Reserve，低优先级请求最多使用 1-2*Reserve
+	Reserve float64
+	// RetryAfter 拒绝时响应的 Retry-After
+	RetryAfter    time.Duration
+	CriticalPaths []string
+}
+
+type AdmissionOption func(*AdmissionOptions)
+
+func mergeAdmissionOptions(opts ...AdmissionOption) *AdmissionOptions {
+	opt := &AdmissionOptions{
+		Reserve:       0.1,
+		RetryAfter:    time.Second,
+		CriticalPaths: DefaultCriticalPaths,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.Limiter == nil {
+		opt.Limiter = NewStaticLimiter(1000)
+	}
+	return opt
+}
+
+// WithAdmissionLimiter 设置并发上限，例如 NewStaticLimiter、NewAIMDLimiter、NewGradientLimiter
+func WithAdmissionLimiter(limiter Limiter) AdmissionOption {
+	return func(o *AdmissionOptions) {
+		o.Limiter = limiter
+	}
+}
+
+func WithAdmissionReserve(reserve float64) AdmissionOption {
+	return func(o *AdmissionOptions) {
+		o.Reserve = reserve
+	}
+}
+
+func WithAdmissionRetryAfter(retryAfter time.Duration) AdmissionOption {
+	return func(o *AdmissionOptions) {
+		o.RetryAfter = retryAfter
+	}
+}
+
+// WithAdmissionCriticalPaths 追加不会被拒绝的路径，路由也可以通过 WithPriority(PriorityCritical) 设置
+func WithAdmissionCriticalPaths(paths ...string) AdmissionOption {
+	return func(o *AdmissionOptions) {
+		o.CriticalPaths = append(append([]string{}, o.CriticalPaths...), paths...)
+	}
+}
+
+// AdmissionRejected 拒绝请求时响应的数据
+type AdmissionRejected struct {
+	// RetryAfter 建议重试的间隔秒数，与 Retry-After header 一致
+	RetryAfter int `json:"retry_after"`
+}
+
+// admission 准入控制，记录路由的优先级，key 为 "METHOD /path/:id"
+type admission struct {
+	options  *AdmissionOptions
+	routes   sync.Map
+	inflight atomic.Int64
+	rejected metric.Int64Counter
+}
+
+func newAdmission() *admission {
+	return &admission{}
+}
+
+func (a *admission) set(method, path string, priority Priority) {
+	if priority != PriorityNormal {
+		a.routes.Store(method+" "+path, priority)
+	}
+}
+
+func (a *admission) priority(c *gin.Context) Priority {
+	if priority, ok := a.routes.Load(c.Request.Method + " " + c.FullPath()); ok {
+		return priority.(Priority)
+	}
+	path := c.Request.URL.Path
+	for _, critical := range a.options.CriticalPaths {
+		if path == critical || (strings.HasSuffix(critical, "/") && strings.HasPrefix(path, critical)) {
+			return PriorityCritical
+		}
+	}
+	return PriorityNormal
+}
+
+// threshold 优先级可以使用的并发数
+func (a *admission) threshold(limit int, priority Priority) int64 {
+	ratio := 1.0
+	switch priority {
+	case PriorityNormal:
+		ratio = 1 - a.options.Reserve
+	case PriorityLow:
+		ratio = 1 - 2*a.options.Reserve
+	}
+	return int64(math.Max(1, math.Ceil(float64(limit)*ratio)))
+}
+
+// Middleware 并发超过优先级可以使用的上限时返回 503，请求结束后将耗时反馈给 Limiter
+func (a *admission) Middleware(opts ...AdmissionOption) gin.HandlerFunc {
+	a.options = mergeAdmissionOptions(opts...)
+	a.registerMetrics()
+	retryAfter := int(math.Ceil(a.options.RetryAfter.Seconds()))
+
+	return func(c *gin.Context) {
+		priority := a.priority(c)
+		if priority == PriorityCritical {
+			c.Next()
+			return
+		}
+
+		limit := a.options.Limiter.Limit()
+		inflight := a.inflight.Add(1)
+		if inflight > a.threshold(limit, priority) {
+			a.inflight.Add(-1)
+			if a.rejected != nil {
+				a.rejected.Add(c.Request.Context(), 1, metric.WithAttributes(attribute.String("priority", priority.String())))
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			body := &Body[AdmissionRejected]{Data: AdmissionRejected{RetryAfter: retryAfter}}
+			body.WithErr(ErrorWithServiceUnavailable())
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			a.inflight.Add(-1)
+			a.options.Limiter.Observe(time.Since(start), int(inflight), c.Writer.Status() >= http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+func (a *admission) registerMetrics() {
+	meter := otel.Meter("github.com/ihezebin/olympus/httpserver")
+	var err error
+	a.rejected, err = meter.Int64Counter("http.server.admission.rejected", metric.WithDescription("准入控制拒绝的请求数"))
+	if err != nil {
+		logger.WithError(err).Error(context.Background(), "new admission rejected counter err")
+	}
+	limit, err := meter.Int64ObservableGauge("http.server.admission.limit", metric.WithDescription("准入控制的并发上限"))
+	if err != nil {
+		logger.WithError(err).Error(context.Background(), "new admission limit gauge err")
+		return
+	}
+	inflight, err := meter.Int64ObservableGauge("http.server.admission.inflight", metric.WithDescription("正在处理的请求数"))
+	if err != nil {
+		logger.WithError(err).Error(context.Background(), "new admission inflight gauge err")
+		return
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		observer.ObserveInt64(limit, int64(a.options.Limiter.Limit()))
+		observer.ObserveInt64(inflight, a.inflight.Load())
+		return nil
+	}, limit, inflight)
+	if err != nil {
+		logger.WithError(err).Error(context.Background(), "register admission metrics callback err")
+	}
+}
+
+// Limiter 并发上限，自适应的实现根据请求耗时调整上限
+type Limiter interface {
+	Limit() int
+	// Observe 请求结束后调用，inflight 为请求开始时的并发数，dropped 表示请求失败，例如 5xx
+	Observe(latency time.Duration, inflight int, dropped bool)
+}
+
+type staticLimiter struct {
+	limit int
+}
+
+// NewStaticLimiter 固定的并发上限
+func NewStaticLimiter(limit int) Limiter {
+	return &staticLimiter{limit: limit}
+}
+
+func (l *staticLimiter) Limit() int {
+	return l.limit
+}
+
+func (l *staticLimiter) Observe(time.Duration, int, bool) {}
+
+type AIMDLimiterConfig struct {
+	Initial int
+	Min     int
+	Max     int
+	// LatencyThreshold 耗时超过该值视为过载
+	LatencyThreshold time.Duration
+	// BackoffRatio 过载时上限乘以该比例
+	BackoffRatio float64
+}
+
+type aimdLimiter struct {
+	config AIMDLimiterConfig
+	mu     sync.Mutex
+	limit  int
+}
+
+// NewAIMDLimiter 加性增乘性减，请求成功且并发接近上限时上限加一，耗时超过 LatencyThreshold 或失败时乘以 BackoffRatio
+func NewAIMDLimiter(config AIMDLimiterConfig) Limiter {
+	config.Initial, config.Min, config.Max = limiterBounds(config.Initial, config.Min, config.Max)
+	if config.LatencyThreshold <= 0 {
+		config.LatencyThreshold = time.Second
+	}
+	if config.BackoffRatio <= 0 || config.BackoffRatio >= 1 {
+		config.BackoffRatio = 0.9
+	}
+	return &aimdLimiter{config: config, limit: config.Initial}
+}
+
+func (l *aimdLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *aimdLimiter) Observe(latency time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if dropped || latency > l.config.LatencyThreshold {
+		l.limit = max(l.config.Min, int(float64(l.limit)*l.config.BackoffRatio))
+		return
+	}
+	// 并发远低于上限时增加上限没有意义
+	if inflight*2 >= l.limit {
+		l.limit = min(l.config.Max, l.limit+1)
+	}
+}
+
+type GradientLimiterConfig struct {
+	Initial int
+	Min     int
+	Max     int
+	// Smoothing 每次调整的平滑系数，0 到 1
+	Smoothing float64
+	// Tolerance 短期耗时超过长期耗时的倍数后开始减小上限
+	Tolerance float64
+	// LongWindow 长期耗时的指数移动平均窗口，单位为请求数
+	LongWindow int
+}
+
+type gradientLimiter struct {
+	config  GradientLimiterConfig
+	mu      sync.Mutex
+	limit   float64
+	longRTT float64
+}
+
+// NewGradientLimiter 根据长期与短期耗时的比值调整上限，耗时上升时减小上限，并保留 sqrt(limit) 的排队空间
+func NewGradientLimiter(config GradientLimiterConfig) Limiter {
+	config.Initial, config.Min, config.Max = limiterBounds(config.Initial, config.Min, config.Max)
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = 0.2
+	}
+	if config.Tolerance < 1 {
+		config.Tolerance = 1.5
+	}
+	if config.LongWindow <= 0 {
+		config.LongWindow = 600
+	}
+	return &gradientLimiter{config: config, limit: float64(config.Initial)}
+}
+
+func (l *gradientLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *gradientLimiter) Observe(latency time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rtt := float64(latency)
+	if rtt <= 0 {
+		return
+	}
+	if l.longRTT == 0 {
+		l.longRTT = rtt
+	} else {
+		l.longRTT += (rtt - l.longRTT) / float64(l.config.LongWindow)
+	}
+	// 长期耗时明显高于短期耗时说明已经恢复，加快长期耗时的衰减
+	if l.longRTT/rtt > 2 {
+		l.longRTT *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.config.Tolerance*l.longRTT/rtt))
+	if dropped {
+		gradient = 0.5
+	}
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	// 并发远低于上限时不增加上限
+	if float64(inflight) < l.limit/2 {
+		newLimit = math.Min(newLimit, l.limit)
+	}
+	newLimit = l.limit*(1-l.config.Smoothing) + newLimit*l.config.Smoothing
+	l.limit = math.Max(float64(l.config.Min), math.Min(float64(l.config.Max), newLimit))
+}
+
+// limiterBounds 默认上限范围为 1 到 1000，初始值为 100
+func limiterBounds(initial, minLimit, maxLimit int) (int, int, int) {
+	if minLimit <= 0 {
+		minLimit = 1
+	}
+	if maxLimit <= 0 {
+		maxLimit = 1000
+	}
+	if initial <= 0 {
+		initial = 100
+	}
+	maxLimit = max(maxLimit, minLimit)
+	return min(max(initial, minLimit), maxLimit), minLimit, maxLimit
+}
@@ -0,0 +1,436 @@
+package apidiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+)
+
+type Level string
+
+const (
+	LevelBreaking    Level = "breaking"
+	LevelNonBreaking Level = "non-breaking"
+)
+
+// Change 两份 openapi 文档之间的一处差异
+type Change struct {
+	Level  Level  `json:"level"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// Location 差异所在位置，例如 query.ids、request.body.name、response.200.data.id
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (c Change) String() string {
+	target := strings.TrimSpace(strings.Join([]string{c.Method, c.Path}, " "))
+	if c.Location != "" {
+		target = fmt.Sprintf("%s [%s]", target, c.Location)
+	}
+	return fmt.Sprintf("%s: %s %s", c.Level, target, c.Message)
+}
+
+type Report struct {
+	Changes []Change `json:"changes"`
+}
+
+func (r *Report) Breaking() []Change {
+	changes := make([]Change, 0)
+	for _, change := range r.Changes {
+		if change.Level == LevelBreaking {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func (r *Report) HasBreaking() bool {
+	return len(r.Breaking()) > 0
+}
+
+// Load 从文件加载 openapi 文档，支持 json 和 yaml
+func Load(path string) (*openapi3.T, error) {
+	spec, err := openapi3.NewLoader().LoadFromFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load openapi spec: %s err", path)
+	}
+	return spec, nil
+}
+
+// LoadData 从内存数据加载 openapi 文档，支持 json 和 yaml
+func LoadData(data []byte) (*openapi3.T, error) {
+	spec, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "load openapi spec err")
+	}
+	return spec, nil
+}
+
+// Diff 比较 base 与 revision 两份文档，并将差异分为 breaking 与 non-breaking
+func Diff(base, revision *openapi3.T) *Report {
+	d := &differ{report: &Report{Changes: make([]Change, 0)}}
+
+	basePaths := pathItems(base)
+	revisionPaths := pathItems(revision)
+
+	for _, path := range sortedKeys(basePaths) {
+		baseOperations := basePaths[path].Operations()
+		revisionItem, ok := revisionPaths[path]
+		if !ok {
+			for _, method := range sortedKeys(baseOperations) {
+				d.add(LevelBreaking, method, path, "", "operation removed")
+			}
+			continue
+		}
+
+		revisionOperations := revisionItem.Operations()
+		for _, method := range sortedKeys(baseOperations) {
+			revisionOperation, ok := revisionOperations[method]
+			if !ok {
+				d.add(LevelBreaking, method, path, "", "operation removed")
+				continue
+			}
+			d.operation(method, path, baseOperations[method], revisionOperation)
+		}
+		for _, method := range sortedKeys(revisionOperations) {
+			if _, ok := baseOperations[method]; !ok {
+				d.add(LevelNonBreaking, method, path, "", "operation added")
+			}
+		}
+	}
+
+	for _, path := range sortedKeys(revisionPaths) {
+		if _, ok := basePaths[path]; ok {
+			continue
+		}
+		for _, method := range sortedKeys(revisionPaths[path].Operations()) {
+			d.add(LevelNonBreaking, method, path, "", "operation added")
+		}
+	}
+
+	return d.report
+}
+
+type direction int
+
+const (
+	directionRequest direction = iota
+	directionResponse
+)
+
+type differ struct {
+	report *Report
+	method string
+	path   string
+}
+
+func (d *differ) add(level Level, method, path, location, format string, args ...any) {
+	d.report.Changes = append(d.report.Changes, Change{
+		Level:    level,
+		Method:   method,
+		Path:     path,
+		Location: location,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *differ) addf(level Level, location, format string, args ...any) {
+	d.add(level, d.method, d.path, location, format, args...)
+}
+
+func (d *differ) operation(method, path string, base, revision *openapi3.Operation) {
+	d.method, d.path = method, path
+
+	if !base.Deprecated && revision.Deprecated {
+		d.addf(LevelNonBreaking, "", "operation deprecated")
+	}
+
+	d.parameters(base.Parameters, revision.Parameters)
+	d.requestBody(base.RequestBody, revision.RequestBody)
+	d.responses(base.Responses, revision.Responses)
+}
+
+func (d *differ) parameters(base, revision openapi3.Parameters) {
+	baseParams := parameterMap(base)
+	revisionParams := parameterMap(revision)
+
+	for _, key := range sortedKeys(baseParams) {
+		baseParam := baseParams[key]
+		revisionParam, ok := revisionParams[key]
+		if !ok {
+			d.addf(LevelNonBreaking, key, "parameter removed")
+			continue
+		}
+		if !baseParam.Required && revisionParam.Required {
+			d.addf(LevelBreaking, key, "parameter became required")
+		}
+		d.schema(key, schemaValue(baseParam.Schema), schemaValue(revisionParam.Schema), directionRequest, map[[2]*openapi3.Schema]bool{})
+	}
+
+	for _, key := range sortedKeys(revisionParams) {
+		if _, ok := baseParams[key]; ok {
+			continue
+		}
+		if revisionParams[key].Required {
+			d.addf(LevelBreaking, key, "new required parameter")
+		} else {
+			d.addf(LevelNonBreaking, key, "new optional parameter")
+		}
+	}
+}
+
+func (d *differ) requestBody(base, revision *openapi3.RequestBodyRef) {
+	baseBody, revisionBody := requestBodyValue(base), requestBodyValue(revision)
+	switch {
+	case baseBody == nil && revisionBody == nil:
+		return
+	case baseBody == nil:
+		if revisionBody.Required {
+			d.addf(LevelBreaking, "request.body", "new required request body")
+		} else {
+			d.addf(LevelNonBreaking, "request.body", "new optional request body")
+		}
+		return
+	case revisionBody == nil:
+		d.addf(LevelNonBreaking, "request.body", "request body removed")
+		return
+	}
+
+	if !baseBody.Required && revisionBody.Required {
+		d.addf(LevelBreaking, "request.body", "request body became required")
+	}
+	d.content("request.body", baseBody.Content, revisionBody.Content, directionRequest)
+}
+
+func (d *differ) responses(base, revision *openapi3.Responses) {
+	var baseResponses, revisionResponses map[string]*openapi3.ResponseRef
+	if base != nil {
+		baseResponses = base.Map()
+	}
+	if revision != nil {
+		revisionResponses = revision.Map()
+	}
+
+	for _, status := range sortedKeys(baseResponses) {
+		location := "response." + status
+		revisionResponse, ok := revisionResponses[status]
+		if !ok {
+			level := LevelNonBreaking
+			if isSuccessStatus(status) {
+				level = LevelBreaking
+			}
+			d.addf(level, location, "response removed")
+			continue
+		}
+		baseValue, revisionValue := baseResponses[status].Value, revisionResponse.Value
+		if baseValue == nil || revisionValue == nil {
+			continue
+		}
+		d.content(location, baseValue.Content, revisionValue.Content, directionResponse)
+	}
+
+	for _, status := range sortedKeys(revisionResponses) {
+		if _, ok := baseResponses[status]; !ok {
+			d.addf(LevelNonBreaking, "response."+status, "response added")
+		}
+	}
+}
+
+func (d *differ) content(location string, base, revision openapi3.Content, dir direction) {
+	for _, mediaType := range sortedKeys(base) {
+		revisionMedia, ok := revision[mediaType]
+		if !ok {
+			d.addf(LevelBreaking, location, "media type %s removed", mediaType)
+			continue
+		}
+		d.schema(location, schemaValue(base[mediaType].Schema), schemaValue(revisionMedia.Schema), dir, map[[2]*openapi3.Schema]bool{})
+	}
+
+	for _, mediaType := range sortedKeys(revision) {
+		if _, ok := base[mediaType]; !ok {
+			d.addf(LevelNonBreaking, location, "media type %s added", mediaType)
+		}
+	}
+}
+
+func (d *differ) schema(location string, base, revision *openapi3.Schema, dir direction, visited map[[2]*openapi3.Schema]bool) {
+	if base == nil || revision == nil {
+		return
+	}
+	// 避免循环引用的结构体无限递归
+	pair := [2]*openapi3.Schema{base, revision}
+	if visited[pair] {
+		return
+	}
+	visited[pair] = true
+
+	baseType, revisionType := schemaType(base), schemaType(revision)
+	if baseType != revisionType {
+		d.addf(LevelBreaking, location, "type changed from %q to %q", baseType, revisionType)
+		return
+	}
+	if base.Format != revision.Format {
+		d.addf(LevelBreaking, location, "format changed from %q to %q", base.Format, revision.Format)
+	}
+
+	d.enum(location, base.Enum, revision.Enum, dir)
+
+	if base.Items != nil || revision.Items != nil {
+		d.schema(location+"[]", schemaValue(base.Items), schemaValue(revision.Items), dir, visited)
+	}
+
+	if base.AdditionalProperties.Schema != nil || revision.AdditionalProperties.Schema != nil {
+		d.schema(location+".*", schemaValue(base.AdditionalProperties.Schema), schemaValue(revision.AdditionalProperties.Schema), dir, visited)
+	}
+
+	baseRequired, revisionRequired := stringSet(base.Required), stringSet(revision.Required)
+	for _, name := range sortedKeys(base.Properties) {
+		propertyLocation := location + "." + name
+		revisionProperty, ok := revision.Properties[name]
+		if !ok {
+			if dir == directionResponse {
+				d.addf(LevelBreaking, propertyLocation, "response field removed")
+			} else {
+				d.addf(LevelNonBreaking, propertyLocation, "request field removed")
+			}
+			continue
+		}
+		switch {
+		case dir == directionRequest && !baseRequired[name] && revisionRequired[name]:
+			d.addf(LevelBreaking, propertyLocation, "request field became required")
+		case dir == directionResponse && baseRequired[name] && !revisionRequired[name]:
+			d.addf(LevelBreaking, propertyLocation, "response field became optional")
+		}
+		d.schema(propertyLocation, schemaValue(base.Properties[name]), schemaValue(revisionProperty), dir, visited)
+	}
+
+	for _, name := range sortedKeys(revision.Properties) {
+		if _, ok := base.Properties[name]; ok {
+			continue
+		}
+		propertyLocation := location + "." + name
+		if dir == directionRequest && revisionRequired[name] {
+			d.addf(LevelBreaking, propertyLocation, "new required request field")
+		} else {
+			d.addf(LevelNonBreaking, propertyLocation, "field added")
+		}
+	}
+}
+
+// enum 请求中删除枚举值、响应中新增枚举值都会导致已有的调用方出错
+func (d *differ) enum(location string, base, revision []any, dir direction) {
+	if len(base) == 0 && len(revision) == 0 {
+		return
+	}
+	if len(base) == 0 {
+		if dir == directionRequest {
+			d.addf(LevelBreaking, location, "enum restriction added")
+		} else {
+			d.addf(LevelNonBreaking, location, "enum restriction added")
+		}
+		return
+	}
+	if len(revision) == 0 {
+		if dir == directionResponse {
+			d.addf(LevelBreaking, location, "enum restriction removed")
+		} else {
+			d.addf(LevelNonBreaking, location, "enum restriction removed")
+		}
+		return
+	}
+
+	for _, value := range base {
+		if !containsValue(revision, value) {
+			level := LevelNonBreaking
+			if dir == directionRequest {
+				level = LevelBreaking
+			}
+			d.addf(level, location, "enum value %v removed", value)
+		}
+	}
+	for _, value := range revision {
+		if !containsValue(base, value) {
+			level := LevelNonBreaking
+			if dir == directionResponse {
+				level = LevelBreaking
+			}
+			d.addf(level, location, "enum value %v added", value)
+		}
+	}
+}
+
+func pathItems(spec *openapi3.T) map[string]*openapi3.PathItem {
+	if spec == nil || spec.Paths == nil {
+		return map[string]*openapi3.PathItem{}
+	}
+	return spec.Paths.Map()
+}
+
+func parameterMap(params openapi3.Parameters) map[string]*openapi3.Parameter {
+	m := make(map[string]*openapi3.Parameter, len(params))
+	for _, ref := range params {
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		m[ref.Value.In+"."+ref.Value.Name] = ref.Value
+	}
+	return m
+}
+
+func requestBodyValue(ref *openapi3.RequestBodyRef) *openapi3.RequestBody {
+	if ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+func schemaValue(ref *openapi3.SchemaRef) *openapi3.Schema {
+	if ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+func schemaType(schema *openapi3.Schema) string {
+	if schema.Type == nil {
+		return ""
+	}
+	types := append([]string{}, schema.Type.Slice()...)
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+func isSuccessStatus(status string) bool {
+	return strings.HasPrefix(status, "2")
+}
+
+func containsValue(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package apidiff
+
+import (
+	"testing"
+)
+
+const baseSpec = `
+openapi: 3.0.0
+info: {title: test, version: "1.0"}
+paths:
+  /users:
+    get:
+      parameters:
+        - {name: page, in: query, schema: {type: integer}}
+      responses:
+        "200":
+          description: ""
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, name]
+                properties:
+                  id: {type: integer}
+                  name: {type: string}
+  /users/{id}:
+    delete:
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: string}}
+      responses:
+        "200": {description: ""}
+`
+
+const revisionSpec = `
+openapi: 3.0.0
+info: {title: test, version: "1.1"}
+paths:
+  /users:
+    get:
+      parameters:
+        - {name: page, in: query, schema: {type: string}}
+        - {name: tenant, in: header, required: true, schema: {type: string}}
+        - {name: size, in: query, schema: {type: integer}}
+      responses:
+        "200":
+          description: ""
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id: {type: integer}
+                  email: {type: string}
+    post:
+      responses:
+        "200": {description: ""}
+`
+
+func TestDiff(t *testing.T) {
+	base, err := LoadData([]byte(baseSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision, err := LoadData([]byte(revisionSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Diff(base, revision)
+	for _, change := range report.Changes {
+		t.Log(change)
+	}
+
+	expected := map[string]Level{
+		"DELETE /users/{id} []":           LevelBreaking,
+		"GET /users [query.page]":         LevelBreaking,
+		"GET /users [header.tenant]":      LevelBreaking,
+		"GET /users [query.size]":         LevelNonBreaking,
+		"GET /users [response.200.name]":  LevelBreaking,
+		"GET /users [response.200.email]": LevelNonBreaking,
+		"POST /users []":                  LevelNonBreaking,
+	}
+	got := make(map[string]Level)
+	for _, change := range report.Changes {
+		got[change.Method+" "+change.Path+" ["+change.Location+"]"] = change.Level
+	}
+	for key, level := range expected {
+		if got[key] != level {
+			t.Errorf("change %s: expected %s, got %q", key, level, got[key])
+		}
+	}
+
+	if !report.HasBreaking() {
+		t.Fatal("expected breaking changes")
+	}
+	if Diff(base, base).HasBreaking() {
+		t.Fatal("expected no breaking changes for the same spec")
+	}
+}
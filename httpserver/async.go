@@ -0,0 +1,456 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/pubsub"
+	"github.com/ihezebin/olympus/requestid"
+)
+
+// JobProgress 报告任务进度，progress 为 0 到 1
+type JobProgress func(progress float64, message string)
+
+// AsyncHandlerFunc 异步执行的处理函数，请求已经响应，ctx 不会随请求结束而取消，但保留 trace、租户等信息
+type AsyncHandlerFunc[RequestT any, ResponseT any] func(ctx context.Context, req RequestT, progress JobProgress) (ResponseT, error)
+
+// JobAccepted 提交任务后响应的数据
+type JobAccepted struct {
+	ID string `json:"id"`
+	// StatusURL 查询任务状态的地址，与 Location header 一致
+	StatusURL string `json:"status_url"`
+}
+
+// JobState 查询任务状态响应的数据，任务结束后 Result 为处理函数的 Body
+type JobState[ResponseT any] struct {
+	ID        string           `json:"id"`
+	Status    JobStatus        `json:"status"`
+	Progress  float64          `json:"progress"`
+	Message   string           `json:"message,omitempty"`
+	Result    *Body[ResponseT] `json:"result,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+type AsyncOptions struct {
+	// Store 默认为 NewMemoryJobStore(24 * time.Hour)，使用 Publisher 时需要进程间共享，例如 NewRedisJobStore
+	Store JobStore
+	// Publisher 不为空时任务发送到队列，由 AsyncHandler.Work 在其他进程中执行，否则在当前进程中执行
+	Publisher pubsub.Publisher
+	// Timeout 任务执行的超时时间，小于等于 0 表示不超时
+	Timeout time.Duration
+	// Workers 当前进程中同时执行的任务数，默认 10，使用 Publisher 时由 Work 控制
+	Workers int
+	// QueueSize 当前进程中等待执行的任务数，超出时提交返回 503，默认 1000
+	QueueSize int
+}
+
+type AsyncOption func(*AsyncOptions)
+
+func mergeAsyncOptions(opts ...AsyncOption) *AsyncOptions {
+	opt := &AsyncOptions{
+		Workers:   10,
+		QueueSize: 1000,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.Store == nil {
+		opt.Store = NewMemoryJobStore(24 * time.Hour)
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = 10
+	}
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = 1000
+	}
+	return opt
+}
+
+func WithJobStore(store JobStore) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.Store = store
+	}
+}
+
+// WithJobPublisher 任务发送到队列，消息的 Payload 为任务 ID，Properties 携带 trace 与 baggage
+func WithJobPublisher(publisher pubsub.Publisher) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.Publisher = publisher
+	}
+}
+
+func WithJobTimeout(timeout time.Duration) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// WithJobWorkers 当前进程中同时执行 workers 个任务，最多 queueSize 个任务等待执行
+func WithJobWorkers(workers int, queueSize int) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.Workers = workers
+		o.QueueSize = queueSize
+	}
+}
+
+// errJobQueueFull 当前进程中等待执行的任务超过 QueueSize
+var errJobQueueFull = errors.New("job queue is full")
+
+// errAsyncClosed 服务关闭后不再接收任务
+var errAsyncClosed = errors.New("async handler is closed")
+
+// AsyncRoute 通过 Async 注册的异步路由，服务关闭时调用 Close
+type AsyncRoute interface {
+	submitHandler() handlerGenerator
+	stateHandler() handlerGenerator
+	Close(ctx context.Context) error
+}
+
+type AsyncHandler[RequestT any, ResponseT any] struct {
+	handler AsyncHandlerFunc[RequestT, ResponseT]
+	options *AsyncOptions
+
+	// 当前进程中执行任务的 worker，第一次提交时启动
+	mu      sync.Mutex
+	queue   chan func()
+	closed  bool
+	workers sync.WaitGroup
+}
+
+var _ AsyncRoute = (*AsyncHandler[EmptyType, EmptyType])(nil)
+
+// NewAsyncHandler 提交任务后立即响应 202 与任务 ID，通过 Async 注册，适用于导出 Excel 等耗时较长的操作
+//
+//	httpserver.Async(router, "/exports", NewAsyncHandler(func(ctx context.Context, req ExportRequest, progress JobProgress) (ExportResponse, error) {...}))
+func NewAsyncHandler[RequestT any, ResponseT any](handler AsyncHandlerFunc[RequestT, ResponseT], opts ...AsyncOption) *AsyncHandler[RequestT, ResponseT] {
+	return &AsyncHandler[RequestT, ResponseT]{handler: handler, options: mergeAsyncOptions(opts...)}
+}
+
+// Async 在 router 上注册 POST path 提交任务与 GET path/jobs/:id 查询任务状态，options 对两个路由都生效
+func Async(router Router, path string, h AsyncRoute, options ...RouterOption) error {
+	r, err := openapiRouterOf(router)
+	if err != nil {
+		return err
+	}
+	accepted := func(o *RouterOptions) {
+		o.OpenAPIOptions = append(o.OpenAPIOptions, func(route *openapi.Route) {
+			route.HasResponseModel(http.StatusAccepted, openapi.ModelOf[Body[JobAccepted]]())
+			route.HasResponseHeader(http.StatusAccepted, "Location", openapi.HeaderParam{Description: "查询任务状态的地址", Type: openapi.PrimitiveTypeString})
+		})
+	}
+	r.asyncs.add(h)
+	r.PostWithOptions(path, h.submitHandler(), append(append([]RouterOption{}, options...), accepted)...)
+	r.GetWithOptions(r.mergePath(path, "/jobs/:id"), h.stateHandler(), options...)
+	return nil
+}
+
+func (h *AsyncHandler[RequestT, ResponseT]) submitHandler() handlerGenerator {
+	generator := NewHandler(func(c *gin.Context, req RequestT) (EmptyType, error) {
+		ctx := c.Request.Context()
+		job, err := h.submit(ctx, req)
+		if err != nil {
+			logger.WithError(err).Errorf(ctx, "failed to submit job, uri: %s", c.Request.RequestURI)
+			if errors.Is(err, errJobQueueFull) || errors.Is(err, errAsyncClosed) {
+				return EmptyResponse, ErrorWithServiceUnavailable()
+			}
+			return EmptyResponse, ErrorWithInternalServer()
+		}
+
+		statusURL := strings.TrimSuffix(c.Request.URL.Path, "/") + "/jobs/" + job.ID
+		c.Header("Location", statusURL)
+		body := &Body[JobAccepted]{
+			Code:    CodeAccepted,
+			Message: code2MessageM[CodeAccepted],
+			Data:    JobAccepted{ID: job.ID, StatusURL: statusURL},
+		}
+		c.PureJSON(http.StatusAccepted, body)
+		return EmptyResponse, nil
+	})
+
+	return func() (*openapi.Model, *openapi.Model, map[string]openapi.QueryParam, map[string]openapi.PathParam, map[string]openapi.HeaderParam, map[string]openapi.HeaderParam, gin.HandlerFunc) {
+		// 响应为 202，文档由 Async 补充
+		requestBody, _, query, params, requestHeader, _, handlerFunc := generator()
+		return requestBody, nil, query, params, requestHeader, nil, handlerFunc
+	}
+}
+
+func (h *AsyncHandler[RequestT, ResponseT]) stateHandler() handlerGenerator {
+	type stateRequest struct {
+		ID string `uri:"id"`
+	}
+	return NewHandler(func(c *gin.Context, req stateRequest) (JobState[ResponseT], error) {
+		ctx := c.Request.Context()
+		job, err := h.options.Store.Get(ctx, req.ID)
+		if err != nil {
+			logger.WithError(err).Errorf(ctx, "failed to get job %s", req.ID)
+			return JobState[ResponseT]{}, ErrorWithInternalServer()
+		}
+		if job == nil {
+			return JobState[ResponseT]{}, NewError(CodeNotFound, fmt.Sprintf("job %s not found", req.ID)).WithStatus(http.StatusNotFound)
+		}
+
+		state := JobState[ResponseT]{
+			ID:        job.ID,
+			Status:    job.Status,
+			Progress:  job.Progress,
+			Message:   job.Message,
+			CreatedAt: job.CreatedAt,
+			UpdatedAt: job.UpdatedAt,
+		}
+		if len(job.Result) > 0 {
+			state.Result = &Body[ResponseT]{}
+			if err = json.Unmarshal(job.Result, state.Result); err != nil {
+				logger.WithError(err).Errorf(ctx, "failed to unmarshal job %s result", req.ID)
+				return JobState[ResponseT]{}, ErrorWithInternalServer()
+			}
+		}
+		return state, nil
+	})
+}
+
+func (h *AsyncHandler[RequestT, ResponseT]) submit(ctx context.Context, req RequestT) (*Job, error) {
+	now := time.Now()
+	job := &Job{ID: requestid.New(), Status: JobStatusPending, CreatedAt: now, UpdatedAt: now}
+
+	if h.options.Publisher == nil {
+		if err := h.options.Store.Save(ctx, job); err != nil {
+			return nil, err
+		}
+		if err := h.enqueue(context.WithoutCancel(ctx), job.ID, req); err != nil {
+			h.finish(ctx, &claimedJob{job: *job}, nil, err)
+			return nil, errors.Wrapf(err, "enqueue job %s err", job.ID)
+		}
+		return job, nil
+	}
+
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal job request err")
+	}
+	job.Request = request
+	if err = h.options.Store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	properties := map[string]string{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(properties))
+	err = h.options.Publisher.Send(ctx, pubsub.ProducerMessage{Payload: []byte(job.ID), Properties: properties})
+	if err != nil {
+		return nil, errors.Wrapf(err, "publish job %s err", job.ID)
+	}
+	return job, nil
+}
+
+// enqueue 交给当前进程的 worker 执行，等待执行的任务超过 QueueSize 时返回错误
+func (h *AsyncHandler[RequestT, ResponseT]) enqueue(ctx context.Context, id string, req RequestT) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return errAsyncClosed
+	}
+	if h.queue == nil {
+		h.queue = make(chan func(), h.options.QueueSize)
+		for i := 0; i < h.options.Workers; i++ {
+			h.workers.Add(1)
+			go func() {
+				defer h.workers.Done()
+				for task := range h.queue {
+					task()
+				}
+			}()
+		}
+	}
+
+	select {
+	case h.queue <- func() {
+		if claimed := h.claim(ctx, id); claimed != nil {
+			h.run(ctx, claimed, req)
+		}
+	}:
+		return nil
+	default:
+		return errJobQueueFull
+	}
+}
+
+// Close 不再接收新的任务并等待当前进程中已经提交的任务执行完成，ctx 结束时未执行的任务仍为 pending
+func (h *AsyncHandler[RequestT, ResponseT]) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		if h.queue != nil {
+			close(h.queue)
+		}
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "wait async jobs err")
+	}
+}
+
+// asyncRegistry 通过 Async 注册的异步路由，服务关闭时等待任务执行完成
+type asyncRegistry struct {
+	mu     sync.Mutex
+	routes []AsyncRoute
+}
+
+func (registry *asyncRegistry) add(route AsyncRoute) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.routes = append(registry.routes, route)
+}
+
+func (registry *asyncRegistry) Close(ctx context.Context) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, route := range registry.routes {
+		if err := route.Close(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Work 从队列中接收任务并执行，用于在其他进程中执行任务，阻塞直到 ctx 取消或 subscriber 关闭。
+// 任务通过 JobStore.Claim 领取，重复投递或多个 worker 收到同一个任务时只执行一次
+func (h *AsyncHandler[RequestT, ResponseT]) Work(ctx context.Context, subscriber pubsub.Subscriber) error {
+	return subscriber.Receive(ctx, func(ctx context.Context, message pubsub.ConsumerMessage) error {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(message.Properties()))
+		id := string(message.Payload())
+		job, err := h.options.Store.Claim(ctx, id)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			logger.Warnf(ctx, "skip job %s, not found or already claimed", id)
+			return message.Ack()
+		}
+
+		claimed := &claimedJob{job: *job}
+		req := new(RequestT)
+		if err = json.Unmarshal(job.Request, req); err != nil {
+			h.finish(ctx, claimed, nil, errors.Wrapf(err, "unmarshal job %s request err", id))
+			return message.Ack()
+		}
+		h.run(ctx, claimed, *req)
+		return message.Ack()
+	})
+}
+
+// claim 领取当前进程提交的任务
+func (h *AsyncHandler[RequestT, ResponseT]) claim(ctx context.Context, id string) *claimedJob {
+	job, err := h.options.Store.Claim(ctx, id)
+	if err != nil {
+		logger.WithError(err).Errorf(ctx, "failed to claim job %s", id)
+		return nil
+	}
+	if job == nil {
+		logger.Warnf(ctx, "skip job %s, not found or already claimed", id)
+		return nil
+	}
+	return &claimedJob{job: *job}
+}
+
+func (h *AsyncHandler[RequestT, ResponseT]) run(ctx context.Context, claimed *claimedJob, req RequestT) {
+	if h.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.options.Timeout)
+		defer cancel()
+	}
+
+	var resp ResponseT
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = errors.Errorf("panic: %v", r)
+				logger.WithFields(map[string]interface{}{
+					"panic": fmt.Sprintf("%v", r),
+					"stack": PanicStack(),
+				}).Errorf(ctx, "job %s panic: %v", claimed.job.ID, r)
+			}
+		}()
+		resp, err = h.handler(ctx, req, func(progress float64, message string) {
+			h.update(ctx, claimed, func(job *Job) {
+				job.Progress = min(max(progress, 0), 1)
+				job.Message = message
+			})
+		})
+	}()
+	h.finish(ctx, claimed, &resp, err)
+}
+
+// finish 与 NewHandler 一致，非 *Err 的错误响应 ErrorWithInternalServer
+func (h *AsyncHandler[RequestT, ResponseT]) finish(ctx context.Context, claimed *claimedJob, resp *ResponseT, err error) {
+	id := claimed.job.ID
+	status := JobStatusSucceeded
+	body := &Body[ResponseT]{Code: CodeOK}
+	if err != nil {
+		logger.WithError(err).Errorf(ctx, "job %s failed", id)
+		var errx *Err
+		if !errors.As(err, &errx) {
+			errx = ErrorWithInternalServer()
+		}
+		body.WithErr(errx)
+		status = JobStatusFailed
+	} else {
+		body.Data = *resp
+	}
+
+	result, merr := json.Marshal(body)
+	if merr != nil {
+		logger.WithError(merr).Errorf(ctx, "failed to marshal job %s result", id)
+		result, _ = json.Marshal(new(Body[EmptyType]).WithErr(ErrorWithInternalServer()))
+		status = JobStatusFailed
+	}
+	h.update(ctx, claimed, func(job *Job) {
+		job.Status = status
+		if status == JobStatusSucceeded {
+			job.Progress = 1
+		}
+		job.Result = result
+	})
+}
+
+// update 修改并保存任务的副本，处理函数可能在多个 goroutine 中报告进度，任务结束后不再更新
+func (h *AsyncHandler[RequestT, ResponseT]) update(ctx context.Context, claimed *claimedJob, fn func(job *Job)) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+	if claimed.job.Status.Done() {
+		return
+	}
+	fn(&claimed.job)
+	claimed.job.UpdatedAt = time.Now()
+	job := claimed.job
+	// 任务结束后 ctx 可能已经超时，保存状态不受影响
+	if err := h.options.Store.Save(context.WithoutCancel(ctx), &job); err != nil {
+		logger.WithError(err).Errorf(ctx, "failed to save job %s", job.ID)
+	}
+}
+
+// claimedJob 当前进程领取的任务
+type claimedJob struct {
+	mu  sync.Mutex
+	job Job
+}
@@ -0,0 +1,316 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+type BatchOptions struct {
+	// Path 批量接口的路由，默认 /batch
+	Path string
+	// MaxRequests 一次批量请求最多包含的子请求数，超出时返回 413
+	MaxRequests int
+	// Concurrency 同时执行的子请求数
+	Concurrency int
+	// MaxResponseBytes 子请求的响应在内存中保存的最大字节数，超出时该子请求的结果为 502，默认 1MB
+	MaxResponseBytes int
+	// Middlewares 批量接口的中间件，子请求仍然经过各自路由的完整中间件
+	Middlewares []gin.HandlerFunc
+}
+
+type BatchOption func(*BatchOptions)
+
+func mergeBatchOptions(opts ...BatchOption) *BatchOptions {
+	opt := &BatchOptions{
+		Path:             "/batch",
+		MaxRequests:      20,
+		Concurrency:      5,
+		MaxResponseBytes: 1 << 20,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.MaxRequests <= 0 {
+		opt.MaxRequests = 20
+	}
+	if opt.MaxResponseBytes <= 0 {
+		opt.MaxResponseBytes = 1 << 20
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = 1
+	}
+	return opt
+}
+
+func WithBatchPath(path string) BatchOption {
+	return func(o *BatchOptions) {
+		o.Path = path
+	}
+}
+
+func WithBatchMaxRequests(max int) BatchOption {
+	return func(o *BatchOptions) {
+		o.MaxRequests = max
+	}
+}
+
+// WithBatchConcurrency 同时执行的子请求数，开启准入控制时子请求同样占用并发
+func WithBatchConcurrency(concurrency int) BatchOption {
+	return func(o *BatchOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithBatchMaxResponseBytes 子请求的响应最多保存 max 字节，避免下载等大响应占用内存
+func WithBatchMaxResponseBytes(max int) BatchOption {
+	return func(o *BatchOptions) {
+		o.MaxResponseBytes = max
+	}
+}
+
+func WithBatchMiddlewares(middlewares ...gin.HandlerFunc) BatchOption {
+	return func(o *BatchOptions) {
+		o.Middlewares = append(o.Middlewares, middlewares...)
+	}
+}
+
+// BatchRequest 批量接口中的一个子请求
+type BatchRequest struct {
+	// Method 默认为 GET
+	Method string `json:"method"`
+	// Path 路由路径，可以包含查询参数，例如 /users/1?fields=name
+	Path  string            `json:"path"`
+	Query map[string]string `json:"query"`
+	// Headers 覆盖批量请求的 header，未指定的 header 与批量请求一致，例如 Authorization
+	Headers map[string]string `json:"headers"`
+	// Body 以 application/json 发送
+	Body json.RawMessage `json:"body"`
+}
+
+// BatchResult 子请求的结果，Status 为子请求的状态码，响应不是 Body 时 data 为原始的响应
+type BatchResult struct {
+	Status int `json:"status"`
+	Body[json.RawMessage]
+}
+
+// batchContextKey 标记子请求，子请求不能再调用批量接口
+type batchContextKey struct{}
+
+// skipBatchHeaders 不传递给子请求的 header，trace 由子请求的 context 重新注入
+var skipBatchHeaders = []string{"Content-Length", "Content-Type", "Accept-Encoding", "Connection", "Traceparent", "Tracestate", "Baggage"}
+
+// registerBatch 注册批量接口，子请求通过 engine 分发，经过各自路由的中间件并有独立的 span
+func registerBatch(engine *gin.Engine, opts ...BatchOption) {
+	options := mergeBatchOptions(opts...)
+	handlers := append(append([]gin.HandlerFunc{}, options.Middlewares...), func(c *gin.Context) {
+		if c.Request.Context().Value(batchContextKey{}) != nil {
+			body := &Body[EmptyType]{}
+			body.WithErr(NewError(CodeBadRequest, "nested batch request is not allowed").WithStatus(http.StatusBadRequest))
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+
+		requests := make([]BatchRequest, 0)
+		if err := c.ShouldBindJSON(&requests); err != nil {
+			body := &Body[EmptyType]{}
+			body.WithErr(NewError(CodeBadRequest, err.Error()).WithStatus(http.StatusBadRequest))
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+		if len(requests) > options.MaxRequests {
+			body := &Body[EmptyType]{}
+			body.WithErr(NewError(CodeRequestEntityTooLarge,
+				fmt.Sprintf("batch contains %d requests, limit: %d", len(requests), options.MaxRequests)).WithStatus(http.StatusRequestEntityTooLarge))
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+
+		results := make([]BatchResult, len(requests))
+		semaphore := make(chan struct{}, options.Concurrency)
+		wg := sync.WaitGroup{}
+		for i, request := range requests {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(i int, request BatchRequest) {
+				defer func() {
+					if r := recover(); r != nil {
+						logger.Errorf(c.Request.Context(), "batch request %s %s panic: %v", request.Method, request.Path, r)
+						results[i] = batchErrResult(ErrorWithInternalServer())
+					}
+					<-semaphore
+					wg.Done()
+				}()
+				results[i] = dispatchBatch(c, engine, request, options.MaxResponseBytes)
+			}(i, request)
+		}
+		wg.Wait()
+
+		c.PureJSON(http.StatusOK, &Body[[]BatchResult]{Data: results})
+	})
+	engine.POST(options.Path, handlers...)
+}
+
+// dispatchBatch 构造子请求并交给 engine 处理，子请求的 context 继承批量请求，span 为批量请求 span 的子 span
+func dispatchBatch(c *gin.Context, engine *gin.Engine, request BatchRequest, maxResponseBytes int) BatchResult {
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	target, err := url.ParseRequestURI(request.Path)
+	if err != nil || !strings.HasPrefix(target.Path, "/") || target.Host != "" {
+		return batchErrResult(NewError(CodeBadRequest, fmt.Sprintf("invalid path %q", request.Path)).WithStatus(http.StatusBadRequest))
+	}
+	if len(request.Query) > 0 {
+		query := target.Query()
+		for key, value := range request.Query {
+			query.Set(key, value)
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	ctx := context.WithValue(c.Request.Context(), batchContextKey{}, struct{}{})
+	var body io.Reader = http.NoBody
+	hasBody := len(request.Body) > 0 && string(request.Body) != "null"
+	if hasBody {
+		body = bytes.NewReader(request.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.RequestURI(), body)
+	if err != nil {
+		return batchErrResult(NewError(CodeBadRequest, err.Error()).WithStatus(http.StatusBadRequest))
+	}
+	req.RequestURI = target.RequestURI()
+	req.Host = c.Request.Host
+	req.RemoteAddr = c.Request.RemoteAddr
+	req.Header = c.Request.Header.Clone()
+	for _, header := range skipBatchHeaders {
+		req.Header.Del(header)
+	}
+	if hasBody {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range request.Headers {
+		req.Header.Set(key, value)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	writer := &batchResponseWriter{header: http.Header{}, limit: maxResponseBytes}
+	engine.ServeHTTP(writer, req)
+	if writer.exceeded {
+		logger.Warnf(ctx, "response of batch request %s %s exceeds %d bytes", method, request.Path, maxResponseBytes)
+		return batchErrResult(NewError(CodeBadGateway, fmt.Sprintf("response exceeds %d bytes", maxResponseBytes)).WithStatus(http.StatusBadGateway))
+	}
+	return batchResult(writer)
+}
+
+func batchErrResult(err *Err) BatchResult {
+	result := BatchResult{Status: err.Status}
+	result.WithErr(err)
+	return result
+}
+
+// batchResult 子请求的响应为 Body 时直接使用，否则按状态码生成 code，响应放在 data 中
+func batchResult(writer *batchResponseWriter) BatchResult {
+	status := writer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	result := BatchResult{Status: status}
+	data := writer.body.Bytes()
+	isJSON := strings.Contains(writer.header.Get("Content-Type"), "json") && json.Valid(data)
+
+	if isJSON {
+		body := struct {
+			Code    *Code           `json:"code"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}{}
+		if err := json.Unmarshal(data, &body); err == nil && body.Code != nil {
+			result.Code, result.Message, result.Data = *body.Code, body.Message, body.Data
+			return result
+		}
+	}
+
+	if status >= http.StatusBadRequest {
+		result.Code = statusToCode(status)
+		result.Message = http.StatusText(status)
+	}
+	switch {
+	case isJSON:
+		result.Data = append(json.RawMessage{}, data...)
+	case len(data) > 0:
+		result.Data, _ = json.Marshal(string(data))
+	}
+	return result
+}
+
+func statusToCode(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return CodeNotFound
+	case http.StatusRequestEntityTooLarge:
+		return CodeRequestEntityTooLarge
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	case http.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return CodeTimeout
+	}
+	return CodeInternalServerError
+}
+
+// batchResponseWriter 在内存中保存子请求的响应，超过 limit 时丢弃已保存的响应并标记 exceeded
+type batchResponseWriter struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	// 返回成功避免 handler 因写入失败而 panic，结果在 dispatchBatch 中替换为 502
+	if w.exceeded || w.body.Len()+len(data) > w.limit {
+		w.exceeded = true
+		w.body.Reset()
+		return len(data), nil
+	}
+	return w.body.Write(data)
+}
+
+// Flush 子请求的响应在结束后一起返回，流式响应不会提前发送
+func (w *batchResponseWriter) Flush() {}
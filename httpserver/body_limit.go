@@ -0,0 +1,78 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxBodyBytes 建议的请求体大小限制，服务默认不限制，通过 WithServerMaxBodyBytes 开启
+const DefaultMaxBodyBytes int64 = 32 << 20
+
+// bodyLimits 服务默认与各路由的请求体大小限制，key 为 "METHOD /path/:id"
+type bodyLimits struct {
+	defaultLimit int64
+	routes       sync.Map
+}
+
+func newBodyLimits(defaultLimit int64) *bodyLimits {
+	return &bodyLimits{defaultLimit: defaultLimit}
+}
+
+func (l *bodyLimits) set(method, path string, limit int64) {
+	if limit != 0 {
+		l.routes.Store(method+" "+path, limit)
+	}
+}
+
+// limit 路由的限制，小于等于 0 表示不限制
+func (l *bodyLimits) limit(method, path string) int64 {
+	if limit, ok := l.routes.Load(method + " " + path); ok {
+		return limit.(int64)
+	}
+	return l.defaultLimit
+}
+
+// effective 路由注册时的限制，routeLimit 为 0 时使用服务默认值
+func (l *bodyLimits) effective(routeLimit int64) int64 {
+	if routeLimit != 0 {
+		return routeLimit
+	}
+	return l.defaultLimit
+}
+
+// Middleware 在路由匹配后按路由的限制包装请求体，超出限制时返回 413
+func (l *bodyLimits) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := l.limit(c.Request.Method, c.FullPath())
+		if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			body := &Body[EmptyType]{}
+			body.WithErr(ErrorWithRequestEntityTooLarge(limit))
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// formatBytes 文档中展示的大小
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
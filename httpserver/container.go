@@ -0,0 +1,283 @@
+package httpserver
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+type Lifetime int
+
+const (
+	// LifetimeSingleton 整个服务共享一个实例，第一次使用时创建，服务关闭时清理
+	LifetimeSingleton Lifetime = iota
+	// LifetimeRequest 每个请求创建一个实例，请求结束时清理
+	LifetimeRequest
+)
+
+const (
+	containerKey = "olympus_container"
+	scopeKey     = "olympus_container_scope"
+)
+
+// ProviderFunc 创建依赖实例，cleanup 可以为 nil
+type ProviderFunc[T any] func(c *gin.Context) (value T, cleanup func(), err error)
+
+// Container 简单的依赖注入容器，通过 Provide 注册，通过 Resolve 或 NewHandlerWithDeps 获取
+type Container struct {
+	mu        sync.RWMutex
+	providers map[reflect.Type]*provider
+}
+
+type provider struct {
+	lifetime Lifetime
+	create   func(c *gin.Context) (any, func(), error)
+
+	// singleton
+	mu      sync.Mutex
+	created bool
+	value   any
+	cleanup func()
+}
+
+// requestScope 单个请求内的依赖缓存
+type requestScope struct {
+	mu        sync.Mutex
+	values    map[reflect.Type]any
+	cleanups  []func()
+	resolving map[reflect.Type]bool
+}
+
+func NewContainer() *Container {
+	return &Container{
+		providers: make(map[reflect.Type]*provider),
+	}
+}
+
+// Provide 注册依赖，同一类型重复注册时后者覆盖前者
+func Provide[T any](container *Container, lifetime Lifetime, fn func(c *gin.Context) (T, error)) {
+	ProvideWithCleanup(container, lifetime, func(c *gin.Context) (T, func(), error) {
+		value, err := fn(c)
+		return value, nil, err
+	})
+}
+
+// ProvideValue 注册已经创建好的单例
+func ProvideValue[T any](container *Container, value T) {
+	Provide(container, LifetimeSingleton, func(c *gin.Context) (T, error) {
+		return value, nil
+	})
+}
+
+// ProvideWithCleanup 注册带清理函数的依赖，例如请求结束时需要归还的连接
+func ProvideWithCleanup[T any](container *Container, lifetime Lifetime, fn ProviderFunc[T]) {
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	container.providers[reflect.TypeFor[T]()] = &provider{
+		lifetime: lifetime,
+		create: func(c *gin.Context) (any, func(), error) {
+			return fn(c)
+		},
+	}
+}
+
+// Resolve 在 handler 或中间件中获取依赖
+// 如果 T 没有注册但是结构体(或结构体指针)，会按字段类型逐个注入，带 inject:"-" tag 的字段会被跳过
+func Resolve[T any](c *gin.Context) (T, error) {
+	var zero T
+	value, err := resolve(c, reflect.TypeFor[T]())
+	if err != nil {
+		return zero, err
+	}
+	// 接口类型的依赖为 nil 时 Interface() 返回 nil，断言会失败，直接返回零值
+	v, _ := value.Interface().(T)
+	return v, nil
+}
+
+// MustResolve 与 Resolve 相同，获取失败时 panic
+func MustResolve[T any](c *gin.Context) T {
+	value, err := Resolve[T](c)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Close 清理所有已经创建的单例
+func (container *Container) Close(ctx context.Context) error {
+	container.mu.RLock()
+	defer container.mu.RUnlock()
+
+	for _, p := range container.providers {
+		p.mu.Lock()
+		if p.created && p.cleanup != nil {
+			p.cleanup()
+		}
+		p.created, p.value, p.cleanup = false, nil, nil
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// Middleware 将容器注入到请求上下文，并在请求结束时清理请求级别的依赖
+func (container *Container) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := &requestScope{
+			values:    make(map[reflect.Type]any),
+			resolving: make(map[reflect.Type]bool),
+		}
+		c.Set(containerKey, container)
+		c.Set(scopeKey, scope)
+
+		defer func() {
+			scope.mu.Lock()
+			cleanups := scope.cleanups
+			scope.cleanups = nil
+			scope.mu.Unlock()
+
+			for i := len(cleanups) - 1; i >= 0; i-- {
+				cleanups[i]()
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func (container *Container) provider(t reflect.Type) (*provider, bool) {
+	container.mu.RLock()
+	defer container.mu.RUnlock()
+	p, ok := container.providers[t]
+	return p, ok
+}
+
+func resolve(c *gin.Context, t reflect.Type) (reflect.Value, error) {
+	container, ok := c.Value(containerKey).(*Container)
+	if !ok {
+		return reflect.Value{}, errors.New("container not found in context, make sure the request is served by httpserver")
+	}
+	scope, ok := c.Value(scopeKey).(*requestScope)
+	if !ok {
+		return reflect.Value{}, errors.New("container scope not found in context")
+	}
+
+	scope.mu.Lock()
+	if scope.resolving[t] {
+		scope.mu.Unlock()
+		return reflect.Value{}, errors.Errorf("circular dependency detected when resolving %s", t)
+	}
+	if value, ok := scope.values[t]; ok {
+		scope.mu.Unlock()
+		return valueOf(t, value), nil
+	}
+	scope.resolving[t] = true
+	scope.mu.Unlock()
+
+	defer func() {
+		scope.mu.Lock()
+		delete(scope.resolving, t)
+		scope.mu.Unlock()
+	}()
+
+	p, ok := container.provider(t)
+	if !ok {
+		return resolveStruct(c, t)
+	}
+
+	var (
+		value any
+		err   error
+	)
+	switch p.lifetime {
+	case LifetimeSingleton:
+		value, err = p.singleton(c)
+	default:
+		var cleanup func()
+		value, cleanup, err = p.create(c)
+		if err == nil {
+			scope.mu.Lock()
+			scope.values[t] = value
+			if cleanup != nil {
+				scope.cleanups = append(scope.cleanups, cleanup)
+			}
+			scope.mu.Unlock()
+		}
+	}
+	if err != nil {
+		return reflect.Value{}, errors.Wrapf(err, "provide %s err", t)
+	}
+
+	return valueOf(t, value), nil
+}
+
+func valueOf(t reflect.Type, value any) reflect.Value {
+	if value == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(value)
+}
+
+func (p *provider) singleton(c *gin.Context) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.created {
+		return p.value, nil
+	}
+
+	value, cleanup, err := p.create(c)
+	if err != nil {
+		return nil, err
+	}
+	p.created, p.value, p.cleanup = true, value, cleanup
+	return value, nil
+}
+
+// resolveStruct 未注册的结构体按字段注入
+func resolveStruct(c *gin.Context, t reflect.Type) (reflect.Value, error) {
+	structType := t
+	if t.Kind() == reflect.Ptr {
+		structType = t.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return reflect.Value{}, errors.Errorf("no provider registered for %s", t)
+	}
+
+	ptr := reflect.New(structType)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() || field.Tag.Get("inject") == "-" {
+			continue
+		}
+		value, err := resolve(c, field.Type)
+		if err != nil {
+			return reflect.Value{}, errors.Wrapf(err, "inject field %s of %s err", field.Name, structType)
+		}
+		ptr.Elem().Field(i).Set(value)
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return ptr, nil
+	}
+	return ptr.Elem(), nil
+}
+
+// NewHandlerWithDeps 与 NewHandler 相同，额外注入 DepsT 类型的依赖
+// DepsT 可以是注册过的类型，也可以是字段均为注册类型的结构体
+func NewHandlerWithDeps[RequestT any, ResponseT any, DepsT any](handler func(c *gin.Context, req RequestT, deps DepsT) (ResponseT, error)) handlerGenerator {
+	return NewHandler(func(c *gin.Context, req RequestT) (ResponseT, error) {
+		deps, err := Resolve[DepsT](c)
+		if err != nil {
+			logger.WithError(err).Errorf(c.Request.Context(), "failed to resolve dependencies, uri: %s", c.Request.RequestURI)
+			var resp ResponseT
+			return resp, err
+		}
+		return handler(c, req, deps)
+	})
+}
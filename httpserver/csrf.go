@@ -0,0 +1,146 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+const (
+	csrfContextKey = "httpserver.csrf"
+	// csrfSessionKey 使用 Sessions 中间件时 token 保存在会话中的 key
+	csrfSessionKey = "_csrf"
+)
+
+type CSRFOptions struct {
+	// CookieName 保存 token 的 cookie，前端读取后通过 HeaderName 提交，默认 csrf_token
+	CookieName string
+	// HeaderName 提交 token 的 header，默认 X-CSRF-Token
+	HeaderName string
+	// FormField header 为空时从表单中读取 token，默认 _csrf
+	FormField string
+	Path      string
+	Domain    string
+	Secure    bool
+	// Skip 返回 true 时不校验，例如使用 token 认证的接口
+	Skip func(c *gin.Context) bool
+}
+
+type CSRFOption func(*CSRFOptions)
+
+func mergeCSRFOptions(opts ...CSRFOption) *CSRFOptions {
+	opt := &CSRFOptions{
+		CookieName: "csrf_token",
+		HeaderName: "X-CSRF-Token",
+		FormField:  "_csrf",
+		Path:       "/",
+		Secure:     true,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithCSRFCookie(name, path, domain string, secure bool) CSRFOption {
+	return func(o *CSRFOptions) {
+		o.CookieName = name
+		o.Path = path
+		o.Domain = domain
+		o.Secure = secure
+	}
+}
+
+func WithCSRFHeader(header string) CSRFOption {
+	return func(o *CSRFOptions) {
+		o.HeaderName = header
+	}
+}
+
+func WithCSRFFormField(field string) CSRFOption {
+	return func(o *CSRFOptions) {
+		o.FormField = field
+	}
+}
+
+func WithCSRFSkip(skip func(c *gin.Context) bool) CSRFOption {
+	return func(o *CSRFOptions) {
+		o.Skip = skip
+	}
+}
+
+// CSRF double submit cookie 防护，通过 Router.Use 对需要的分组开启，
+// GET、HEAD、OPTIONS、TRACE 以外的请求需要通过 header 或表单提交与 cookie 一致的 token，否则返回 403；
+// 在 Sessions 之后使用时 token 同时保存在会话中，防止子域名写入 cookie 绕过校验
+func CSRF(opts ...CSRFOption) gin.HandlerFunc {
+	options := mergeCSRFOptions(opts...)
+	return func(c *gin.Context) {
+		if options.Skip != nil && options.Skip(c) {
+			c.Next()
+			return
+		}
+
+		cookieToken, _ := c.Cookie(options.CookieName)
+		token := cookieToken
+		session := SessionFromContext(c)
+		if session != nil {
+			token = ""
+			if _, err := session.Get(csrfSessionKey, &token); err != nil {
+				logger.WithError(err).Warn(c.Request.Context(), "get csrf token from session failed")
+			}
+		}
+
+		if !csrfSafeMethod(c.Request.Method) {
+			submitted := c.GetHeader(options.HeaderName)
+			if submitted == "" && options.FormField != "" {
+				submitted = c.PostForm(options.FormField)
+			}
+			if token == "" || !csrfTokenEqual(submitted, token) || !csrfTokenEqual(cookieToken, token) {
+				body := &Body[EmptyType]{}
+				body.WithErr(NewError(CodeForbidden, "invalid csrf token").WithStatus(http.StatusForbidden))
+				c.AbortWithStatusJSON(body.status, body)
+				return
+			}
+		}
+
+		if token == "" {
+			token = newSessionID()
+			if session != nil {
+				_ = session.Set(csrfSessionKey, token)
+			}
+		}
+		if cookieToken != token {
+			// 前端需要读取 cookie，不能设置 HttpOnly
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     options.CookieName,
+				Value:    token,
+				Path:     options.Path,
+				Domain:   options.Domain,
+				Secure:   options.Secure,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		c.Set(csrfContextKey, token)
+		c.Next()
+	}
+}
+
+// CSRFToken 当前请求的 csrf token，用于渲染到表单中，没有使用 CSRF 中间件时返回空字符串
+func CSRFToken(c *gin.Context) string {
+	return c.GetString(csrfContextKey)
+}
+
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func csrfTokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,289 @@
+package httpserver
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/oss"
+)
+
+// Binary 文档中的二进制响应
+type Binary []byte
+
+var binaryType = reflect.TypeOf(Binary{})
+
+// binarySchema 注册到 openapi 的 KnownTypes
+func binarySchema() openapi3.Schema {
+	return *openapi3.NewStringSchema().WithFormat("binary")
+}
+
+// Download 下载处理函数的返回值，Reader 与 Object 二选一
+type Download struct {
+	// Reader 文件内容，实现 io.ReadSeeker 时支持多段 Range 与 If-Modified-Since
+	Reader io.Reader
+	// Object oss 中的对象，Size、ETag 等元数据为空时通过 StatObject 获取
+	Object *DownloadObject
+	// Filename 下载的文件名，ContentType 为空时根据扩展名推断
+	Filename    string
+	ContentType string
+	// Size 内容大小，未知时为 0，Reader 可 Seek 时自动计算
+	Size    int64
+	ETag    string
+	ModTime time.Time
+	// Inline 为 true 时浏览器直接展示，否则作为附件下载
+	Inline bool
+}
+
+// DownloadObject oss 中的对象
+type DownloadObject struct {
+	Client oss.Client
+	Key    string
+}
+
+type DownloadHandler[RequestT any] func(c *gin.Context, req RequestT) (*Download, error)
+
+// NewDownloadHandler 下载文件，支持 Content-Disposition、Range/206 与 ETag，文档中的响应为二进制
+// 处理函数返回错误时仍然响应 Body
+func NewDownloadHandler[RequestT any](handler DownloadHandler[RequestT]) handlerGenerator {
+	generator := NewHandler(func(c *gin.Context, req RequestT) (EmptyType, error) {
+		download, err := handler(c, req)
+		if err != nil {
+			return EmptyResponse, err
+		}
+		if err = serveDownload(c, download); err != nil && c.Writer.Written() {
+			// 已经开始响应内容，只能记录错误
+			logger.WithError(err).Errorf(c.Request.Context(), "failed to serve download, uri: %s", c.Request.RequestURI)
+		}
+		return EmptyResponse, err
+	})
+
+	return func() (*openapi.Model, *openapi.Model, map[string]openapi.QueryParam, map[string]openapi.PathParam, map[string]openapi.HeaderParam, map[string]openapi.HeaderParam, gin.HandlerFunc) {
+		requestBody, _, query, params, requestHeader, _, handlerFunc := generator()
+		responseBody := openapi.ModelFromType(binaryType)
+		responseHeader := map[string]openapi.HeaderParam{
+			"Content-Disposition": {Description: "attachment 或 inline，包含文件名", Type: openapi.PrimitiveTypeString},
+			"ETag":                {Description: "内容标识，可用于 If-None-Match 与 If-Range", Type: openapi.PrimitiveTypeString},
+			"Accept-Ranges":       {Description: "支持 Range 请求时为 bytes，响应 206 Partial Content", Type: openapi.PrimitiveTypeString},
+		}
+		return requestBody, &responseBody, query, params, requestHeader, responseHeader, handlerFunc
+	}
+}
+
+func serveDownload(c *gin.Context, download *Download) error {
+	if download == nil || (download.Reader == nil && download.Object == nil) {
+		return errors.New("download has no content")
+	}
+
+	reader := download.Reader
+	if download.Object != nil {
+		object, err := openDownloadObject(c, download)
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+		reader = object
+	} else if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	header := c.Writer.Header()
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(download.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", contentDisposition(download.Filename, download.Inline))
+	if download.ETag != "" {
+		header.Set("ETag", quoteETag(download.ETag))
+	}
+
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		// ServeContent 处理 Range、If-Range、If-None-Match 与 If-Modified-Since
+		http.ServeContent(c.Writer, c.Request, download.Filename, download.ModTime, seeker)
+		// 304 与 HEAD 没有响应体，gin 只记录了状态码
+		c.Writer.WriteHeaderNow()
+		return nil
+	}
+
+	return serveStream(c, reader, download)
+}
+
+// openDownloadObject 读取 oss 对象，并补全元数据
+func openDownloadObject(c *gin.Context, download *Download) (io.ReadCloser, error) {
+	ctx := c.Request.Context()
+	object := download.Object
+	if download.Size == 0 || download.ETag == "" || download.ContentType == "" {
+		info, err := object.Client.StatObject(ctx, object.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "stat object %s err", object.Key)
+		}
+		if download.Size == 0 {
+			download.Size = info.Size
+		}
+		if download.ETag == "" {
+			download.ETag = info.ETag
+		}
+		if download.ContentType == "" {
+			download.ContentType = info.ContentType
+		}
+		if download.ModTime.IsZero() {
+			download.ModTime = info.LastModified
+		}
+	}
+	if download.Filename == "" {
+		download.Filename = filepath.Base(object.Key)
+	}
+
+	reader, err := object.Client.GetObject(ctx, object.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get object %s err", object.Key)
+	}
+	return reader, nil
+}
+
+// serveStream 不可 Seek 的内容，只支持单段 Range
+func serveStream(c *gin.Context, reader io.Reader, download *Download) error {
+	header := c.Writer.Header()
+	etag := header.Get("ETag")
+	if !download.ModTime.IsZero() {
+		header.Set("Last-Modified", download.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	if etag != "" && etagMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return nil
+	}
+
+	status := http.StatusOK
+	start, length := int64(0), download.Size
+	if download.Size > 0 {
+		header.Set("Accept-Ranges", "bytes")
+		rangeHeader := c.GetHeader("Range")
+		ifRange := c.GetHeader("If-Range")
+		if rangeHeader != "" && (ifRange == "" || ifRange == etag) {
+			var ok bool
+			start, length, ok = parseSingleRange(rangeHeader, download.Size)
+			if !ok {
+				header.Del("Content-Disposition")
+				header.Set("Content-Range", fmt.Sprintf("bytes */%d", download.Size))
+				body := &Body[EmptyType]{}
+				body.WithErr(NewError(CodeBadRequest, "range not satisfiable").WithStatus(http.StatusRequestedRangeNotSatisfiable))
+				c.AbortWithStatusJSON(body.status, body)
+				return nil
+			}
+			if start != 0 || length != download.Size {
+				status = http.StatusPartialContent
+				header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, download.Size))
+			}
+		}
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+
+	c.Status(status)
+	c.Writer.WriteHeaderNow()
+	if c.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	if start > 0 {
+		if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+			return errors.Wrap(err, "skip to range start err")
+		}
+	}
+	if download.Size > 0 {
+		reader = io.LimitReader(reader, length)
+	}
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		return errors.Wrap(err, "write download content err")
+	}
+	return nil
+}
+
+// parseSingleRange 解析 bytes=start-end，多段 Range 时返回整个内容
+func parseSingleRange(value string, size int64) (start int64, length int64, ok bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(value), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if startStr == "" {
+		// bytes=-500 最后 500 字节
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true
+}
+
+func contentDisposition(filename string, inline bool) string {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	if filename == "" {
+		return disposition
+	}
+	// 非 ASCII 文件名会使用 RFC 2231 的 filename*=utf-8'' 格式
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return strconv.Quote(etag)
+}
+
+func etagMatch(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
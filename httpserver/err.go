@@ -24,6 +24,11 @@ const (
 	CodeNoContent
 	CodeResetContent
 	CodeAuthorizationFailed
+	CodeRequestEntityTooLarge
+	CodeBadGateway
+	CodeServiceUnavailable
+	CodeTenantUnresolved
+	CodeTooManyRequests
 )
 
 var code2MessageM = map[Code]string{
@@ -39,6 +44,12 @@ var code2MessageM = map[Code]string{
 	CodeNoContent:           "No Content",
 	CodeResetContent:        "Reset Content",
 	CodeValidateRuleFailed:  "Validate Rule Failed",
+
+	CodeRequestEntityTooLarge: "Request Entity Too Large",
+	CodeBadGateway:            "Bad Gateway",
+	CodeServiceUnavailable:    "Service Unavailable",
+	CodeTenantUnresolved:      "Tenant Unresolved",
+	CodeTooManyRequests:       "Too Many Requests",
 }
 
 type Err struct {
@@ -102,3 +113,48 @@ func ErrorWithAuthorizationFailed(reason string) *Err {
 		Err:    errors.New(reason),
 	}
 }
+
+// ErrorWithRequestEntityTooLarge 请求体超过 limit 字节
+func ErrorWithRequestEntityTooLarge(limit int64) *Err {
+	return &Err{
+		Status: http.StatusRequestEntityTooLarge,
+		Code:   CodeRequestEntityTooLarge,
+		Err:    errors.Errorf("%s, limit: %d bytes", code2MessageM[CodeRequestEntityTooLarge], limit),
+	}
+}
+
+// ErrorWithBadGateway 转发到 upstream 失败
+func ErrorWithBadGateway() *Err {
+	return &Err{
+		Status: http.StatusBadGateway,
+		Code:   CodeBadGateway,
+		Err:    errors.New(code2MessageM[CodeBadGateway]),
+	}
+}
+
+// ErrorWithServiceUnavailable 服务过载，请求被准入控制拒绝
+func ErrorWithServiceUnavailable() *Err {
+	return &Err{
+		Status: http.StatusServiceUnavailable,
+		Code:   CodeServiceUnavailable,
+		Err:    errors.New(code2MessageM[CodeServiceUnavailable]),
+	}
+}
+
+// ErrorWithTenantUnresolved 无法获取租户或租户不存在
+func ErrorWithTenantUnresolved(reason string) *Err {
+	return &Err{
+		Status: http.StatusBadRequest,
+		Code:   CodeTenantUnresolved,
+		Err:    errors.Errorf("%s: %s", code2MessageM[CodeTenantUnresolved], reason),
+	}
+}
+
+// ErrorWithTooManyRequests 请求超过限流
+func ErrorWithTooManyRequests() *Err {
+	return &Err{
+		Status: http.StatusTooManyRequests,
+		Code:   CodeTooManyRequests,
+		Err:    errors.New(code2MessageM[CodeTooManyRequests]),
+	}
+}
@@ -0,0 +1,332 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Filtering 过滤参数，嵌入到请求结构体中通过 NewHandler 绑定，多个 filter 参数之间为 and
+//
+//	?filter=status:eq:active&filter=or(age:gte:18,vip:eq:true)&filter=role:in:admin|owner
+//
+// 条件为 field:op:value，in、nin 的多个值以 | 分隔，值包含 , ) | 时可以使用双引号，例如 name:eq:"a,b"
+type Filtering struct {
+	Filter []string `form:"filter" description:"过滤条件 field:op:value，op 为 eq、ne、gt、gte、lt、lte、in、nin、like、null，支持 and(...)、or(...)、not(...)" example:"status:eq:active"`
+}
+
+// FilterOp 条件的操作符
+type FilterOp string
+
+const (
+	FilterOpEq   FilterOp = "eq"
+	FilterOpNe   FilterOp = "ne"
+	FilterOpGt   FilterOp = "gt"
+	FilterOpGte  FilterOp = "gte"
+	FilterOpLt   FilterOp = "lt"
+	FilterOpLte  FilterOp = "lte"
+	FilterOpIn   FilterOp = "in"
+	FilterOpNin  FilterOp = "nin"
+	FilterOpLike FilterOp = "like"
+	// FilterOpNull 值为 true 表示字段为空，false 表示不为空
+	FilterOpNull FilterOp = "null"
+)
+
+// FilterType 字段值的类型，解析时将值转换为对应的 Go 类型
+type FilterType int
+
+const (
+	// FilterString 值为 string
+	FilterString FilterType = iota
+	// FilterInt 值为 int64
+	FilterInt
+	// FilterFloat 值为 float64
+	FilterFloat
+	// FilterBool 值为 bool
+	FilterBool
+	// FilterTime 值为 time.Time，格式为 RFC3339
+	FilterTime
+)
+
+// FilterFields 允许过滤的字段与类型
+type FilterFields map[string]FilterType
+
+// FilterExpr 过滤条件的语法树，节点为 *FilterAnd、*FilterOr、*FilterNot、*FilterCondition，
+// 由 repository 通过 type switch 转换为 SQL、mongo 等查询条件
+type FilterExpr interface {
+	String() string
+}
+
+type FilterAnd struct {
+	Exprs []FilterExpr
+}
+
+type FilterOr struct {
+	Exprs []FilterExpr
+}
+
+type FilterNot struct {
+	Expr FilterExpr
+}
+
+// FilterCondition Value 为字段类型对应的值，in、nin 时为 Values
+type FilterCondition struct {
+	Field  string
+	Op     FilterOp
+	Value  any
+	Values []any
+}
+
+func (e *FilterAnd) String() string {
+	return "and(" + joinFilterExprs(e.Exprs) + ")"
+}
+
+func (e *FilterOr) String() string {
+	return "or(" + joinFilterExprs(e.Exprs) + ")"
+}
+
+func (e *FilterNot) String() string {
+	return "not(" + e.Expr.String() + ")"
+}
+
+func (e *FilterCondition) String() string {
+	if e.Op == FilterOpIn || e.Op == FilterOpNin {
+		values := make([]string, 0, len(e.Values))
+		for _, value := range e.Values {
+			values = append(values, formatFilterValue(value))
+		}
+		return e.Field + ":" + string(e.Op) + ":" + strings.Join(values, "|")
+	}
+	return e.Field + ":" + string(e.Op) + ":" + formatFilterValue(e.Value)
+}
+
+func joinFilterExprs(exprs []FilterExpr) string {
+	parts := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		parts = append(parts, expr.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFilterValue(value any) string {
+	var s string
+	switch v := value.(type) {
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if strings.ContainsAny(s, `,)|"`) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// maxFilterDepth and、or、not 嵌套的最大层数
+const maxFilterDepth = 8
+
+// Parse 解析过滤条件，没有条件时返回 nil，fields 为空时允许任意合法的字段名，值为 string；
+// 语法错误、不允许的字段、操作符与类型不匹配时返回 ErrorWithBadRequest
+func (f Filtering) Parse(fields FilterFields) (FilterExpr, error) {
+	exprs := make([]FilterExpr, 0, len(f.Filter))
+	for _, filter := range f.Filter {
+		if strings.TrimSpace(filter) == "" {
+			continue
+		}
+		p := &filterParser{input: filter, fields: fields}
+		list, err := p.parseList(0)
+		if err == nil && p.pos < len(p.input) {
+			err = p.errorf("unexpected %q", p.input[p.pos])
+		}
+		if err != nil {
+			return nil, NewError(CodeBadRequest, err.Error()).WithStatus(http.StatusBadRequest)
+		}
+		exprs = append(exprs, list...)
+	}
+
+	switch len(exprs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return exprs[0], nil
+	}
+	return &FilterAnd{Exprs: exprs}, nil
+}
+
+type filterParser struct {
+	input  string
+	pos    int
+	fields FilterFields
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	return errors.Errorf("invalid filter %q at %d: %s", p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+// parseList 以逗号分隔的多个表达式，遇到 ) 或结尾时结束
+func (p *filterParser) parseList(depth int) ([]FilterExpr, error) {
+	var exprs []FilterExpr
+	for {
+		expr, err := p.parseExpr(depth)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if p.pos >= len(p.input) || p.input[p.pos] != ',' {
+			return exprs, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *filterParser) parseExpr(depth int) (FilterExpr, error) {
+	if depth > maxFilterDepth {
+		return nil, p.errorf("nested too deep")
+	}
+	for _, group := range []string{"and(", "or(", "not("} {
+		if !strings.HasPrefix(p.input[p.pos:], group) {
+			continue
+		}
+		p.pos += len(group)
+		exprs, err := p.parseList(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		switch group {
+		case "and(":
+			return &FilterAnd{Exprs: exprs}, nil
+		case "or(":
+			return &FilterOr{Exprs: exprs}, nil
+		}
+		if len(exprs) != 1 {
+			return nil, p.errorf("not requires one expression")
+		}
+		return &FilterNot{Expr: exprs[0]}, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *filterParser) parseCondition() (*FilterCondition, error) {
+	start := p.pos
+	field, ok := p.readUntil(':')
+	if !ok || !fieldNameRegexp.MatchString(field) {
+		p.pos = start
+		return nil, p.errorf("invalid field %q", field)
+	}
+	fieldType := FilterString
+	if p.fields != nil {
+		if fieldType, ok = p.fields[field]; !ok {
+			p.pos = start
+			return nil, p.errorf("field %s is not filterable", field)
+		}
+	}
+	op, ok := p.readUntil(':')
+	if !ok {
+		return nil, p.errorf("missing value of %s", field)
+	}
+
+	condition := &FilterCondition{Field: field, Op: FilterOp(op)}
+	switch condition.Op {
+	case FilterOpIn, FilterOpNin:
+		for {
+			raw, err := p.readValue()
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.convert(field, fieldType, condition.Op, raw)
+			if err != nil {
+				return nil, err
+			}
+			condition.Values = append(condition.Values, value)
+			if p.pos >= len(p.input) || p.input[p.pos] != '|' {
+				return condition, nil
+			}
+			p.pos++
+		}
+	case FilterOpEq, FilterOpNe, FilterOpGt, FilterOpGte, FilterOpLt, FilterOpLte, FilterOpLike, FilterOpNull:
+		raw, err := p.readValue()
+		if err != nil {
+			return nil, err
+		}
+		condition.Value, err = p.convert(field, fieldType, condition.Op, raw)
+		if err != nil {
+			return nil, err
+		}
+		return condition, nil
+	}
+	return nil, p.errorf("unsupported op %s", op)
+}
+
+// readUntil 读取到 sep 为止，不包含 sep
+func (p *filterParser) readUntil(sep byte) (string, bool) {
+	index := strings.IndexByte(p.input[p.pos:], sep)
+	if index < 0 {
+		return "", false
+	}
+	s := p.input[p.pos : p.pos+index]
+	p.pos += index + 1
+	return s, true
+}
+
+// readValue 读取到 , ) | 或结尾，以双引号开始时按 Go 字符串解析
+func (p *filterParser) readValue() (string, error) {
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		prefix, err := strconv.QuotedPrefix(p.input[p.pos:])
+		if err != nil {
+			return "", p.errorf("invalid quoted value")
+		}
+		p.pos += len(prefix)
+		value, _ := strconv.Unquote(prefix)
+		return value, nil
+	}
+	end := strings.IndexAny(p.input[p.pos:], ",)|")
+	if end < 0 {
+		end = len(p.input) - p.pos
+	}
+	value := p.input[p.pos : p.pos+end]
+	p.pos += end
+	return value, nil
+}
+
+func (p *filterParser) convert(field string, fieldType FilterType, op FilterOp, raw string) (any, error) {
+	if op == FilterOpNull {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, p.errorf("value of %s:null must be true or false", field)
+		}
+		return value, nil
+	}
+	if op == FilterOpLike && fieldType != FilterString {
+		return nil, p.errorf("like is only supported by string field %s", field)
+	}
+
+	var value any
+	var err error
+	switch fieldType {
+	case FilterInt:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case FilterFloat:
+		value, err = strconv.ParseFloat(raw, 64)
+	case FilterBool:
+		if op != FilterOpEq && op != FilterOpNe {
+			return nil, p.errorf("%s is not supported by bool field %s", op, field)
+		}
+		value, err = strconv.ParseBool(raw)
+	case FilterTime:
+		value, err = time.Parse(time.RFC3339, raw)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, p.errorf("invalid value %q of %s", raw, field)
+	}
+	return value, nil
+}
@@ -0,0 +1,274 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+// GraphQLRequest 标准的 GraphQL over HTTP 请求
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLResponse 标准的 GraphQL 响应，不使用 Body 包装，客户端可以直接解析
+type GraphQLResponse struct {
+	Data       any            `json:"data,omitempty"`
+	Errors     []GraphQLError `json:"errors,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Locations  []GraphQLLocation `json:"locations,omitempty"`
+	Path       []any             `json:"path,omitempty"`
+	Extensions map[string]any    `json:"extensions,omitempty"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLExecutor 执行 GraphQL 请求，schema-first 与 code-first 的实现分别在
+// httpserver/graphql/schemafirst 与 httpserver/graphql/codefirst，按需引入对应的 GraphQL 引擎；
+// Execute 返回 nil 时按服务内部错误响应 500
+type GraphQLExecutor interface {
+	Execute(ctx context.Context, req GraphQLRequest) *GraphQLResponse
+}
+
+type GraphQLExecutorFunc func(ctx context.Context, req GraphQLRequest) *GraphQLResponse
+
+func (f GraphQLExecutorFunc) Execute(ctx context.Context, req GraphQLRequest) *GraphQLResponse {
+	return f(ctx, req)
+}
+
+type graphqlGinContextKey struct{}
+
+// GraphQLGinContext 在 resolver 中获取请求的 gin.Context，可用于读取鉴权信息或 Resolve 依赖
+func GraphQLGinContext(ctx context.Context) (*gin.Context, bool) {
+	c, ok := ctx.Value(graphqlGinContextKey{}).(*gin.Context)
+	return c, ok
+}
+
+// graphqlTracer 每次从全局获取，服务重新设置 TracerProvider 后仍然生效
+func graphqlTracer() trace.Tracer {
+	return otel.Tracer("github.com/ihezebin/olympus/httpserver/graphql")
+}
+
+// StartGraphQLFieldSpan 为 resolver 的字段创建 span，供 GraphQL 引擎的适配使用，
+// 例如 httpserver/graphql/schemafirst 与 httpserver/graphql/codefirst
+func StartGraphQLFieldSpan(ctx context.Context, typeName, fieldName string) (context.Context, trace.Span) {
+	return graphqlTracer().Start(ctx, "graphql.resolve "+typeName+"."+fieldName, trace.WithAttributes(
+		attribute.String("graphql.field.type", typeName),
+		attribute.String("graphql.field.name", fieldName),
+	))
+}
+
+// RecordGraphQLPanic resolver 的 panic 由 GraphQL 引擎恢复并转换为错误，这里记录日志并标记 span
+func RecordGraphQLPanic(ctx context.Context, value any) {
+	stack := PanicStack()
+	logger.WithFields(map[string]interface{}{
+		"panic": fmt.Sprintf("%v", value),
+		"stack": stack,
+	}).Errorf(ctx, "graphql resolver panic: %v", value)
+	span := trace.SpanFromContext(ctx)
+	span.SetStatus(codes.Error, fmt.Sprintf("panic: %v", value))
+	span.SetAttributes(attribute.String("exception.stacktrace", strings.Join(stack, "\n")))
+}
+
+type GraphQLOptions struct {
+	// Playground 是否在 RegisterOpenAPIUI 的路径下提供 GraphiQL 页面，默认 true
+	Playground bool
+	// PlaygroundAssets 自托管的 GraphiQL 静态资源，为 nil 时从 CDN 加载
+	PlaygroundAssets fs.FS
+	OpenAPIOptions   OpenAPIOptions
+}
+
+type GraphQLOption func(*GraphQLOptions)
+
+func mergeGraphQLOptions(opts ...GraphQLOption) *GraphQLOptions {
+	options := &GraphQLOptions{Playground: true}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+func WithGraphQLPlayground(enable bool) GraphQLOption {
+	return func(options *GraphQLOptions) {
+		options.Playground = enable
+	}
+}
+
+// WithGraphQLPlaygroundAssets 使用自托管的 GraphiQL 静态资源，需要包含 graphiql.min.css、graphiql.min.js、
+// react.production.min.js 与 react-dom.production.min.js，无法访问外网时通过业务自己 go:embed 的资源提供 playground
+func WithGraphQLPlaygroundAssets(assets fs.FS) GraphQLOption {
+	return func(options *GraphQLOptions) {
+		options.PlaygroundAssets = assets
+	}
+}
+
+func WithGraphQLOpenAPIOptions(opts ...OpenAPIOption) GraphQLOption {
+	return func(options *GraphQLOptions) {
+		options.OpenAPIOptions = append(options.OpenAPIOptions, opts...)
+	}
+}
+
+// GraphQL 在 router 的 path 注册 POST 的 GraphQL 接口，与普通路由一样应用分组的中间件、请求体限制与文档，
+// playground 在 RegisterOpenAPIUI 的路径加上 /graphql 与 path 下，例如 /openapi/graphql/api/graphql
+func GraphQL(router Router, path string, executor GraphQLExecutor, opts ...GraphQLOption) error {
+	r, err := openapiRouterOf(router)
+	if err != nil {
+		return err
+	}
+	options := mergeGraphQLOptions(opts...)
+	openapiOptions := append(OpenAPIOptions{WithOpenAPISummary("GraphQL")}, options.OpenAPIOptions...)
+	r.PostWithOptions(path, newGraphQLHandler(executor), WithOpenAPIOptions(openapiOptions...))
+
+	if options.Playground {
+		endpoint := r.mergePath("/", r.prefix, path)
+		if r.version != nil && r.version.options.Strategy&VersionStrategyPath != 0 {
+			endpoint = r.mergePath("/", r.versionParent.prefix, r.version.name, r.versionPath, path)
+		}
+		r.graphqls.add(graphqlPlayground{endpoint: endpoint, assets: options.PlaygroundAssets})
+	}
+	return nil
+}
+
+func newGraphQLHandler(executor GraphQLExecutor) handlerGenerator {
+	return func() (*openapi.Model, *openapi.Model, map[string]openapi.QueryParam, map[string]openapi.PathParam, map[string]openapi.HeaderParam, map[string]openapi.HeaderParam, gin.HandlerFunc) {
+		requestBody := openapi.ModelOf[GraphQLRequest]()
+		responseBody := openapi.ModelOf[GraphQLResponse]()
+		return &requestBody, &responseBody, nil, nil, nil, nil, func(c *gin.Context) {
+			ctx := c.Request.Context()
+
+			req := GraphQLRequest{}
+			var err error
+			if strings.HasPrefix(c.ContentType(), "application/graphql") {
+				var query []byte
+				query, err = io.ReadAll(c.Request.Body)
+				req.Query = string(query)
+			} else {
+				err = c.ShouldBindJSON(&req)
+			}
+			if err != nil || req.Query == "" {
+				if err == nil {
+					err = errors.New("query is required")
+				}
+				logger.WithError(err).Errorf(ctx, "failed to bind graphql request, uri: %s", c.Request.RequestURI)
+				errx := bindError(err, ErrorWithBadRequest())
+				c.AbortWithStatusJSON(errx.Status, &GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}})
+				return
+			}
+
+			if req.OperationName != "" {
+				trace.SpanFromContext(ctx).SetAttributes(attribute.String("graphql.operation.name", req.OperationName))
+			}
+			resp := executor.Execute(context.WithValue(ctx, graphqlGinContextKey{}, c), req)
+			if resp == nil {
+				logger.Errorf(ctx, "graphql executor returns nil response, operation: %s", req.OperationName)
+				errx := ErrorWithInternalServer()
+				c.AbortWithStatusJSON(errx.Status, &GraphQLResponse{Errors: []GraphQLError{{Message: errx.Error()}}})
+				return
+			}
+			if len(resp.Errors) > 0 {
+				logger.WithField("errors", resp.Errors).Warnf(ctx, "graphql operation has errors, operation: %s", req.OperationName)
+			}
+			c.JSON(http.StatusOK, resp)
+		}
+	}
+}
+
+type graphqlPlayground struct {
+	endpoint string
+	assets   fs.FS
+}
+
+// graphqlRegistry 需要提供 playground 的 GraphQL 接口
+type graphqlRegistry struct {
+	mu          sync.Mutex
+	playgrounds []graphqlPlayground
+}
+
+func (registry *graphqlRegistry) add(playground graphqlPlayground) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.playgrounds = append(registry.playgrounds, playground)
+}
+
+func (registry *graphqlRegistry) list() []graphqlPlayground {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]graphqlPlayground{}, registry.playgrounds...)
+}
+
+// GraphQLPlaygroundPath playground 页面的路由，自托管的静态资源挂载在该路由的 /assets 下
+func GraphQLPlaygroundPath(openapiUIPath string, endpoint string) string {
+	return strings.TrimRight(openapiUIPath, "/") + "/graphql" + endpoint
+}
+
+// graphiqlAssetFiles 自托管时静态资源中的文件与对应的 CDN 地址
+var graphiqlAssetFiles = map[string]string{
+	"{:graphiql.css}": "https://unpkg.com/graphiql@3/graphiql.min.css",
+	"{:react}":        "https://unpkg.com/react@18/umd/react.production.min.js",
+	"{:react-dom}":    "https://unpkg.com/react-dom@18/umd/react-dom.production.min.js",
+	"{:graphiql.js}":  "https://unpkg.com/graphiql@3/graphiql.min.js",
+}
+
+const graphiQLTemplate = `
+<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <title>{:title}</title>
+    <link rel="stylesheet" href="{:graphiql.css}" />
+  </head>
+  <style>
+    body { margin: 0; height: 100vh; }
+    #graphiql { height: 100vh; }
+  </style>
+  <body>
+    <div id="graphiql"></div>
+    <script crossorigin src="{:react}"></script>
+    <script crossorigin src="{:react-dom}"></script>
+    <script crossorigin src="{:graphiql.js}"></script>
+    <script>
+      const fetcher = GraphiQL.createFetcher({ url: {:endpoint} });
+      ReactDOM.createRoot(document.getElementById("graphiql")).render(React.createElement(GraphiQL, { fetcher }));
+    </script>
+  </body>
+</html>
+`
+
+// renderGraphiQL assetsURL 为空时从 CDN 加载，否则从 assetsURL 下加载 graphiql.min.css、
+// react.production.min.js、react-dom.production.min.js 与 graphiql.min.js
+func renderGraphiQL(title string, endpoint string, assetsURL string) string {
+	html := renderOpenAPIUI(graphiQLTemplate, title, "", "")
+	for placeholder, cdn := range graphiqlAssetFiles {
+		src := cdn
+		if assetsURL != "" {
+			src = strings.TrimRight(assetsURL, "/") + "/" + path.Base(cdn)
+		}
+		html = strings.ReplaceAll(html, placeholder, src)
+	}
+	return strings.ReplaceAll(html, "{:endpoint}", fmt.Sprintf("%q", endpoint))
+}
@@ -0,0 +1,76 @@
+// Package codefirst 基于 graphql-go/graphql 的 code-first GraphQL，通过 httpserver.GraphQL 注册
+//
+//	executor, err := codefirst.New(graphql.SchemaConfig{Query: queryType})
+//	httpserver.GraphQL(router, "/graphql", executor)
+package codefirst
+
+import (
+	"context"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/ihezebin/olympus/httpserver"
+)
+
+// New 通过 graphql-go 的类型定义 schema，每个设置了 Resolve 的字段记录一个 span
+func New(config graphql.SchemaConfig) (httpserver.GraphQLExecutor, error) {
+	schema, err := graphql.NewSchema(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "new graphql schema err")
+	}
+	for _, t := range schema.TypeMap() {
+		object, ok := t.(*graphql.Object)
+		if !ok || strings.HasPrefix(object.Name(), "__") {
+			continue
+		}
+		for _, field := range object.Fields() {
+			if field.Resolve != nil {
+				field.Resolve = traceResolve(object.Name(), field.Name, field.Resolve)
+			}
+		}
+	}
+
+	return httpserver.GraphQLExecutorFunc(func(ctx context.Context, req httpserver.GraphQLRequest) *httpserver.GraphQLResponse {
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        ctx,
+		})
+		resp := &httpserver.GraphQLResponse{Data: result.Data, Extensions: result.Extensions}
+		for _, formatted := range result.Errors {
+			graphqlErr := httpserver.GraphQLError{Message: formatted.Message, Path: formatted.Path, Extensions: formatted.Extensions}
+			for _, location := range formatted.Locations {
+				graphqlErr.Locations = append(graphqlErr.Locations, httpserver.GraphQLLocation{Line: location.Line, Column: location.Column})
+			}
+			resp.Errors = append(resp.Errors, graphqlErr)
+		}
+		return resp
+	}), nil
+}
+
+func traceResolve(typeName, fieldName string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (result any, err error) {
+		ctx, span := httpserver.StartGraphQLFieldSpan(p.Context, typeName, fieldName)
+		defer span.End()
+		defer func() {
+			if r := recover(); r != nil {
+				httpserver.RecordGraphQLPanic(ctx, r)
+				// graphql-go 会将 panic 转换为字段的错误
+				panic(r)
+			}
+		}()
+
+		p.Context = ctx
+		result, err = resolve(p)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return result, err
+	}
+}
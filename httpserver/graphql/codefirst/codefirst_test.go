@@ -0,0 +1,79 @@
+package codefirst
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/httpserver"
+	"github.com/ihezebin/olympus/httpserver/testkit"
+)
+
+type router struct {
+	executor httpserver.GraphQLExecutor
+}
+
+func (g *router) RegisterRoutes(router httpserver.Router) {
+	httpserver.GraphQL(router, "/graphql", g.executor)
+}
+
+func TestCodeFirst(t *testing.T) {
+	spans := make([]trace.SpanContext, 0)
+	executor, err := New(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"sum": &graphql.Field{
+					Type: graphql.Int,
+					Args: graphql.FieldConfigArgument{
+						"a": &graphql.ArgumentConfig{Type: graphql.Int},
+						"b": &graphql.ArgumentConfig{Type: graphql.Int},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						spans = append(spans, trace.SpanContextFromContext(p.Context))
+						return p.Args["a"].(int) + p.Args["b"].(int), nil
+					},
+				},
+				"panic": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						panic("boom")
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kit := testkit.New(t, []httpserver.RegisterRoutes{&router{executor: executor}})
+
+	do := func(query string) *httpserver.GraphQLResponse {
+		resp := kit.Do(http.MethodPost, "/graphql", testkit.WithJSON(httpserver.GraphQLRequest{Query: query}))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d %s", resp.Code, resp.Body.String())
+		}
+		result := &httpserver.GraphQLResponse{}
+		if err := json.Unmarshal(resp.Body.Bytes(), result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	resp := do(`{ sum(a: 1, b: 2) }`)
+	if data, _ := json.Marshal(resp.Data); string(data) != `{"sum":3}` || len(resp.Errors) > 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(spans) != 1 || !spans[0].IsValid() {
+		t.Fatal("resolver should be traced")
+	}
+
+	resp = do(`{ panic }`)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "boom") {
+		t.Fatalf("panic should be converted to error: %+v", resp)
+	}
+}
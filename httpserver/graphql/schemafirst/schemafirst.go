@@ -0,0 +1,76 @@
+// Package schemafirst 基于 graph-gophers/graphql-go 的 schema-first GraphQL，通过 httpserver.GraphQL 注册
+//
+//	executor, err := schemafirst.New(`type Query { user(id: ID!): User }`, &Resolver{})
+//	httpserver.GraphQL(router, "/graphql", executor)
+package schemafirst
+
+import (
+	"context"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	pkgerrors "github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/ihezebin/olympus/httpserver"
+)
+
+// New resolver 的方法对应 schema 中的字段，每个 resolver 方法记录一个 span
+func New(schema string, resolver any, opts ...graphql.SchemaOpt) (httpserver.GraphQLExecutor, error) {
+	opts = append([]graphql.SchemaOpt{
+		graphql.Tracer(otelTracer{}),
+		graphql.Logger(panicLogger{}),
+	}, opts...)
+	parsed, err := graphql.ParseSchema(schema, resolver, opts...)
+	if err != nil {
+		return nil, pkgerrors.Wrap(err, "parse graphql schema err")
+	}
+
+	return httpserver.GraphQLExecutorFunc(func(ctx context.Context, req httpserver.GraphQLRequest) *httpserver.GraphQLResponse {
+		result := parsed.Exec(ctx, req.Query, req.OperationName, req.Variables)
+		resp := &httpserver.GraphQLResponse{Extensions: result.Extensions}
+		if len(result.Data) > 0 {
+			resp.Data = result.Data
+		}
+		for _, queryErr := range result.Errors {
+			graphqlErr := httpserver.GraphQLError{Message: queryErr.Message, Path: queryErr.Path, Extensions: queryErr.Extensions}
+			for _, location := range queryErr.Locations {
+				graphqlErr.Locations = append(graphqlErr.Locations, httpserver.GraphQLLocation{Line: location.Line, Column: location.Column})
+			}
+			resp.Errors = append(resp.Errors, graphqlErr)
+		}
+		return resp
+	}), nil
+}
+
+// otelTracer 只记录有 resolver 的字段
+type otelTracer struct{}
+
+var _ tracer.Tracer = otelTracer{}
+
+func (otelTracer) TraceQuery(ctx context.Context, queryString string, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, tracer.QueryFinishFunc) {
+	return ctx, func(errs []*errors.QueryError) {}
+}
+
+func (otelTracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, tracer.FieldFinishFunc) {
+	if trivial {
+		return ctx, func(*errors.QueryError) {}
+	}
+	ctx, span := httpserver.StartGraphQLFieldSpan(ctx, typeName, fieldName)
+	return ctx, func(err *errors.QueryError) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Message)
+		}
+		span.End()
+	}
+}
+
+// panicLogger graphql-go 恢复 resolver 的 panic 并转换为错误
+type panicLogger struct{}
+
+func (panicLogger) LogPanic(ctx context.Context, value interface{}) {
+	httpserver.RecordGraphQLPanic(ctx, value)
+}
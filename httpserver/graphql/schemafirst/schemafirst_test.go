@@ -0,0 +1,86 @@
+package schemafirst
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/httpserver"
+	"github.com/ihezebin/olympus/httpserver/testkit"
+)
+
+type resolver struct {
+	requestSpan trace.SpanContext
+	spans       []trace.SpanContext
+}
+
+func (r *resolver) Hello(ctx context.Context, args struct{ Name string }) (string, error) {
+	r.spans = append(r.spans, trace.SpanContextFromContext(ctx))
+	c, ok := httpserver.GraphQLGinContext(ctx)
+	if !ok {
+		return "", errors.New("gin context not found")
+	}
+	return "hello " + args.Name + " from " + c.GetHeader("X-User"), nil
+}
+
+func (r *resolver) Panic() string {
+	panic("boom")
+}
+
+type router struct {
+	resolver *resolver
+	executor httpserver.GraphQLExecutor
+}
+
+func (g *router) RegisterRoutes(router httpserver.Router) {
+	api := router.Group("/api").Use(func(c *gin.Context) {
+		g.resolver.requestSpan = trace.SpanContextFromContext(c.Request.Context())
+		c.Next()
+	})
+	httpserver.GraphQL(api, "/graphql", g.executor)
+}
+
+func TestSchemaFirst(t *testing.T) {
+	r := &resolver{}
+	executor, err := New(`type Query { hello(name: String!): String! panic: String! }`, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kit := testkit.New(t, []httpserver.RegisterRoutes{&router{resolver: r, executor: executor}})
+
+	do := func(query string) *httpserver.GraphQLResponse {
+		resp := kit.Do(http.MethodPost, "/api/graphql", testkit.WithJSON(httpserver.GraphQLRequest{Query: query}), testkit.WithHeader("X-User", "alice"))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d %s", resp.Code, resp.Body.String())
+		}
+		result := &httpserver.GraphQLResponse{}
+		if err := json.Unmarshal(resp.Body.Bytes(), result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	resp := do(`{ hello(name: "bob") }`)
+	if data, _ := json.Marshal(resp.Data); string(data) != `{"hello":"hello bob from alice"}` || len(resp.Errors) > 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(r.spans) != 1 || r.spans[0].TraceID() != r.requestSpan.TraceID() || r.spans[0].SpanID() == r.requestSpan.SpanID() {
+		t.Fatal("resolver should be traced under the request span")
+	}
+
+	// resolver 的 panic 转换为 GraphQL 错误
+	resp = do(`{ panic }`)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "panic") {
+		t.Fatalf("panic should be converted to error: %+v", resp)
+	}
+
+	if _, err = New(`type Query { missing: String! }`, r); err == nil {
+		t.Fatal("expected err for schema without resolver")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ihezebin/openapi"
@@ -45,15 +44,15 @@ func newGinHandlerFunc[RequestT any, ResponseT any](handler Handler[RequestT, Re
 		if isRequestStruct { // 如果是结构体可自由绑定
 			if err = c.ShouldBind(requestPtr); err != nil {
 				logger.WithError(err).Errorf(ctx, "failed to bind, uri: %s", c.Request.RequestURI)
-				body = body.WithErr(ErrorWithInternalServer())
+				body = body.WithErr(bindError(err, ErrorWithInternalServer()))
 				c.PureJSON(body.status, body)
 				return
 			}
 		} else { // 如果是 map 则优先从 body 读, 如果 body 为空则从 query 读
 			if err = c.ShouldBindWith(requestPtr, mapBinding{}); err != nil {
 				logger.WithError(err).Errorf(ctx, "failed to bind, uri: %s", c.Request.RequestURI)
-				body = body.WithErr(ErrorWithBadRequest())
-				c.PureJSON(http.StatusBadRequest, body)
+				body = body.WithErr(bindError(err, ErrorWithBadRequest()))
+				c.PureJSON(body.status, body)
 				return
 			}
 		}
@@ -99,6 +98,15 @@ func newGinHandlerFunc[RequestT any, ResponseT any](handler Handler[RequestT, Re
 	}
 }
 
+// bindError 请求体超过大小限制时返回 413，否则返回 defaultErr
+func bindError(err error, defaultErr *Err) *Err {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrorWithRequestEntityTooLarge(maxBytesErr.Limit)
+	}
+	return defaultErr
+}
+
 // handlerGenerator return [requestBody, responseBody, query, params, requestHeader, responseHeader, gin.HandlerFunc]
 type handlerGenerator func() (*openapi.Model, *openapi.Model, map[string]openapi.QueryParam, map[string]openapi.PathParam, map[string]openapi.HeaderParam, map[string]openapi.HeaderParam, gin.HandlerFunc)
 
@@ -127,95 +135,15 @@ func NewHandler[RequestT any, ResponseT any](handler Handler[RequestT, ResponseT
 		}
 
 		// 通过反射获取 request 的字段和 tag
-		var requestBodyStructFields []reflect.StructField
-		query := map[string]openapi.QueryParam{}
-		params := map[string]openapi.PathParam{}
-		requestHeader := map[string]openapi.HeaderParam{}
+		fields := newRequestFields()
+		fields.collect(requestType, map[reflect.Type]bool{})
+		query, params, requestHeader := fields.query, fields.params, fields.header
 		responseHeader := map[string]openapi.HeaderParam{}
 
-		for i := 0; i < requestType.NumField(); i++ {
-			field := requestType.Field(i)
-			fieldType := field.Type
-
-			tagDescription := field.Tag.Get("description")
-			if tagDescription == "" {
-				tagDescription = field.Tag.Get("desc")
-			}
-
-			isRequired := false
-			isAllowEmpty := false
-			tagOpenApi := field.Tag.Get("openapi")
-			if tagOpenApi != "" { // required,empty
-				parts := strings.Split(tagOpenApi, ",")
-				for _, part := range parts {
-					if part == "required" {
-						isRequired = true
-					}
-					if part == "empty" {
-						isAllowEmpty = true
-					}
-				}
-			}
-
-			tagJson := field.Tag.Get("json")
-			if tagJson != "" {
-				requestBodyStructFields = append(requestBodyStructFields, field)
-			}
-
-			primitiveType := openapi.PrimitiveTypeString
-			switch fieldType.Kind() {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				primitiveType = openapi.PrimitiveTypeInteger
-			case reflect.Bool:
-				primitiveType = openapi.PrimitiveTypeBool
-			case reflect.Float64, reflect.Float32:
-				primitiveType = openapi.PrimitiveTypeFloat64
-			}
-
-			tagQuery := field.Tag.Get("query")
-			if tagQuery == "" {
-				tagQuery = field.Tag.Get("form")
-			}
-			if tagQuery != "" {
-				queryParam := openapi.QueryParam{
-					Description: tagDescription,
-					Required:    isRequired,
-					AllowEmpty:  isAllowEmpty,
-					Type:        primitiveType,
-				}
-
-				query[tagQuery] = queryParam
-			}
-
-			tagUri := field.Tag.Get("uri")
-			if tagUri != "" {
-				param := openapi.PathParam{
-					Description: tagDescription,
-					Type:        primitiveType,
-				}
-
-				params[tagUri] = param
-			}
-
-			tagHeader := field.Tag.Get("header")
-			if tagHeader != "" {
-				headerParam := openapi.HeaderParam{
-					Description: tagDescription,
-					Type:        primitiveType,
-					Required:    isRequired,
-				}
-
-				requestHeader[tagHeader] = headerParam
-			}
-		}
 		var requestBodyModel *openapi.Model = nil
-
-		if len(requestBodyStructFields) > 0 {
-			requestBodyType := reflect.StructOf(requestBodyStructFields)
-			a := requestBodyType.Kind()
-			_ = a
+		if body := fields.bodyFields(); len(body) > 0 {
 			requestBodyModel = &openapi.Model{
-				Type: requestBodyType,
+				Type: reflect.StructOf(body),
 			}
 		}
 
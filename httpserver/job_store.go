@@ -0,0 +1,185 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// JobStatus 异步任务的状态
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// Done 任务已经结束
+func (s JobStatus) Done() bool {
+	return s == JobStatusSucceeded || s == JobStatusFailed
+}
+
+// Job 保存在 JobStore 中的异步任务，Request 与 Result 为 json
+type Job struct {
+	ID       string    `json:"id"`
+	Status   JobStatus `json:"status"`
+	Progress float64   `json:"progress"`
+	Message  string    `json:"message,omitempty"`
+	// Request 通过 pubsub 交给其他进程执行时保存请求
+	Request json.RawMessage `json:"request,omitempty"`
+	// Result 任务结束后的 Body
+	Result    json.RawMessage `json:"result,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// JobStore 保存异步任务，Get 在任务不存在时返回 nil
+type JobStore interface {
+	Save(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id string) (*Job, error)
+	// Claim 原子地将 pending 的任务改为 running 并返回，任务不存在或已经被领取时返回 nil，保证任务只执行一次
+	Claim(ctx context.Context, id string) (*Job, error)
+}
+
+type memoryJobStore struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewMemoryJobStore 保存在内存中，只能在当前进程中执行与查询，结束的任务保留 ttl，小于等于 0 时一直保留
+func NewMemoryJobStore(ttl time.Duration) JobStore {
+	return &memoryJobStore{ttl: ttl, jobs: map[string]*Job{}}
+}
+
+func (s *memoryJobStore) Save(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	saved := *job
+	s.jobs[job.ID] = &saved
+	return nil
+}
+
+func (s *memoryJobStore) Get(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	saved := *job
+	return &saved, nil
+}
+
+func (s *memoryJobStore) Claim(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	job, ok := s.jobs[id]
+	if !ok || job.Status != JobStatusPending {
+		return nil, nil
+	}
+	job.Status = JobStatusRunning
+	job.UpdatedAt = time.Now()
+	saved := *job
+	return &saved, nil
+}
+
+func (s *memoryJobStore) evict(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for id, job := range s.jobs {
+		if job.Status.Done() && now.Sub(job.UpdatedAt) > s.ttl {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+type redisJobStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisJobStore 保存在 redis 中，key 为 prefix+id，任务在 ttl 后过期，小于等于 0 时不过期
+func NewRedisJobStore(client redis.UniversalClient, prefix string, ttl time.Duration) JobStore {
+	return &redisJobStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (s *redisJobStore) Save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrap(err, "marshal job err")
+	}
+	if err = s.client.Set(ctx, s.prefix+job.ID, data, max(s.ttl, 0)).Err(); err != nil {
+		return errors.Wrapf(err, "save job %s err", job.ID)
+	}
+	return nil
+}
+
+// Claim 通过 WATCH 实现 compare-and-set，任务在读取后被其他进程修改时视为已经被领取
+func (s *redisJobStore) Claim(ctx context.Context, id string) (*Job, error) {
+	key := s.prefix + id
+	var claimed *Job
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			return err
+		}
+		job := &Job{}
+		if err = json.Unmarshal(data, job); err != nil {
+			return errors.Wrapf(err, "unmarshal job %s err", id)
+		}
+		if job.Status != JobStatusPending {
+			return nil
+		}
+		job.Status = JobStatusRunning
+		job.UpdatedAt = time.Now()
+		if data, err = json.Marshal(job); err != nil {
+			return errors.Wrap(err, "marshal job err")
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, max(s.ttl, 0))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		claimed = job
+		return nil
+	}, key)
+	if err != nil {
+		if errors.Is(err, redis.TxFailedErr) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "claim job %s err", id)
+	}
+	return claimed, nil
+}
+
+func (s *redisJobStore) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get job %s err", id)
+	}
+	job := &Job{}
+	if err = json.Unmarshal(data, job); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal job %s err", id)
+	}
+	return job, nil
+}
@@ -2,9 +2,14 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 
@@ -13,6 +18,88 @@ import (
 
 const maxBodyLen = 1024 * 2
 
+// businessCodeLen 不记录响应体时只保存响应开头用于解析业务码，httpserver.Body 的 code 为第一个字段
+const businessCodeLen = 128
+
+// Logging 每个请求一行访问日志，包含路由模板、状态码、业务码与耗时，可选记录脱敏后的 header 与 body。
+// 普通请求按 SampleRate 采样，慢请求与错误请求总是记录
+func Logging(opts ...LoggingOption) gin.HandlerFunc {
+	options := mergeLoggingOptions(opts...)
+	skipPaths := make(map[string]struct{}, len(options.SkipPaths))
+	for _, path := range options.SkipPaths {
+		skipPaths[path] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if _, ok := skipPaths[c.FullPath()]; ok {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var reqBody string
+		if options.RequestBody {
+			reqBody = requestBody(c, options)
+		}
+		limit := -1
+		switch {
+		case options.ResponseBody:
+			limit = options.MaxBodyBytes
+		case options.BusinessCode:
+			limit = businessCodeLen
+		}
+		rw := newResponseWriter(c.Writer, options, limit)
+		c.Writer = rw
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		slow := options.SlowThreshold > 0 && latency >= options.SlowThreshold
+		failed := options.ErrorStatus > 0 && status >= options.ErrorStatus
+		if !slow && !failed && options.SampleRate < 1 && rand.Float64() >= options.SampleRate {
+			return
+		}
+
+		fields := map[string]interface{}{
+			"method":        c.Request.Method,
+			"route":         c.FullPath(),
+			"uri":           redactPatterns(c.Request.URL.RequestURI(), options.RedactPatterns),
+			"status":        status,
+			"latency":       latency.String(),
+			"remote":        c.ClientIP(),
+			"request_size":  c.Request.ContentLength,
+			"response_size": c.Writer.Size(),
+		}
+		if code, ok := rw.businessCode(); ok && options.BusinessCode {
+			fields["code"] = code
+		}
+		if options.RequestHeader {
+			fields["request_header"] = redactHeader(c.Request.Header, options.RedactHeaders)
+		}
+		if options.RequestBody {
+			fields["request_body"] = reqBody
+		}
+		if options.ResponseHeader {
+			fields["response_header"] = redactHeader(c.Writer.Header(), options.RedactHeaders)
+		}
+		if options.ResponseBody {
+			fields["response_body"] = responseBody(rw, options)
+		}
+
+		// otel 中间件在其后时，请求结束后的 context 才包含 trace
+		ctx := c.Request.Context()
+		log := logger.WithFields(fields)
+		switch {
+		case status >= http.StatusInternalServerError:
+			log.Error(ctx, "http access")
+		case status >= http.StatusBadRequest || slow:
+			log.Warn(ctx, "http access")
+		default:
+			log.Info(ctx, "http access")
+		}
+	}
+}
+
 func LoggingRequest() gin.HandlerFunc {
 	return generateLoggingRequest(true)
 }
@@ -22,6 +109,7 @@ func LoggingRequestWithoutHeader() gin.HandlerFunc {
 }
 
 func generateLoggingRequest(header bool) gin.HandlerFunc {
+	options := mergeLoggingOptions()
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
@@ -29,20 +117,25 @@ func generateLoggingRequest(header bool) gin.HandlerFunc {
 			"method": c.Request.Method,
 			"uri":    c.Request.URL.RequestURI(),
 			"remote": c.Request.RemoteAddr,
-			"body":   requestBody(c),
+			"body":   requestBody(c, options),
 		}
 		if header {
-			fields["header"] = c.Request.Header
+			fields["header"] = redactHeader(c.Request.Header, options.RedactHeaders)
 		}
 		logger.WithFields(fields).Info(ctx, "incoming http request")
 		c.Next()
 	}
 }
 
-func requestBody(c *gin.Context) string {
+// requestBody 读取文本类型的请求体后放回，其余类型不读取
+func requestBody(c *gin.Context, options *LoggingOptions) string {
 	if c.Request.Body == nil || c.Request.Body == http.NoBody {
 		return ""
 	}
+	contentType := c.Request.Header.Get("Content-Type")
+	if !isTextContentType(contentType, options.BodyContentTypes) {
+		return binaryBody(contentType, c.Request.ContentLength)
+	}
 	bodyData, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		return fmt.Sprintf("read request body err: %s", err.Error())
@@ -50,13 +143,7 @@ func requestBody(c *gin.Context) string {
 	_ = c.Request.Body.Close()
 	c.Request.Body = io.NopCloser(bytes.NewReader(bodyData))
 
-	bodySize := len(bodyData)
-	bodySuffix := ""
-	if bodySize > maxBodyLen {
-		bodySize = maxBodyLen
-		bodySuffix = "..."
-	}
-	return string(bodyData[:bodySize]) + bodySuffix
+	return formatBody(bodyData, contentType, options)
 }
 
 func LoggingResponse() gin.HandlerFunc {
@@ -68,41 +155,121 @@ func LoggingResponseWithoutHeader() gin.HandlerFunc {
 }
 
 func generateLoggingResponse(header bool) gin.HandlerFunc {
+	options := mergeLoggingOptions()
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
-		rw := responseWriter{Body: new(bytes.Buffer), ResponseWriter: c.Writer}
+		rw := newResponseWriter(c.Writer, options, options.MaxBodyBytes)
 		c.Writer = rw
 		c.Next()
 
 		fields := map[string]interface{}{
 			"status": fmt.Sprintf("%v %s", c.Writer.Status(), http.StatusText(c.Writer.Status())),
-			"body":   responseBody(&rw),
+			"body":   responseBody(rw, options),
 		}
 		if header {
-			fields["header"] = c.Writer.Header()
+			fields["header"] = redactHeader(c.Writer.Header(), options.RedactHeaders)
 		}
 
 		logger.WithFields(fields).Info(ctx, "outgoing http response")
 	}
 }
 
-func responseBody(rw *responseWriter) string {
-	body := rw.Body.Bytes()
-	bodyLen := len(body)
-	if bodyLen > maxBodyLen {
-		bodyLen = maxBodyLen
+func responseBody(rw *responseWriter, options *LoggingOptions) string {
+	contentType := rw.Header().Get("Content-Type")
+	if !rw.capturing {
+		if rw.Size() <= 0 {
+			return ""
+		}
+		return binaryBody(contentType, int64(rw.Size()))
+	}
+	if !rw.truncated {
+		return formatBody(rw.body.Bytes(), contentType, options)
 	}
-	return string(body[:bodyLen]) + "..."
+	// 截断处可能在多字节字符中间，去掉不完整的字符
+	data := rw.body.Bytes()
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	body := formatBody(data, contentType, options)
+	if !strings.HasSuffix(body, "...") {
+		body += "..."
+	}
+	return body
 }
 
+// responseWriter 第一次写入时按 content type 决定是否保存响应体，最多保存 limit 字节，
+// limit 为 0 表示不限制，小于 0 表示不保存
 type responseWriter struct {
 	gin.ResponseWriter
-	Body *bytes.Buffer
+	options   *LoggingOptions
+	limit     int
+	body      *bytes.Buffer
+	decided   bool
+	capturing bool
+	truncated bool
 }
 
-func (w responseWriter) Write(body []byte) (int, error) {
-	// store body
-	w.Body.Write(body)
-	// write
+func newResponseWriter(w gin.ResponseWriter, options *LoggingOptions, limit int) *responseWriter {
+	return &responseWriter{ResponseWriter: w, options: options, limit: limit, body: new(bytes.Buffer)}
+}
+
+func (w *responseWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		contentType := w.Header().Get("Content-Type")
+		w.capturing = w.limit >= 0 && contentType != "" && isTextContentType(contentType, w.options.BodyContentTypes)
+	}
+}
+
+// capture 保存响应体直到 limit，超出部分只标记 truncated
+func (w *responseWriter) capture(size int) int {
+	w.decide()
+	if !w.capturing || w.truncated {
+		return 0
+	}
+	if w.limit > 0 && w.body.Len()+size > w.limit {
+		w.truncated = true
+		return w.limit - w.body.Len()
+	}
+	return size
+}
+
+func (w *responseWriter) Write(body []byte) (int, error) {
+	w.body.Write(body[:w.capture(len(body))])
 	return w.ResponseWriter.Write(body)
 }
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s[:w.capture(len(s))])
+	return w.ResponseWriter.WriteString(s)
+}
+
+// businessCode 从 json 响应体中解析 httpserver.Body 的 code，响应体被截断时只要 code 在截断前即可解析
+func (w *responseWriter) businessCode() (int, bool) {
+	if !w.capturing || w.body.Len() == 0 {
+		return 0, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(w.body.Bytes()))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return 0, false
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return 0, false
+		}
+		if key != "code" {
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return 0, false
+			}
+			continue
+		}
+		var code int
+		if err = decoder.Decode(&code); err != nil {
+			return 0, false
+		}
+		return code, true
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+)
+
+type LoggingOptions struct {
+	RequestHeader  bool `json:"request_header" yaml:"request_header" toml:"request_header"`
+	RequestBody    bool `json:"request_body" yaml:"request_body" toml:"request_body"`
+	ResponseHeader bool `json:"response_header" yaml:"response_header" toml:"response_header"`
+	ResponseBody   bool `json:"response_body" yaml:"response_body" toml:"response_body"`
+	// BusinessCode 记录 json 响应中 httpserver.Body 的 code，不记录响应体时只保存响应开头用于解析
+	BusinessCode bool `json:"business_code" yaml:"business_code" toml:"business_code"`
+	// MaxBodyBytes 记录的请求体与响应体的最大长度，超出部分以 ... 结尾，响应体超出部分不会保存在内存中；为 0 表示不限制
+	MaxBodyBytes int `json:"max_body_bytes" yaml:"max_body_bytes" toml:"max_body_bytes"`
+	// BodyContentTypes 记录 body 的 content type，其余类型只记录长度；以 / 结尾表示前缀匹配，以 + 开头表示后缀匹配
+	BodyContentTypes []string `json:"body_content_types" yaml:"body_content_types" toml:"body_content_types"`
+	// RedactHeaders 脱敏的 header，不区分大小写
+	RedactHeaders []string `json:"redact_headers" yaml:"redact_headers" toml:"redact_headers"`
+	// RedactJSONPaths 脱敏的 json 字段，例如 user.password、items.*.token，..password 表示任意层级的 password
+	RedactJSONPaths []string `json:"redact_json_paths" yaml:"redact_json_paths" toml:"redact_json_paths"`
+	// RedactPatterns 对 uri 与 body 按正则脱敏，例如手机号、身份证号
+	RedactPatterns []*regexp.Regexp `json:"-" yaml:"-" toml:"-"`
+	// SampleRate 普通请求的采样比例，0 到 1，默认全部记录
+	SampleRate float64 `json:"sample_rate" yaml:"sample_rate" toml:"sample_rate"`
+	// SlowThreshold 耗时超过该值的请求总是记录，为 0 表示不按耗时判断
+	SlowThreshold time.Duration `json:"slow_threshold" yaml:"slow_threshold" toml:"slow_threshold"`
+	// ErrorStatus 状态码大于等于该值的请求总是记录，为 0 表示不按状态码判断
+	ErrorStatus int `json:"error_status" yaml:"error_status" toml:"error_status"`
+	// SkipPaths 不记录的路由，例如 /health、/metrics
+	SkipPaths []string `json:"skip_paths" yaml:"skip_paths" toml:"skip_paths"`
+}
+
+type LoggingOption func(*LoggingOptions)
+
+// DefaultRedactHeaders 默认脱敏的 header
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// DefaultRedactJSONPaths 默认脱敏的 json 字段
+var DefaultRedactJSONPaths = []string{"..password", "..passwd", "..secret"}
+
+// DefaultBodyContentTypes 默认记录 body 的 content type
+var DefaultBodyContentTypes = []string{"application/json", "application/xml", "application/x-www-form-urlencoded", "text/", "+json", "+xml"}
+
+func mergeLoggingOptions(opts ...LoggingOption) *LoggingOptions {
+	opt := &LoggingOptions{
+		RequestBody:      true,
+		ResponseBody:     true,
+		BusinessCode:     true,
+		MaxBodyBytes:     maxBodyLen,
+		BodyContentTypes: DefaultBodyContentTypes,
+		RedactHeaders:    DefaultRedactHeaders,
+		RedactJSONPaths:  DefaultRedactJSONPaths,
+		SampleRate:       1,
+		ErrorStatus:      500,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+// WithLoggingHeader 记录请求与响应的 header，脱敏的 header 记录为 ***
+func WithLoggingHeader(request, response bool) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.RequestHeader = request
+		o.ResponseHeader = response
+	}
+}
+
+func WithLoggingBody(request, response bool) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.RequestBody = request
+		o.ResponseBody = response
+	}
+}
+
+// WithLoggingBusinessCode 是否记录业务码，关闭且不记录响应体时不保存响应
+func WithLoggingBusinessCode(enable bool) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.BusinessCode = enable
+	}
+}
+
+func WithLoggingMaxBodyBytes(limit int) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.MaxBodyBytes = limit
+	}
+}
+
+func WithLoggingBodyContentTypes(contentTypes ...string) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.BodyContentTypes = contentTypes
+	}
+}
+
+// WithRedactHeaders 追加脱敏的 header
+func WithRedactHeaders(headers ...string) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.RedactHeaders = append(append([]string{}, o.RedactHeaders...), headers...)
+	}
+}
+
+// WithRedactJSONPaths 追加脱敏的 json 字段
+func WithRedactJSONPaths(paths ...string) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.RedactJSONPaths = append(append([]string{}, o.RedactJSONPaths...), paths...)
+	}
+}
+
+func WithRedactPatterns(patterns ...*regexp.Regexp) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.RedactPatterns = append(o.RedactPatterns, patterns...)
+	}
+}
+
+// WithLoggingSampling 普通请求按 rate 采样，慢请求与错误请求总是记录
+func WithLoggingSampling(rate float64, slowThreshold time.Duration, errorStatus int) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.SampleRate = rate
+		o.SlowThreshold = slowThreshold
+		o.ErrorStatus = errorStatus
+	}
+}
+
+func WithLoggingSkipPaths(paths ...string) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.SkipPaths = append(o.SkipPaths, paths...)
+	}
+}
@@ -0,0 +1,367 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/oss"
+	"github.com/ihezebin/olympus/requestid"
+)
+
+// HAREntry 一次请求与响应的录制，字段与 HAR 1.2 的 entry 一致，以 _ 开头的为扩展字段
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	// Route gin 的路由模板，例如 /users/:id
+	Route     string `json:"_route"`
+	RequestId string `json:"_requestId,omitempty"`
+	// Truncated 请求体或响应体超过 MaxBodyBytes 被截断
+	Truncated bool `json:"_truncated,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// RecordWriter 批量写入录制
+type RecordWriter interface {
+	WriteRecords(ctx context.Context, entries []HAREntry) error
+}
+
+// Recorder 按路由采样录制请求与响应，脱敏后异步写入 RecordWriter，用于在本地回放排查线上问题
+//
+//	recorder := middleware.NewRecorder(writer)
+//	server, _ := httpserver.NewServer(ctx, httpserver.WithMiddlewares(recorder.Middleware()))
+//	recorder.SetRouteSampleRate(http.MethodPost, "/orders/:id", 0.1)
+type Recorder struct {
+	writer  RecordWriter
+	options *RecorderOptions
+	logging *LoggingOptions
+	// rates 路由的采样比例，key 为 method route，method 为 * 时匹配所有方法
+	rates   sync.Map
+	entries chan HAREntry
+	done    chan struct{}
+	// mu 保证 Close 之后不再写入 entries
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewRecorder(writer RecordWriter, opts ...RecorderOption) *Recorder {
+	options := mergeRecorderOptions(opts...)
+	r := &Recorder{
+		writer:  writer,
+		options: options,
+		logging: &LoggingOptions{
+			MaxBodyBytes:     options.MaxBodyBytes,
+			BodyContentTypes: options.BodyContentTypes,
+			RedactHeaders:    options.RedactHeaders,
+			RedactJSONPaths:  options.RedactJSONPaths,
+			RedactPatterns:   options.RedactPatterns,
+		},
+		entries: make(chan HAREntry, options.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// SetRouteSampleRate 运行时修改路由的采样比例，为 0 时关闭该路由的录制，method 为 * 时对所有方法生效
+func (r *Recorder) SetRouteSampleRate(method, route string, rate float64) {
+	r.rates.Store(strings.ToUpper(method)+" "+route, min(max(rate, 0), 1))
+}
+
+// ResetRouteSampleRate 路由恢复为默认的 SampleRate
+func (r *Recorder) ResetRouteSampleRate(method, route string) {
+	r.rates.Delete(strings.ToUpper(method) + " " + route)
+}
+
+// RouteSampleRates 通过 SetRouteSampleRate 设置的路由，key 为 method route
+func (r *Recorder) RouteSampleRates() map[string]float64 {
+	rates := make(map[string]float64)
+	r.rates.Range(func(key, value any) bool {
+		rates[key.(string)] = value.(float64)
+		return true
+	})
+	return rates
+}
+
+func (r *Recorder) sampleRate(method, route string) float64 {
+	for _, key := range []string{method + " " + route, "* " + route} {
+		if rate, ok := r.rates.Load(key); ok {
+			return rate.(float64)
+		}
+	}
+	return r.options.SampleRate
+}
+
+func (r *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rate := r.sampleRate(c.Request.Method, c.FullPath())
+		if rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		reqBody := requestBody(c, r.logging)
+		rw := newResponseWriter(c.Writer, r.logging, r.options.MaxBodyBytes)
+		c.Writer = rw
+		c.Next()
+
+		r.record(c, r.entry(c, rw, reqBody, start))
+	}
+}
+
+func (r *Recorder) record(c *gin.Context, entry HAREntry) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.entries <- entry:
+	default:
+		logger.Warnf(c.Request.Context(), "recorder buffer is full, drop record of %s %s", c.Request.Method, c.FullPath())
+	}
+}
+
+func (r *Recorder) entry(c *gin.Context, rw *responseWriter, reqBody string, start time.Time) HAREntry {
+	req := c.Request
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	query := make([]HARNameValue, 0)
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, HARNameValue{Name: name, Value: redactPatterns(value, r.options.RedactPatterns)})
+		}
+	}
+	sortNameValues(query)
+
+	entry := HAREntry{
+		StartedDateTime: start,
+		Time:            float64(time.Since(start).Microseconds()) / 1000,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         redactPatterns(scheme+"://"+req.Host+req.URL.RequestURI(), r.options.RedactPatterns),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(redactHeader(req.Header, r.options.RedactHeaders)),
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+		Response: HARResponse{
+			Status:      rw.Status(),
+			StatusText:  http.StatusText(rw.Status()),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(redactHeader(rw.Header(), r.options.RedactHeaders)),
+			Content: HARContent{
+				Size:     int64(max(rw.Size(), 0)),
+				MimeType: rw.Header().Get("Content-Type"),
+				Text:     responseBody(rw, r.logging),
+			},
+			RedirectURL: rw.Header().Get("Location"),
+			HeadersSize: -1,
+			BodySize:    int64(rw.Size()),
+		},
+		Route:     c.FullPath(),
+		RequestId: requestid.FromContext(req.Context()),
+		Truncated: r.options.MaxBodyBytes > 0 && (req.ContentLength > int64(r.options.MaxBodyBytes) || rw.truncated),
+	}
+	if entry.RequestId == "" {
+		// otelgin 结束时恢复请求的 context，在其之前的中间件从响应 header 中获取
+		entry.RequestId = rw.Header().Get(requestid.Header)
+	}
+	if reqBody != "" {
+		entry.Request.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: reqBody}
+	}
+	return entry
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	headers := make([]HARNameValue, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sortNameValues(headers)
+	return headers
+}
+
+func sortNameValues(values []HARNameValue) {
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Name < values[j].Name
+	})
+}
+
+func (r *Recorder) loop() {
+	defer close(r.done)
+	batch := make([]HAREntry, 0, r.options.BatchSize)
+	ticker := time.NewTicker(r.options.FlushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.writer.WriteRecords(context.Background(), batch); err != nil {
+			logger.WithError(err).Errorf(context.Background(), "failed to write %d records", len(batch))
+		}
+		batch = make([]HAREntry, 0, r.options.BatchSize)
+	}
+	for {
+		select {
+		case entry, ok := <-r.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= r.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close 停止录制并写入剩余的录制，writer 实现 io.Closer 时一并关闭，可以作为 httpserver 的 ShutdownFunc
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.entries)
+	}
+	r.mu.Unlock()
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if closer, ok := r.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type fileRecordWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileRecordWriter 以 json lines 追加写入文件，每行一个 HAREntry
+func NewFileRecordWriter(path string) (RecordWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, errors.Wrapf(err, "make dir of %s err", path)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open record file %s err", path)
+	}
+	return &fileRecordWriter{file: file}, nil
+}
+
+func (w *fileRecordWriter) WriteRecords(ctx context.Context, entries []HAREntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	buffer := bufio.NewWriter(w.file)
+	encoder := json.NewEncoder(buffer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return errors.Wrap(err, "encode record err")
+		}
+	}
+	if err := buffer.Flush(); err != nil {
+		return errors.Wrap(err, "write records err")
+	}
+	return nil
+}
+
+func (w *fileRecordWriter) Close() error {
+	return w.file.Close()
+}
+
+type ossRecordWriter struct {
+	client oss.Client
+	prefix string
+}
+
+// NewOSSRecordWriter 每批录制写入一个 json lines 对象，名称为 prefix/2006-01-02/150405.000000-{随机数}.jsonl
+func NewOSSRecordWriter(client oss.Client, prefix string) RecordWriter {
+	return &ossRecordWriter{client: client, prefix: strings.TrimRight(prefix, "/")}
+}
+
+func (w *ossRecordWriter) WriteRecords(ctx context.Context, entries []HAREntry) error {
+	data := make([]byte, 0)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "encode record err")
+		}
+		data = append(append(data, line...), '\n')
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s/%s-%04d.jsonl", now.Format("2006-01-02"), now.Format("150405.000000"), rand.Intn(10000))
+	if w.prefix != "" {
+		name = w.prefix + "/" + name
+	}
+	err := w.client.PutObject(ctx, name, strings.NewReader(string(data)), oss.WithSize(int64(len(data))), oss.WithContentType("application/x-ndjson"))
+	if err != nil {
+		return errors.Wrapf(err, "put records %s err", name)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+)
+
+type RecorderOptions struct {
+	// SampleRate 没有通过 Recorder.SetRouteSampleRate 设置的路由的采样比例，默认为 0，只录制开启的路由
+	SampleRate float64 `json:"sample_rate" yaml:"sample_rate" toml:"sample_rate"`
+	// MaxBodyBytes 录制的请求体与响应体的最大长度，超出时截断并标记 _truncated，回放时不比较响应体
+	MaxBodyBytes int `json:"max_body_bytes" yaml:"max_body_bytes" toml:"max_body_bytes"`
+	// BodyContentTypes 录制 body 的 content type，其余类型只记录类型与长度
+	BodyContentTypes []string         `json:"body_content_types" yaml:"body_content_types" toml:"body_content_types"`
+	RedactHeaders    []string         `json:"redact_headers" yaml:"redact_headers" toml:"redact_headers"`
+	RedactJSONPaths  []string         `json:"redact_json_paths" yaml:"redact_json_paths" toml:"redact_json_paths"`
+	RedactPatterns   []*regexp.Regexp `json:"-" yaml:"-" toml:"-"`
+	// BufferSize 等待写入的录制数，写入跟不上时丢弃新的录制，不阻塞请求
+	BufferSize int `json:"buffer_size" yaml:"buffer_size" toml:"buffer_size"`
+	// BatchSize 与 FlushInterval 任意一个满足时批量写入
+	BatchSize     int           `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+	FlushInterval time.Duration `json:"flush_interval" yaml:"flush_interval" toml:"flush_interval"`
+}
+
+type RecorderOption func(*RecorderOptions)
+
+func mergeRecorderOptions(opts ...RecorderOption) *RecorderOptions {
+	opt := &RecorderOptions{
+		MaxBodyBytes:     64 * 1024,
+		BodyContentTypes: DefaultBodyContentTypes,
+		RedactHeaders:    DefaultRedactHeaders,
+		RedactJSONPaths:  DefaultRedactJSONPaths,
+		BufferSize:       1000,
+		BatchSize:        100,
+		FlushInterval:    5 * time.Second,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 1
+	}
+	if opt.FlushInterval <= 0 {
+		opt.FlushInterval = time.Second
+	}
+	return opt
+}
+
+// WithRecordSampleRate 所有路由默认的采样比例，0 到 1
+func WithRecordSampleRate(rate float64) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.SampleRate = rate
+	}
+}
+
+func WithRecordMaxBodyBytes(limit int) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.MaxBodyBytes = limit
+	}
+}
+
+// WithRecordRedactHeaders 追加脱敏的 header
+func WithRecordRedactHeaders(headers ...string) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.RedactHeaders = append(append([]string{}, o.RedactHeaders...), headers...)
+	}
+}
+
+// WithRecordRedactJSONPaths 追加脱敏的 json 字段，格式与 WithRedactJSONPaths 一致
+func WithRecordRedactJSONPaths(paths ...string) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.RedactJSONPaths = append(append([]string{}, o.RedactJSONPaths...), paths...)
+	}
+}
+
+func WithRecordRedactPatterns(patterns ...*regexp.Regexp) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.RedactPatterns = append(o.RedactPatterns, patterns...)
+	}
+}
+
+func WithRecordBuffer(bufferSize, batchSize int, flushInterval time.Duration) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.BufferSize = bufferSize
+		o.BatchSize = batchSize
+		o.FlushInterval = flushInterval
+	}
+}
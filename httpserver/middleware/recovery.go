@@ -9,6 +9,9 @@ import (
 	"github.com/ihezebin/olympus/logger"
 )
 
+// Recovery 返回的响应不是 httpserver.Body 结构
+//
+// Deprecated: httpserver 默认注册了 httpserver.Recovery，通过 httpserver.WithRecovery 设置 panic 上报
 func Recovery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
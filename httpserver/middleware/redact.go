@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const redacted = "***"
+
+// redactHeader 复制 header 并将需要脱敏的值替换为 ***
+func redactHeader(header http.Header, names []string) http.Header {
+	cloned := header.Clone()
+	for _, name := range names {
+		if _, ok := cloned[http.CanonicalHeaderKey(name)]; ok {
+			cloned.Set(name, redacted)
+		}
+	}
+	return cloned
+}
+
+// isTextContentType content type 是否在 contentTypes 中，为空时按 body 内容判断
+func isTextContentType(contentType string, contentTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if mediaType == "" {
+		return true
+	}
+	for _, t := range contentTypes {
+		t = strings.ToLower(t)
+		switch {
+		case strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t):
+			return true
+		case strings.HasPrefix(t, "+") && strings.HasSuffix(mediaType, t):
+			return true
+		case mediaType == t:
+			return true
+		}
+	}
+	return false
+}
+
+// formatBody 脱敏后截断到 MaxBodyBytes，非文本内容只记录类型与长度
+func formatBody(data []byte, contentType string, options *LoggingOptions) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if !utf8.Valid(data) {
+		return binaryBody(contentType, int64(len(data)))
+	}
+
+	body := string(data)
+	switch {
+	case strings.Contains(contentType, "json"):
+		body = redactJSON(data, options.RedactJSONPaths)
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		body = redactForm(body, options.RedactJSONPaths)
+	}
+	body = redactPatterns(body, options.RedactPatterns)
+
+	if options.MaxBodyBytes > 0 && len(body) > options.MaxBodyBytes {
+		return body[:options.MaxBodyBytes] + "..."
+	}
+	return body
+}
+
+func binaryBody(contentType string, size int64) string {
+	if contentType == "" {
+		contentType = "unknown"
+	}
+	return fmt.Sprintf("[%s %d bytes]", contentType, size)
+}
+
+func redactPatterns(s string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		s = pattern.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// redactJSON 按 json path 脱敏，body 不是合法的 json 时按字段名替换，避免截断的 body 泄露敏感字段
+func redactJSON(data []byte, paths []string) string {
+	if len(paths) == 0 {
+		return string(data)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return redactJSONKeys(string(data), paths)
+	}
+	for _, path := range paths {
+		if strings.HasPrefix(path, "..") {
+			v = redactAnyDepth(v, strings.Split(path[2:], "."))
+		} else {
+			v = redactPath(v, strings.Split(path, "."))
+		}
+	}
+	redactedData, err := json.Marshal(v)
+	if err != nil {
+		return redactJSONKeys(string(data), paths)
+	}
+	return string(redactedData)
+}
+
+func redactPath(v any, segments []string) any {
+	if len(segments) == 0 {
+		return redacted
+	}
+	segment, rest := segments[0], segments[1:]
+	switch value := v.(type) {
+	case map[string]any:
+		for key, child := range value {
+			if segment == "*" || segment == key {
+				value[key] = redactPath(child, rest)
+			}
+		}
+	case []any:
+		index, err := strconv.Atoi(segment)
+		for i, child := range value {
+			if segment == "*" || (err == nil && i == index) {
+				value[i] = redactPath(child, rest)
+			}
+		}
+	}
+	return v
+}
+
+func redactAnyDepth(v any, segments []string) any {
+	v = redactPath(v, segments)
+	switch value := v.(type) {
+	case map[string]any:
+		for key, child := range value {
+			value[key] = redactAnyDepth(child, segments)
+		}
+	case []any:
+		for i, child := range value {
+			value[i] = redactAnyDepth(child, segments)
+		}
+	}
+	return v
+}
+
+func redactJSONKeys(body string, paths []string) string {
+	for _, key := range lastSegments(paths) {
+		pattern := regexp.MustCompile(`("` + regexp.QuoteMeta(key) + `"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+		body = pattern.ReplaceAllString(body, `${1}"`+redacted+`"`)
+	}
+	return body
+}
+
+func redactForm(body string, paths []string) string {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return body
+	}
+	for _, key := range lastSegments(paths) {
+		if values.Has(key) {
+			values.Set(key, redacted)
+		}
+	}
+	return values.Encode()
+}
+
+func lastSegments(paths []string) []string {
+	keys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		segments := strings.Split(strings.TrimPrefix(path, ".."), ".")
+		if key := segments[len(segments)-1]; key != "" && key != "*" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/requestid"
+)
+
+// maxRequestIdLen 客户端传入的请求 ID 超过该长度或包含非法字符时重新生成
+const maxRequestIdLen = 128
+
+// RequestId 从 header 中获取请求 ID，没有时生成，写入响应 header、context 与 span，
+// logger 与 httpclient 从 context 中获取请求 ID，header 为空时使用 X-Request-Id
+func RequestId(header string) gin.HandlerFunc {
+	if header == "" {
+		header = requestid.Header
+	}
+	return func(c *gin.Context) {
+		id := c.GetHeader(header)
+		if !validRequestId(id) {
+			id = requestid.New()
+			// 转发请求时带上生成的请求 ID
+			c.Request.Header.Set(header, id)
+		}
+
+		ctx := requestid.NewContext(c.Request.Context(), id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(header, id)
+		c.Next()
+	}
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package httpserver
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+type OpenAPIFormat string
+
+const (
+	OpenAPIFormatJSON OpenAPIFormat = "json"
+	OpenAPIFormatYAML OpenAPIFormat = "yaml"
+)
+
+const (
+	// OpenAPIExportEnv 设置该环境变量(json/yaml)后，Run 只导出 openapi 文档，关闭组件后返回 ErrOpenAPIExported，不会监听端口
+	OpenAPIExportEnv = "OLYMPUS_OPENAPI_EXPORT"
+	// OpenAPIExportOutputEnv 导出文件路径，为空时输出到标准输出
+	OpenAPIExportOutputEnv = "OLYMPUS_OPENAPI_EXPORT_OUTPUT"
+)
+
+// ErrOpenAPIExported 导出模式下 Run 导出文档后返回，服务没有启动
+var ErrOpenAPIExported = errors.New("openapi spec exported")
+
+// ExportOpenAPI 将当前注册路由生成的 openapi 文档以 json 或 yaml 格式写入 w
+func (s *server) ExportOpenAPI(w io.Writer, format OpenAPIFormat) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case OpenAPIFormatJSON, "":
+		data, err = s.openapi.Json()
+	case OpenAPIFormatYAML:
+		data, err = s.openapi.Yaml()
+	default:
+		return errors.Errorf("unsupported openapi format: %s", format)
+	}
+	if err != nil {
+		return errors.Wrap(err, "generate openapi spec err")
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return errors.Wrap(err, "write openapi spec err")
+	}
+
+	return nil
+}
+
+// exportOpenAPIFromEnv 供 cmd/openapi export 使用，返回是否已经导出。
+// 导出到文件时先写入临时文件再重命名，文件出现时内容已经完整
+func (s *server) exportOpenAPIFromEnv() (bool, error) {
+	format := os.Getenv(OpenAPIExportEnv)
+	if format == "" {
+		return false, nil
+	}
+
+	output := os.Getenv(OpenAPIExportOutputEnv)
+	if output == "" {
+		return true, s.ExportOpenAPI(os.Stdout, OpenAPIFormat(format))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := s.ExportOpenAPI(buf, OpenAPIFormat(format)); err != nil {
+		return true, err
+	}
+	tmp := output + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return true, errors.Wrapf(err, "write openapi output file: %s err", tmp)
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		return true, errors.Wrapf(err, "rename openapi output file: %s err", output)
+	}
+	return true, nil
+}
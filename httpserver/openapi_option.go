@@ -32,6 +32,13 @@ func WithOpenAPIDeprecated() OpenAPIOption {
 	}
 }
 
+// WithOpenAPITags 设置接口的 tags，文档 UI 会按 tag 分组展示
+func WithOpenAPITags(tags ...string) OpenAPIOption {
+	return func(route *openapi.Route) {
+		route.HasTags(tags)
+	}
+}
+
 func WithOpenAPIResponseHeader(name string, param openapi.HeaderParam) OpenAPIOption {
 	return func(route *openapi.Route) {
 		route.HasResponseHeader(http.StatusOK, name, param)
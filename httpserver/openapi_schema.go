@@ -0,0 +1,385 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/ihezebin/openapi"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// requestFields 通过反射收集的请求参数
+type requestFields struct {
+	body   []bodyField
+	query  map[string]openapi.QueryParam
+	params map[string]openapi.PathParam
+	header map[string]openapi.HeaderParam
+}
+
+// bodyField 请求体字段，depth 为匿名结构体展开的层数
+type bodyField struct {
+	field reflect.StructField
+	name  string
+	depth int
+}
+
+func newRequestFields() *requestFields {
+	return &requestFields{
+		query:  map[string]openapi.QueryParam{},
+		params: map[string]openapi.PathParam{},
+		header: map[string]openapi.HeaderParam{},
+	}
+}
+
+// collect 递归收集结构体字段，匿名结构体与未声明 json tag 的嵌套结构体会被展开，与 gin 的绑定规则保持一致
+func (r *requestFields) collect(t reflect.Type, visited map[reflect.Type]bool) {
+	r.collectDepth(t, visited, 0)
+}
+
+func (r *requestFields) collectDepth(t reflect.Type, visited map[reflect.Type]bool, depth int) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		tagJson := tagName(field.Tag.Get("json"))
+		tagQuery := tagName(field.Tag.Get("query"))
+		if tagQuery == "" {
+			tagQuery = tagName(field.Tag.Get("form"))
+		}
+		tagUri := tagName(field.Tag.Get("uri"))
+		tagHeader := tagName(field.Tag.Get("header"))
+
+		fieldType := indirectType(field.Type)
+		if fieldType.Kind() == reflect.Struct && fieldType != timeType && tagQuery == "" && tagUri == "" && tagHeader == "" {
+			if field.Anonymous && tagJson == "" {
+				r.collectDepth(fieldType, visited, depth+1)
+				continue
+			}
+			if tagJson == "" || tagJson == "-" {
+				// 嵌套结构体只作为 query/uri/header 参数的容器
+				nested := newRequestFields()
+				nested.collect(fieldType, visited)
+				r.merge(nested, false)
+				continue
+			}
+		}
+
+		if tagJson != "" && tagJson != "-" {
+			r.body = append(r.body, bodyField{field: field, name: tagJson, depth: depth})
+		}
+
+		description := field.Tag.Get("description")
+		if description == "" {
+			description = field.Tag.Get("desc")
+		}
+
+		isRequired := false
+		isAllowEmpty := false
+		tagOpenApi := field.Tag.Get("openapi")
+		if tagOpenApi != "" { // required,empty
+			parts := strings.Split(tagOpenApi, ",")
+			for _, part := range parts {
+				if part == "required" {
+					isRequired = true
+				}
+				if part == "empty" {
+					isAllowEmpty = true
+				}
+			}
+		}
+
+		primitiveType := primitiveTypeOf(field.Type)
+		applyParamSchema := paramSchemaApplier(field)
+
+		if tagQuery != "" && tagQuery != "-" {
+			r.query[tagQuery] = openapi.QueryParam{
+				Description:       description,
+				Required:          isRequired,
+				AllowEmpty:        isAllowEmpty,
+				Type:              primitiveType,
+				ApplyCustomSchema: applyParamSchema,
+			}
+		}
+
+		if tagUri != "" && tagUri != "-" {
+			r.params[tagUri] = openapi.PathParam{
+				Description:       description,
+				Type:              primitiveType,
+				ApplyCustomSchema: applyParamSchema,
+			}
+		}
+
+		if tagHeader != "" && tagHeader != "-" {
+			r.header[tagHeader] = openapi.HeaderParam{
+				Description:       description,
+				Type:              primitiveType,
+				Required:          isRequired,
+				ApplyCustomSchema: applyParamSchema,
+			}
+		}
+	}
+}
+
+// bodyFields 与 encoding/json 一致，同名字段层数最浅的生效，同一层有多个时都忽略；
+// 不同 json 名的字段可能有相同的 Go 字段名，重命名后用于 reflect.StructOf
+func (r *requestFields) bodyFields() []reflect.StructField {
+	dominant := make(map[string]int, len(r.body))
+	ambiguous := make(map[string]bool)
+	for _, f := range r.body {
+		depth, ok := dominant[f.name]
+		switch {
+		case !ok || f.depth < depth:
+			dominant[f.name] = f.depth
+			ambiguous[f.name] = false
+		case f.depth == depth:
+			ambiguous[f.name] = true
+		}
+	}
+
+	fields := make([]reflect.StructField, 0, len(dominant))
+	goNames := make(map[string]bool, len(dominant))
+	for _, f := range r.body {
+		if ambiguous[f.name] || dominant[f.name] != f.depth {
+			continue
+		}
+		field := f.field
+		field.Anonymous = false
+		field.Index = nil
+		field.Offset = 0
+		for i := 2; goNames[field.Name]; i++ {
+			field.Name = f.field.Name + strconv.Itoa(i)
+		}
+		goNames[field.Name] = true
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func (r *requestFields) merge(other *requestFields, withBody bool) {
+	if withBody {
+		r.body = append(r.body, other.body...)
+	}
+	for k, v := range other.query {
+		r.query[k] = v
+	}
+	for k, v := range other.params {
+		r.params[k] = v
+	}
+	for k, v := range other.header {
+		r.header[k] = v
+	}
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func primitiveTypeOf(t reflect.Type) openapi.PrimitiveType {
+	switch indirectType(t).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openapi.PrimitiveTypeInteger
+	case reflect.Bool:
+		return openapi.PrimitiveTypeBool
+	case reflect.Float64, reflect.Float32:
+		return openapi.PrimitiveTypeFloat64
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return openapi.PrimitiveTypeString
+}
+
+// typeSchema 参数的 schema，数组对应 ?ids=1&ids=2 形式，time.Time 对应 date-time
+func typeSchema(t reflect.Type) *openapi3.Schema {
+	t = indirectType(t)
+	if t == timeType {
+		return openapi3.NewDateTimeSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openapi3.NewBytesSchema()
+		}
+		return openapi3.NewArraySchema().WithItems(typeSchema(t.Elem()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return openapi3.NewIntegerSchema()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openapi3.NewIntegerSchema().WithMin(0)
+	case reflect.Float64, reflect.Float32:
+		return openapi3.NewFloat64Schema()
+	case reflect.Bool:
+		return openapi3.NewBoolSchema()
+	}
+	return openapi3.NewStringSchema()
+}
+
+func paramSchemaApplier(field reflect.StructField) func(p *openapi3.Parameter) {
+	return func(p *openapi3.Parameter) {
+		schema := typeSchema(field.Type)
+		if p.Schema != nil && p.Schema.Value != nil {
+			schema.Pattern = p.Schema.Value.Pattern
+		}
+		applyFieldTags(field, schema)
+		p.Schema = openapi3.NewSchemaRef("", schema)
+		if schema.Example != nil {
+			p.Example = schema.Example
+		}
+		if schema.Type.Is(openapi3.TypeArray) && p.In == openapi3.ParameterInQuery {
+			explode := true
+			p.Style = openapi3.SerializationForm
+			p.Explode = &explode
+		}
+	}
+}
+
+// applyFieldTags 根据字段的 enum、example、description tag 补充 schema
+// enum:"active,disabled" example:"active"，数组字段的 enum 作用于元素，example 以逗号分隔
+func applyFieldTags(field reflect.StructField, schema *openapi3.Schema) {
+	if description := field.Tag.Get("description"); description != "" {
+		schema.Description = description
+	} else if description = field.Tag.Get("desc"); description != "" {
+		schema.Description = description
+	}
+
+	itemSchema := schema
+	if schema.Type.Is(openapi3.TypeArray) && schema.Items != nil && schema.Items.Value != nil {
+		itemSchema = schema.Items.Value
+	}
+
+	if tagEnum, ok := field.Tag.Lookup("enum"); ok && tagEnum != "" {
+		values := strings.Split(tagEnum, ",")
+		itemSchema.Enum = make([]any, 0, len(values))
+		for _, value := range values {
+			itemSchema.Enum = append(itemSchema.Enum, parseTagValue(itemSchema, strings.TrimSpace(value)))
+		}
+	}
+
+	if tagExample, ok := field.Tag.Lookup("example"); ok {
+		if itemSchema != schema {
+			values := strings.Split(tagExample, ",")
+			examples := make([]any, 0, len(values))
+			for _, value := range values {
+				examples = append(examples, parseTagValue(itemSchema, strings.TrimSpace(value)))
+			}
+			schema.Example = examples
+		} else {
+			schema.Example = parseTagValue(schema, tagExample)
+		}
+	}
+}
+
+func parseTagValue(schema *openapi3.Schema, value string) any {
+	switch {
+	case schema.Type.Is(openapi3.TypeInteger):
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case schema.Type.Is(openapi3.TypeNumber):
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case schema.Type.Is(openapi3.TypeBoolean):
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	case schema.Type.Is(openapi3.TypeObject), schema.Type.Is(openapi3.TypeArray):
+		var v any
+		if err := json.Unmarshal([]byte(value), &v); err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+// structTagSchemaApplier 作为 openapi 全局的 schema 定制，将结构体字段的 tag 应用到请求与响应体的属性上
+func structTagSchemaApplier(api *openapi.API) func(t reflect.Type, schema *openapi3.Schema) {
+	var apply func(t reflect.Type, schema *openapi3.Schema)
+	apply = func(t reflect.Type, schema *openapi3.Schema) {
+		if t.Kind() != reflect.Struct || schema.Properties == nil {
+			return
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := tagName(field.Tag.Get("json"))
+			if name == "-" {
+				continue
+			}
+			if field.Anonymous && name == "" && indirectType(field.Type).Kind() == reflect.Struct {
+				apply(indirectType(field.Type), schema)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			property, ok := schema.Properties[name]
+			if !ok || property == nil {
+				continue
+			}
+			if isAnonymousSlice(field.Type) {
+				property = sliceSchemaRef(api, field.Type)
+				schema.Properties[name] = property
+			}
+
+			// 引用类型的 schema 是共享的，只修改内联的属性
+			if property.Ref != "" || property.Value == nil {
+				continue
+			}
+			applyFieldTags(field, property.Value)
+		}
+	}
+	return apply
+}
+
+// isAnonymousSlice openapi 中未命名的切片与 interface{} 共用 AnonymousType 的名字，会得到错误的 schema
+func isAnonymousSlice(t reflect.Type) bool {
+	kind := t.Kind()
+	return (kind == reflect.Slice || kind == reflect.Array) && t.Name() == "" && t.Elem().Kind() != reflect.Uint8
+}
+
+func sliceSchemaRef(api *openapi.API, t reflect.Type) *openapi3.SchemaRef {
+	schema := openapi3.NewArraySchema().WithNullable()
+	elem := t.Elem()
+	if isAnonymousSlice(elem) {
+		schema.Items = sliceSchemaRef(api, elem)
+		return openapi3.NewSchemaRef("", schema)
+	}
+
+	name, elemSchema, err := api.RegisterModel(openapi.ModelFromType(elem))
+	switch {
+	case err != nil || elemSchema == nil:
+		schema.Items = openapi3.NewSchemaRef("", openapi3.NewObjectSchema())
+	case elemSchema.Type.Is(openapi3.TypeObject) && elemSchema.AdditionalProperties.Schema == nil, len(elemSchema.Enum) > 0:
+		schema.Items = openapi3.NewSchemaRef("#/components/schemas/"+name, nil)
+	default:
+		schema.Items = openapi3.NewSchemaRef("", elemSchema)
+	}
+
+	return openapi3.NewSchemaRef("", schema)
+}
@@ -1,12 +1,58 @@
 package httpserver
 
-import "strings"
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
 
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+//go:generate curl -fsSL --create-dirs -o openapi_ui_assets/rapidoc/rapidoc-min.js https://unpkg.com/rapidoc@9.3.8/dist/rapidoc-min.js
+//go:generate curl -fsSL --create-dirs -o openapi_ui_assets/stoplight/web-components.min.js https://unpkg.com/@stoplight/elements/web-components.min.js
+//go:generate curl -fsSL --create-dirs -o openapi_ui_assets/stoplight/styles.min.css https://unpkg.com/@stoplight/elements/styles.min.css
+//go:generate curl -fsSL --create-dirs -o openapi_ui_assets/redoc/redoc.standalone.js https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js
+
+// openapiUIAssets RapidocUI、StoplightUI 与 RedocUI 内嵌的静态资源，通过 go generate 下载到 openapi_ui_assets
+//
+//go:embed openapi_ui_assets
+var openapiUIAssets embed.FS
+
+// SwaggerUI、RapidocUI、StoplightUI 与 RedocUI 内嵌了静态资源，不依赖外网；
+// openapi_ui_assets 中缺少对应的文件时从 CDN 加载，也可以通过 WithAssets 传入业务自己 go:embed 的资源，例如：
+//
+//	//go:embed redoc
+//	var redocAssets embed.FS
+//
+//	sub, _ := fs.Sub(redocAssets, "redoc")
+//	server.RegisterOpenAPIUI("/redoc", httpserver.RedocUI.WithAssets(sub))
 var (
-	SwaggerUI   = &swaggerUIBuilder{}
-	RapidocUI   = &rapidocBuilder{}
-	StoplightUI = &stoplightElementBuilder{}
-	RedocUI     = &redocBuilder{}
+	SwaggerUI   = &swaggerUIBuilder{assets: swaggerFiles.FS}
+	RapidocUI   = &rapidocBuilder{assets: subOpenAPIUIAssets(openapiUIAssets, "rapidoc", "rapidoc-min.js")}
+	StoplightUI = &stoplightElementBuilder{assets: subOpenAPIUIAssets(openapiUIAssets, "stoplight", "web-components.min.js", "styles.min.css")}
+	RedocUI     = &redocBuilder{assets: subOpenAPIUIAssets(openapiUIAssets, "redoc", "redoc.standalone.js")}
+)
+
+// subOpenAPIUIAssets 返回 dir 下的静态资源，缺少任意一个 files 时返回 nil，页面从 CDN 加载
+func subOpenAPIUIAssets(assets fs.FS, dir string, files ...string) fs.FS {
+	sub, err := fs.Sub(assets, dir)
+	if err != nil {
+		return nil
+	}
+	for _, file := range files {
+		if _, err := fs.Stat(sub, file); err != nil {
+			return nil
+		}
+	}
+	return sub
+}
+
+var (
+	_ OpenAPIUIPageBuilder = &swaggerUIBuilder{}
+	_ OpenAPIUIPageBuilder = &rapidocBuilder{}
+	_ OpenAPIUIPageBuilder = &stoplightElementBuilder{}
+	_ OpenAPIUIPageBuilder = &redocBuilder{}
 )
 
 type OpenAPIUIBuilder interface {
@@ -14,11 +60,43 @@ type OpenAPIUIBuilder interface {
 	Doc() string
 }
 
-type swaggerUIBuilder struct {
+// OpenAPIUIPage 渲染 UI 页面的参数，spec 通过 SpecURL 单独加载，静态资源从 AssetsURL 加载
+type OpenAPIUIPage struct {
+	Title     string
+	SpecURL   string
+	AssetsURL string
 }
 
-func (s *swaggerUIBuilder) HTML(doc string, title string) string {
-	const template = `
+// OpenAPIUIPageBuilder 可选实现，不再内联 spec，Assets 不为 nil 时静态资源由服务自身提供，
+// 返回 nil 时页面从 CDN 加载
+type OpenAPIUIPageBuilder interface {
+	OpenAPIUIBuilder
+	Page(page OpenAPIUIPage) string
+	Assets() fs.FS
+}
+
+func renderOpenAPIUI(template, title, spec, assets string) string {
+	html := strings.ReplaceAll(template, "{:title}", title)
+	html = strings.ReplaceAll(html, "{:assets}", strings.TrimRight(assets, "/"))
+	html = strings.ReplaceAll(html, "{:spec}", spec)
+	return html
+}
+
+// fetchSpecExpr 页面中异步加载 spec 的表达式
+func fetchSpecExpr(specURL string) string {
+	return fmt.Sprintf("await (await fetch(%q)).json()", specURL)
+}
+
+func pageAssetsURL(page OpenAPIUIPage, cdn string) string {
+	if page.AssetsURL == "" {
+		return cdn
+	}
+	return page.AssetsURL
+}
+
+const swaggerUICDN = "https://unpkg.com/swagger-ui-dist@5.11.0"
+
+const swaggerUITemplate = `
 <!DOCTYPE html>
 <html lang="en">
   <head>
@@ -28,7 +106,7 @@ func (s *swaggerUIBuilder) HTML(doc string, title string) string {
     <title>{:title}</title>
     <link
       rel="stylesheet"
-      href="https://unpkg.com/swagger-ui-dist@5.11.0/swagger-ui.css"
+      href="{:assets}/swagger-ui.css"
     />
   </head>
   <style>
@@ -39,15 +117,15 @@ func (s *swaggerUIBuilder) HTML(doc string, title string) string {
   <body>
     <div id="swagger-ui"></div>
     <script
-      src="https://unpkg.com/swagger-ui-dist@5.11.0/swagger-ui-bundle.js"
+      src="{:assets}/swagger-ui-bundle.js"
       crossorigin
     ></script>
     <script
-      src="https://unpkg.com/swagger-ui-dist@5.11.0/swagger-ui-standalone-preset.js"
+      src="{:assets}/swagger-ui-standalone-preset.js"
       crossorigin
     ></script>
     <script>
-      window.onload = () => {
+      window.onload = async () => {
         window.ui = SwaggerUIBundle({
           spec: {:spec},
           dom_id: "#swagger-ui",
@@ -60,20 +138,35 @@ func (s *swaggerUIBuilder) HTML(doc string, title string) string {
 </html>
 `
 
-	html := strings.ReplaceAll(template, "{:title}", title)
-	html = strings.ReplaceAll(html, "{:spec}", doc)
-	return html
+type swaggerUIBuilder struct {
+	assets fs.FS
+}
+
+// WithAssets 替换内嵌的 swagger-ui 静态资源，传入 nil 时使用 CDN
+func (s *swaggerUIBuilder) WithAssets(assets fs.FS) *swaggerUIBuilder {
+	return &swaggerUIBuilder{assets: assets}
+}
+
+func (s *swaggerUIBuilder) HTML(doc string, title string) string {
+	return renderOpenAPIUI(swaggerUITemplate, title, doc, swaggerUICDN)
+}
+
+func (s *swaggerUIBuilder) Page(page OpenAPIUIPage) string {
+	return renderOpenAPIUI(swaggerUITemplate, page.Title, fetchSpecExpr(page.SpecURL), pageAssetsURL(page, swaggerUICDN))
+}
+
+func (s *swaggerUIBuilder) Assets() fs.FS {
+	return s.assets
 }
 
 func (s *swaggerUIBuilder) Doc() string {
 	return "https://swagger.io/docs/open-source-tools/swagger-ui/usage/installation/#unpkg"
 }
 
-type rapidocBuilder struct {
-}
+const rapidocCDN = "https://unpkg.com/rapidoc@9.3.8/dist"
 
-func (r *rapidocBuilder) HTML(doc string, title string) string {
-	const template = `
+// rapidocTemplate 自托管时 assets 中需要包含 rapidoc-min.js
+const rapidocTemplate = `
 <!DOCTYPE html>
 <html lang="en">
   <head>
@@ -82,7 +175,7 @@ func (r *rapidocBuilder) HTML(doc string, title string) string {
     <title>{:title}</title>
     <script
       type="module"
-      src="http://unpkg.com/rapidoc@9.3.8/dist/rapidoc-min.js"
+      src="{:assets}/rapidoc-min.js"
     ></script>
   </head>
   <style>
@@ -94,7 +187,7 @@ func (r *rapidocBuilder) HTML(doc string, title string) string {
     <rapi-doc id="thedoc"> </rapi-doc>
 
     <script>
-      document.addEventListener("DOMContentLoaded", (event) => {
+      document.addEventListener("DOMContentLoaded", async (event) => {
         let docEl = document.getElementById("thedoc");
         docEl.setAttribute("text-color", "");
         docEl.setAttribute("render-style", "read");
@@ -115,20 +208,35 @@ func (r *rapidocBuilder) HTML(doc string, title string) string {
 </html>
 `
 
-	html := strings.ReplaceAll(template, "{:title}", title)
-	html = strings.ReplaceAll(html, "{:spec}", doc)
-	return html
+type rapidocBuilder struct {
+	assets fs.FS
+}
+
+// WithAssets 使用自托管的 rapidoc 静态资源，为 nil 时从 CDN 加载
+func (r *rapidocBuilder) WithAssets(assets fs.FS) *rapidocBuilder {
+	return &rapidocBuilder{assets: assets}
+}
+
+func (r *rapidocBuilder) HTML(doc string, title string) string {
+	return renderOpenAPIUI(rapidocTemplate, title, doc, rapidocCDN)
+}
+
+func (r *rapidocBuilder) Page(page OpenAPIUIPage) string {
+	return renderOpenAPIUI(rapidocTemplate, page.Title, fetchSpecExpr(page.SpecURL), pageAssetsURL(page, rapidocCDN))
+}
+
+func (r *rapidocBuilder) Assets() fs.FS {
+	return r.assets
 }
 
 func (r *rapidocBuilder) Doc() string {
 	return "https://rapidocweb.com/examples.html"
 }
 
-type stoplightElementBuilder struct {
-}
+const stoplightElementCDN = "https://unpkg.com/@stoplight/elements"
 
-func (s *stoplightElementBuilder) HTML(doc string, title string) string {
-	const template = `
+// stoplightElementTemplate 自托管时 assets 中需要包含 web-components.min.js 与 styles.min.css
+const stoplightElementTemplate = `
   <!DOCTYPE html>
 <html lang="en">
   <head>
@@ -139,10 +247,10 @@ func (s *stoplightElementBuilder) HTML(doc string, title string) string {
     />
     <title>{:title} Document</title>
 
-    <script src="https://unpkg.com/@stoplight/elements/web-components.min.js"></script>
+    <script src="{:assets}/web-components.min.js"></script>
     <link
       rel="stylesheet"
-      href="https://unpkg.com/@stoplight/elements/styles.min.css"
+      href="{:assets}/styles.min.css"
     />
   </head>
   <body>
@@ -178,30 +286,41 @@ func (s *stoplightElementBuilder) HTML(doc string, title string) string {
   </script>
 </html>`
 
-	html := strings.ReplaceAll(template, "{:title}", title)
-	html = strings.ReplaceAll(html, "{:spec}", doc)
-	return html
+type stoplightElementBuilder struct {
+	assets fs.FS
+}
+
+// WithAssets 使用自托管的 stoplight elements 静态资源，为 nil 时从 CDN 加载
+func (s *stoplightElementBuilder) WithAssets(assets fs.FS) *stoplightElementBuilder {
+	return &stoplightElementBuilder{assets: assets}
+}
+
+func (s *stoplightElementBuilder) HTML(doc string, title string) string {
+	return renderOpenAPIUI(stoplightElementTemplate, title, doc, stoplightElementCDN)
+}
+
+func (s *stoplightElementBuilder) Page(page OpenAPIUIPage) string {
+	return renderOpenAPIUI(stoplightElementTemplate, page.Title, fetchSpecExpr(page.SpecURL), pageAssetsURL(page, stoplightElementCDN))
+}
+
+func (s *stoplightElementBuilder) Assets() fs.FS {
+	return s.assets
 }
 
 func (s *stoplightElementBuilder) Doc() string {
 	return "https://docs.stoplight.io/docs/elements/a71d7fcfefcd6-elements-in-html"
 }
 
-type redocBuilder struct {
-}
+const redocCDN = "https://cdn.redoc.ly/redoc/latest/bundles"
 
-func (r *redocBuilder) HTML(doc string, title string) string {
-	const template = `<!DOCTYPE html>
+// redocTemplate 自托管时 assets 中需要包含 redoc.standalone.js
+const redocTemplate = `<!DOCTYPE html>
 <html>
   <head>
     <title>{:title}</title>
     <!-- needed for adaptive design -->
     <meta charset="utf-8" />
     <meta name="viewport" content="width=device-width, initial-scale=1" />
-    <link
-      href="https://fonts.googleapis.com/css?family=Montserrat:300,400,700|Roboto:300,400,700"
-      rel="stylesheet"
-    />
 
     <!--
     Redoc doesn't change outer page styles
@@ -218,7 +337,7 @@ func (r *redocBuilder) HTML(doc string, title string) string {
   </head>
   <body>
     <redoc id="doc"></redoc>
-    <script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+    <script src="{:assets}/redoc.standalone.js"></script>
     <script>
       (async()=>{
         Redoc.init({:spec}, {}, document.getElementById('doc'))
@@ -228,9 +347,25 @@ func (r *redocBuilder) HTML(doc string, title string) string {
 </html>
 `
 
-	html := strings.ReplaceAll(template, "{:title}", title)
-	html = strings.ReplaceAll(html, "{:spec}", doc)
-	return html
+type redocBuilder struct {
+	assets fs.FS
+}
+
+// WithAssets 使用自托管的 redoc 静态资源，为 nil 时从 CDN 加载
+func (r *redocBuilder) WithAssets(assets fs.FS) *redocBuilder {
+	return &redocBuilder{assets: assets}
+}
+
+func (r *redocBuilder) HTML(doc string, title string) string {
+	return renderOpenAPIUI(redocTemplate, title, doc, redocCDN)
+}
+
+func (r *redocBuilder) Page(page OpenAPIUIPage) string {
+	return renderOpenAPIUI(redocTemplate, page.Title, fetchSpecExpr(page.SpecURL), pageAssetsURL(page, redocCDN))
+}
+
+func (r *redocBuilder) Assets() fs.FS {
+	return r.assets
 }
 
 func (r *redocBuilder) Doc() string {
@@ -0,0 +1,249 @@
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+// ValidationError 不符合 openapi 文档的位置，Location 为 json pointer，例如 /body/name、/query/page
+type ValidationError struct {
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// openapiValidator 使用生成的 openapi 文档校验请求与响应，版本路由使用请求命中的版本的文档
+type openapiValidator struct {
+	api      *openapi.API
+	versions *versionRegistry
+
+	mu    sync.Mutex
+	specs map[*openapi.API]*openapi3.T
+}
+
+func newOpenAPIValidator(api *openapi.API, versions *versionRegistry) *openapiValidator {
+	return &openapiValidator{api: api, versions: versions, specs: make(map[*openapi.API]*openapi3.T)}
+}
+
+// reset 注册新的路由后需要重新生成文档
+func (v *openapiValidator) reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.specs = make(map[*openapi.API]*openapi3.T)
+}
+
+func (v *openapiValidator) load(api *openapi.API) (*openapi3.T, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if spec, ok := v.specs[api]; ok {
+		return spec, nil
+	}
+
+	// 通过 loader 重新加载以解析 $ref
+	data, err := api.Json()
+	if err != nil {
+		return nil, errors.Wrap(err, "generate openapi spec err")
+	}
+	spec, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "load openapi spec err")
+	}
+	v.specs[api] = spec
+	return spec, nil
+}
+
+// route 根据 gin 的路由模板找到 operation，没有文档的路由返回 nil
+func (v *openapiValidator) route(c *gin.Context) (*routers.Route, map[string]string, error) {
+	fullPath := c.FullPath()
+	if fullPath == "" {
+		return nil, nil, nil
+	}
+	spec, err := v.load(v.api)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := fullPath
+	pathItem := spec.Paths.Value(path)
+	if pathItem == nil || pathItem.GetOperation(c.Request.Method) == nil {
+		// 版本路由只在版本的文档中
+		version, versionPath := v.versions.match(c.Request, fullPath)
+		if version == nil {
+			return nil, nil, nil
+		}
+		if spec, err = v.load(version.openapi); err != nil {
+			return nil, nil, err
+		}
+		path = versionPath
+		if pathItem = spec.Paths.Value(path); pathItem == nil {
+			return nil, nil, nil
+		}
+	}
+	operation := pathItem.GetOperation(c.Request.Method)
+	if operation == nil {
+		return nil, nil, nil
+	}
+
+	pathParams := make(map[string]string, len(c.Params))
+	for _, param := range c.Params {
+		pathParams[param.Key] = param.Value
+	}
+
+	return &routers.Route{
+		Spec:      spec,
+		Path:      path,
+		PathItem:  pathItem,
+		Method:    c.Request.Method,
+		Operation: operation,
+	}, pathParams, nil
+}
+
+// Middleware request 为 true 时拒绝不符合文档的请求，response 为 true 时记录与文档不一致的响应，建议只在开发环境开启
+func (v *openapiValidator) Middleware(request, response bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		route, pathParams, err := v.route(c)
+		if err != nil {
+			logger.WithError(err).Error(ctx, "failed to load openapi spec for validation")
+			c.Next()
+			return
+		}
+		if route == nil {
+			c.Next()
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		if request {
+			if err = openapi3filter.ValidateRequest(ctx, input); err != nil {
+				validationErrors := toValidationErrors(err)
+				logger.WithField("errors", validationErrors).Warnf(ctx, "request does not match openapi spec, uri: %s", c.Request.RequestURI)
+				body := &Body[[]ValidationError]{
+					Code:    CodeValidateRuleFailed,
+					Message: code2MessageM[CodeValidateRuleFailed],
+					Data:    validationErrors,
+				}
+				c.AbortWithStatusJSON(http.StatusBadRequest, body)
+				return
+			}
+		}
+
+		if !response {
+			c.Next()
+			return
+		}
+
+		writer := &bodyCaptureWriter{ResponseWriter: c.Writer, body: new(bytes.Buffer)}
+		c.Writer = writer
+		c.Next()
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 writer.Status(),
+			Header:                 writer.Header(),
+			Options: &openapi3filter.Options{
+				IncludeResponseStatus: true,
+				MultiError:            true,
+			},
+		}
+		responseInput.SetBodyBytes(writer.body.Bytes())
+		if err = openapi3filter.ValidateResponse(ctx, responseInput); err != nil {
+			logger.WithFields(map[string]interface{}{
+				"method": c.Request.Method,
+				"path":   route.Path,
+				"status": writer.Status(),
+				"errors": toValidationErrors(err),
+			}).Warn(ctx, "response does not match openapi spec")
+		}
+	}
+}
+
+// bodyCaptureWriter 记录响应体用于校验
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// toValidationErrors 将 openapi3filter 的错误展开为 json pointer 形式的位置
+func toValidationErrors(err error) []ValidationError {
+	// 逐层判断类型，errors.As 会跳过外层错误而丢失位置前缀
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		validationErrors := make([]ValidationError, 0, len(e))
+		for _, item := range e {
+			validationErrors = append(validationErrors, toValidationErrors(item)...)
+		}
+		return validationErrors
+	case *openapi3filter.RequestError:
+		location := "/body"
+		if e.Parameter != nil {
+			location = "/" + e.Parameter.In + "/" + escapeJSONPointer(e.Parameter.Name)
+		}
+		return prefixValidationErrors(location, e.Reason, e.Err)
+	case *openapi3filter.ResponseError:
+		return prefixValidationErrors("/body", e.Reason, e.Err)
+	case *openapi3.SchemaError:
+		location := ""
+		for _, part := range e.JSONPointer() {
+			location += "/" + escapeJSONPointer(part)
+		}
+		return []ValidationError{{Location: location, Message: e.Reason}}
+	case *openapi3filter.ParseError:
+		location := ""
+		for _, part := range e.Path() {
+			location += "/" + escapeJSONPointer(fmt.Sprint(part))
+		}
+		return []ValidationError{{Location: location, Message: e.Error()}}
+	}
+
+	return []ValidationError{{Message: err.Error()}}
+}
+
+func prefixValidationErrors(location string, reason string, err error) []ValidationError {
+	if err == nil {
+		return []ValidationError{{Location: location, Message: reason}}
+	}
+
+	validationErrors := toValidationErrors(err)
+	for i := range validationErrors {
+		validationErrors[i].Location = location + validationErrors[i].Location
+		if validationErrors[i].Message == "" {
+			validationErrors[i].Message = reason
+		}
+	}
+	return validationErrors
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultPageSize 未传 page_size 时每页的数量
+	DefaultPageSize = 20
+	// MaxPageSize page_size 的上限，超过时使用上限
+	MaxPageSize = 100
+)
+
+// OffsetPagination 基于页码的分页，嵌入到请求结构体中通过 NewHandler 绑定 ?page=2&page_size=20
+type OffsetPagination struct {
+	Page     int `form:"page" description:"页码，从 1 开始" example:"1"`
+	PageSize int `form:"page_size" description:"每页数量" example:"20"`
+}
+
+// Number 页码，小于 1 时为 1
+func (p OffsetPagination) Number() int {
+	return max(p.Page, 1)
+}
+
+// Limit 每页数量，为 0 时为 DefaultPageSize，不超过 MaxPageSize
+func (p OffsetPagination) Limit() int {
+	return pageSize(p.PageSize)
+}
+
+func (p OffsetPagination) Offset() int {
+	return (p.Number() - 1) * p.Limit()
+}
+
+// CursorPagination 基于游标的分页，cursor 为上一页响应的 next_cursor，第一页为空
+type CursorPagination struct {
+	Cursor   string `form:"cursor" description:"上一页响应的 next_cursor，第一页为空"`
+	PageSize int    `form:"page_size" description:"每页数量" example:"20"`
+}
+
+func (p CursorPagination) Limit() int {
+	return pageSize(p.PageSize)
+}
+
+// Decode 解析 EncodeCursor 生成的游标，游标为空时不修改 v
+func (p CursorPagination) Decode(v any) error {
+	if p.Cursor == "" {
+		return nil
+	}
+	return DecodeCursor(p.Cursor, v)
+}
+
+func pageSize(size int) int {
+	if size <= 0 {
+		return DefaultPageSize
+	}
+	return min(size, MaxPageSize)
+}
+
+// EncodeCursor 将最后一条记录的排序键编码为游标，例如 {"id": 42, "created_at": "..."}
+func EncodeCursor(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal cursor err")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor 解析游标，格式错误时返回 ErrorWithBadRequest，可以直接作为处理函数的错误返回
+func DecodeCursor(cursor string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return NewError(CodeBadRequest, fmt.Sprintf("invalid cursor %q", cursor)).WithStatus(http.StatusBadRequest)
+	}
+	return nil
+}
+
+// Page 列表响应的数据，offset 分页有 Total、Page，cursor 分页有 NextCursor
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// NewOffsetPage total 为符合条件的总数
+func NewOffsetPage[T any](items []T, total int64, p OffsetPagination) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return Page[T]{
+		Items:    items,
+		Total:    total,
+		Page:     p.Number(),
+		PageSize: p.Limit(),
+		HasMore:  int64(p.Offset()+len(items)) < total,
+	}
+}
+
+// NewCursorPage nextCursor 为空表示没有下一页
+func NewCursorPage[T any](items []T, nextCursor string, p CursorPagination) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return Page[T]{
+		Items:      items,
+		PageSize:   p.Limit(),
+		NextCursor: nextCursor,
+		HasMore:    nextCursor != "",
+	}
+}
+
+// Sorting 排序参数，?sort=-created_at,name 表示按 created_at 降序、name 升序
+type Sorting struct {
+	Sort string `form:"sort" description:"排序字段，逗号分隔，- 前缀表示降序" example:"-created_at,name"`
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+var fieldNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Parse 解析排序字段，fields 为允许排序的字段，为空时允许任意合法的字段名，不允许的字段返回 ErrorWithBadRequest
+func (s Sorting) Parse(fields ...string) ([]SortField, error) {
+	if strings.TrimSpace(s.Sort) == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s.Sort, ",")
+	sorts := make([]SortField, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		sort := SortField{Field: strings.TrimLeft(part, "+-"), Desc: strings.HasPrefix(part, "-")}
+		if !fieldNameRegexp.MatchString(sort.Field) || (len(fields) > 0 && !slices.Contains(fields, sort.Field)) {
+			return nil, NewError(CodeBadRequest, fmt.Sprintf("invalid sort field %q", part)).WithStatus(http.StatusBadRequest)
+		}
+		sorts = append(sorts, sort)
+	}
+	return sorts, nil
+}
@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/email"
+	"github.com/ihezebin/olympus/httpclient"
+)
+
+// PanicReport 上报的 panic 信息，Count 为去重窗口内发生的次数
+type PanicReport struct {
+	Service   string    `json:"service"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route"`
+	TraceID   string    `json:"trace_id"`
+	RequestID string    `json:"request_id"`
+	Panic     string    `json:"panic"`
+	Stack     []string  `json:"stack"`
+	Time      time.Time `json:"time"`
+	Count     int       `json:"count"`
+}
+
+// PanicReporter 上报 panic，在单独的 goroutine 中调用
+type PanicReporter interface {
+	Report(ctx context.Context, report *PanicReport) error
+}
+
+type PanicReporterFunc func(ctx context.Context, report *PanicReport) error
+
+func (f PanicReporterFunc) Report(ctx context.Context, report *PanicReport) error {
+	return f(ctx, report)
+}
+
+// NewWebhookPanicReporter 以 json 格式 POST PanicReport 到 url
+func NewWebhookPanicReporter(url string) PanicReporter {
+	return PanicReporterFunc(func(ctx context.Context, report *PanicReport) error {
+		resp, err := httpclient.NewRequest(ctx).SetBody(report).Post(url)
+		if err != nil {
+			return errors.Wrap(err, "post panic webhook err")
+		}
+		if resp.IsError() {
+			return errors.Errorf("post panic webhook err, status: %d, body: %s", resp.StatusCode(), resp.String())
+		}
+		return nil
+	})
+}
+
+// NewEmailPanicReporter 发送邮件告警
+func NewEmailPanicReporter(client *email.Client, receivers ...string) PanicReporter {
+	return PanicReporterFunc(func(ctx context.Context, report *PanicReport) error {
+		title := fmt.Sprintf("[%s] panic: %s %s", report.Service, report.Method, report.Route)
+		text := fmt.Sprintf("time: %s\ncount: %d\npath: %s\ntrace_id: %s\nrequest_id: %s\npanic: %s\n\n%s",
+			report.Time.Format(time.RFC3339), report.Count, report.Path, report.TraceID, report.RequestID, report.Panic, strings.Join(report.Stack, "\n"))
+		message := email.NewMessage().WithReceiver(receivers...).WithTitle(title).WithText(text)
+		if err := client.Send(ctx, message); err != nil {
+			return errors.Wrap(err, "send panic email err")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,540 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+// Proxy 将 router 的 prefix 下的所有请求转发到 upstream，prefix 不能为空或 /；
+// 配置错误时不注册路由并返回错误，错误同时由 RegisterRoutes 返回
+//
+//	httpserver.Proxy(router, "/legacy", WithProxyUpstreams("http://10.0.0.1:8080", "http://10.0.0.2:8080"),
+//		WithProxyBalancer(ProxyBalancerLeastConn), WithProxyHealthCheck("/health", 5*time.Second), WithProxyRetries(1))
+func Proxy(router Router, prefix string, opts ...ProxyOption) error {
+	r, err := openapiRouterOf(router)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	options := mergeProxyOptions(opts...)
+
+	parent, routePrefix := r, r.mergePath("/", prefix)
+	if r.version != nil {
+		// 版本路由只支持通过路径区分版本
+		if r.version.options.Strategy&VersionStrategyPath == 0 {
+			return r.errs.add(errors.Errorf("proxy %s in api version %s requires VersionStrategyPath", prefix, r.version.name))
+		}
+		parent = r.versionParent
+		routePrefix = r.mergePath("/", r.version.name, r.versionPath, prefix)
+	}
+	routePrefix = strings.TrimRight(routePrefix, "/")
+	if routePrefix == "" {
+		return r.errs.add(errors.New("proxy prefix can not be empty"))
+	}
+	fullPrefix := strings.TrimRight(r.mergePath("/", parent.prefix, routePrefix), "/")
+
+	p, err := newProxy(fullPrefix, options)
+	if err != nil {
+		return r.errs.add(errors.Wrapf(err, "failed to create proxy for %s", fullPrefix))
+	}
+	r.proxies.add(p)
+
+	handlers := make([]gin.HandlerFunc, 0, len(r.options.PreMiddlewares)+len(r.options.PostMiddlewares)+1)
+	handlers = append(handlers, r.options.PreMiddlewares...)
+	handlers = append(handlers, p.handle)
+	handlers = append(handlers, r.options.PostMiddlewares...)
+	parent.ginRouter.Any(routePrefix, handlers...)
+	parent.ginRouter.Any(routePrefix+"/*path", handlers...)
+
+	spec := options.OpenAPISpec
+	if spec == nil && options.OpenAPISpecPath != "" {
+		if spec, err = p.fetchSpec(ctx, options.OpenAPISpecPath); err != nil {
+			logger.WithError(err).Warnf(ctx, "failed to fetch openapi spec of proxy %s", fullPrefix)
+		}
+	}
+	if spec != nil {
+		documentProxy(r.openapi, fullPrefix, spec, r.options.OpenAPIOptions, options.OpenAPIOptions)
+	}
+	return nil
+}
+
+// proxy 一个 prefix 对应的 upstream 池
+type proxy struct {
+	prefix       string
+	options      *ProxyOptions
+	upstreams    []*upstream
+	counter      atomic.Uint64
+	reverseProxy *httputil.ReverseProxy
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+type upstream struct {
+	url     *url.URL
+	active  atomic.Int64
+	healthy atomic.Bool
+}
+
+// proxyTracer 每次从全局获取，服务重新设置 TracerProvider 后仍然生效
+func proxyTracer() trace.Tracer {
+	return otel.Tracer("github.com/ihezebin/olympus/httpserver/proxy")
+}
+
+func newProxy(prefix string, options *ProxyOptions) (*proxy, error) {
+	if len(options.Upstreams) == 0 {
+		return nil, errors.New("proxy has no upstream")
+	}
+
+	p := &proxy{
+		prefix:    prefix,
+		options:   options,
+		upstreams: make([]*upstream, 0, len(options.Upstreams)),
+		done:      make(chan struct{}),
+	}
+	for _, raw := range options.Upstreams {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("invalid upstream: %s", raw)
+		}
+		item := &upstream{url: u}
+		item.healthy.Store(true)
+		p.upstreams = append(p.upstreams, item)
+	}
+
+	p.reverseProxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		Transport:    p,
+		ErrorHandler: p.errorHandler,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	if options.HealthCheckPath != "" {
+		go p.healthCheck(ctx)
+	} else {
+		close(p.done)
+	}
+
+	return p, nil
+}
+
+func (p *proxy) handle(c *gin.Context) {
+	for key, values := range p.options.Header {
+		c.Request.Header[key] = values
+	}
+	if p.options.HeaderFunc != nil {
+		p.options.HeaderFunc(c, c.Request.Header)
+	}
+	// gin 的 CloseNotify 在底层 writer 不支持时会 panic，客户端断开通过请求的 context 感知
+	p.reverseProxy.ServeHTTP(proxyWriter{ResponseWriter: c.Writer}, c.Request)
+}
+
+// proxyWriter 隐藏 http.CloseNotifier，Flush 等通过 Unwrap 由 http.ResponseController 获取
+type proxyWriter struct {
+	http.ResponseWriter
+}
+
+func (w proxyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// rewrite 只改写路径，upstream 在 RoundTrip 中选择
+func (p *proxy) rewrite(pr *httputil.ProxyRequest) {
+	path := pr.In.URL.Path
+	if !p.options.KeepPrefix {
+		path = strings.TrimPrefix(path, p.prefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	if p.options.Rewrite != nil {
+		path = p.options.Rewrite(path)
+	}
+	pr.Out.URL.Path = path
+	pr.Out.URL.RawPath = ""
+	pr.SetXForwarded()
+}
+
+func (p *proxy) errorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		// 客户端已经断开
+		return
+	}
+	logger.WithError(err).Errorf(req.Context(), "failed to proxy request, uri: %s", req.RequestURI)
+
+	body := &Body[EmptyType]{}
+	body.WithErr(ErrorWithBadGateway())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(body.status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// RoundTrip 选择 upstream 转发，幂等请求失败时更换 upstream 重试
+func (p *proxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	retries := 0
+	if isIdempotentMethod(req.Method) {
+		retries = p.options.Retries
+	}
+	var body []byte
+	if retries > 0 && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "read request body err")
+		}
+	}
+
+	tried := make(map[*upstream]bool, len(p.upstreams))
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		target := p.next(tried)
+		tried[target] = true
+
+		out := req.Clone(ctx)
+		out.URL.Scheme = target.url.Scheme
+		out.URL.Host = target.url.Host
+		out.URL.Path = joinURLPath(target.url.Path, req.URL.Path)
+		out.Host = target.url.Host
+		if target.url.RawQuery != "" && req.URL.RawQuery != "" {
+			out.URL.RawQuery = target.url.RawQuery + "&" + req.URL.RawQuery
+		} else if target.url.RawQuery != "" {
+			out.URL.RawQuery = target.url.RawQuery
+		}
+		if body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+			out.ContentLength = int64(len(body))
+		}
+
+		resp, err := p.roundTrip(out, target, attempt)
+		if err == nil {
+			if attempt == retries || !isRetryableStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			_ = resp.Body.Close()
+			lastErr = errors.Errorf("upstream %s responded %d", target.url.Host, resp.StatusCode)
+		} else {
+			lastErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if attempt < retries {
+			logger.WithError(lastErr).Warnf(ctx, "retry proxy request, uri: %s, attempt: %d", req.RequestURI, attempt+1)
+		}
+	}
+
+	return nil, lastErr
+}
+
+// roundTrip 每次转发一个 span，并向 upstream 传递 trace context
+func (p *proxy) roundTrip(req *http.Request, target *upstream, attempt int) (*http.Response, error) {
+	ctx, span := proxyTracer().Start(req.Context(), "proxy "+req.Method+" "+p.prefix,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("proxy.upstream", target.url.Host),
+			attribute.Int("proxy.attempt", attempt),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	target.active.Add(1)
+	resp, err := p.options.Transport.RoundTrip(req)
+	if err != nil {
+		target.active.Add(-1)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &upstreamBody{ReadCloser: resp.Body, done: func() {
+		target.active.Add(-1)
+		span.End()
+	}}
+	return resp, nil
+}
+
+// upstreamBody 响应体关闭后才算连接结束
+type upstreamBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *upstreamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// next 优先选择健康且本次请求没有尝试过的 upstream
+func (p *proxy) next(tried map[*upstream]bool) *upstream {
+	candidates := make([]*upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if u.healthy.Load() && !tried[u] {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, u := range p.upstreams {
+			if u.healthy.Load() {
+				candidates = append(candidates, u)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.upstreams
+	}
+
+	offset := p.counter.Add(1)
+	if p.options.Balancer == ProxyBalancerLeastConn {
+		// 连接数相同时从轮询位置开始选择，避免总是选中第一个
+		var selected *upstream
+		for i := range candidates {
+			u := candidates[(int(offset)+i)%len(candidates)]
+			if selected == nil || u.active.Load() < selected.active.Load() {
+				selected = u
+			}
+		}
+		return selected
+	}
+	return candidates[int(offset%uint64(len(candidates)))]
+}
+
+func (p *proxy) healthCheck(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(p.options.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, u := range p.upstreams {
+			healthy := p.check(ctx, u)
+			if u.healthy.Swap(healthy) != healthy && ctx.Err() == nil {
+				logger.WithField("healthy", healthy).Warnf(ctx, "proxy %s upstream %s health changed", p.prefix, u.url.Host)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *proxy) check(ctx context.Context, u *upstream) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.options.HealthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url.ResolveReference(&url.URL{Path: joinURLPath(u.url.Path, p.options.HealthCheckPath)}).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.options.Transport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode < http.StatusBadRequest
+}
+
+// fetchSpec 从第一个可用的 upstream 获取 openapi 文档
+func (p *proxy) fetchSpec(ctx context.Context, specPath string) (*openapi3.T, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var lastErr error
+	for _, u := range p.upstreams {
+		specURL := u.url.ResolveReference(&url.URL{Path: joinURLPath(u.url.Path, specPath)}).String()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, specURL, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "new request %s err", specURL)
+		}
+		resp, err := p.options.Transport.RoundTrip(req)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "get %s err", specURL)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			lastErr = errors.Errorf("get %s err, status: %d", specURL, resp.StatusCode)
+			continue
+		}
+		spec, err := openapi3.NewLoader().LoadFromData(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "load openapi spec from %s err", specURL)
+		}
+		return spec, nil
+	}
+	return nil, lastErr
+}
+
+// close 停止健康检查
+func (p *proxy) close(ctx context.Context) error {
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// proxyRegistry 服务关闭时停止所有 proxy 的健康检查
+type proxyRegistry struct {
+	mu      sync.Mutex
+	proxies []*proxy
+}
+
+func (registry *proxyRegistry) add(p *proxy) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.proxies = append(registry.proxies, p)
+}
+
+func (registry *proxyRegistry) Close(ctx context.Context) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, p := range registry.proxies {
+		if err := p.close(ctx); err != nil {
+			return errors.Wrapf(err, "close proxy %s err", p.prefix)
+		}
+	}
+	return nil
+}
+
+var openapiPathParamRegexp = regexp.MustCompile(`\{([^}]+)\}`)
+
+// documentProxy 根据 upstream 的文档描述转发的接口，路径为 prefix 加上 upstream 的路径，请求与响应体不展开
+func documentProxy(api *openapi.API, prefix string, spec *openapi3.T, groupOptions OpenAPIOptions, proxyOptions OpenAPIOptions) {
+	if spec.Paths == nil {
+		return
+	}
+	for upstreamPath, pathItem := range spec.Paths.Map() {
+		// 与 gin 的路由格式保持一致
+		path := prefix + openapiPathParamRegexp.ReplaceAllString(upstreamPath, ":$1")
+		for method, operation := range pathItem.Operations() {
+			route := api.Route(method, path)
+			route.HasSummary(operation.Summary)
+			route.HasDescription(strings.TrimSpace(operation.Description + "\n\n转发到 upstream 的 " + method + " " + upstreamPath))
+			route.HasTags(operation.Tags)
+			route.HasDeprecated(operation.Deprecated)
+			operationID := strings.Trim(strings.ReplaceAll(path, "/", "_"), "_")
+			route.HasOperationID(method + "_" + operationID)
+
+			parameters := append(append(openapi3.Parameters{}, pathItem.Parameters...), operation.Parameters...)
+			for _, ref := range parameters {
+				documentProxyParameter(route, ref.Value)
+			}
+
+			if operation.RequestBody != nil {
+				route.HasRequestModel(openapi.ModelOf[map[string]any]())
+			}
+			if operation.Responses != nil {
+				for status := range operation.Responses.Map() {
+					var code int
+					if _, err := fmt.Sscanf(status, "%d", &code); err == nil {
+						route.HasResponseModel(code, openapi.ModelOf[map[string]any]())
+					}
+				}
+			}
+			route.HasResponseModel(http.StatusBadGateway, openapi.ModelOf[Body[EmptyType]]())
+			mergeOpenAPIOptions(route, groupOptions...)
+			mergeOpenAPIOptions(route, proxyOptions...)
+		}
+	}
+}
+
+func documentProxyParameter(route *openapi.Route, parameter *openapi3.Parameter) {
+	if parameter == nil {
+		return
+	}
+	primitive := openapi.PrimitiveTypeString
+	var applySchema func(*openapi3.Parameter)
+	if parameter.Schema != nil && parameter.Schema.Value != nil {
+		schema := parameter.Schema.Value
+		switch {
+		case schema.Type.Is(openapi3.TypeInteger):
+			primitive = openapi.PrimitiveTypeInteger
+		case schema.Type.Is(openapi3.TypeNumber):
+			primitive = openapi.PrimitiveTypeFloat64
+		case schema.Type.Is(openapi3.TypeBoolean):
+			primitive = openapi.PrimitiveTypeBool
+		}
+		applySchema = func(p *openapi3.Parameter) {
+			p.Schema.Value.Enum = schema.Enum
+			p.Schema.Value.Format = schema.Format
+			p.Schema.Value.Default = schema.Default
+		}
+	}
+
+	switch parameter.In {
+	case openapi3.ParameterInQuery:
+		route.HasQueryParameter(parameter.Name, openapi.QueryParam{
+			Description:       parameter.Description,
+			Required:          parameter.Required,
+			AllowEmpty:        parameter.AllowEmptyValue,
+			Type:              primitive,
+			ApplyCustomSchema: applySchema,
+		})
+	case openapi3.ParameterInHeader:
+		route.HasHeaderParameter(parameter.Name, openapi.HeaderParam{
+			Description:       parameter.Description,
+			Required:          parameter.Required,
+			Type:              primitive,
+			ApplyCustomSchema: applySchema,
+		})
+	}
+}
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func joinURLPath(base, path string) string {
+	if base == "" || base == "/" {
+		return path
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,141 @@
+package httpserver
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyBalancer upstream 负载均衡策略
+type ProxyBalancer int
+
+const (
+	// ProxyBalancerRoundRobin 轮询
+	ProxyBalancerRoundRobin ProxyBalancer = iota
+	// ProxyBalancerLeastConn 最少连接数
+	ProxyBalancerLeastConn
+)
+
+type ProxyOptions struct {
+	// Upstreams upstream 地址，例如 http://10.0.0.1:8080/api，path 会作为转发路径的前缀
+	Upstreams []string
+	Balancer  ProxyBalancer
+	// HealthCheckPath 不为空时定期请求 upstream，响应非 2xx/3xx 的 upstream 不参与负载均衡，全部不健康时仍然转发
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	// KeepPrefix 为 true 时转发的路径保留 prefix，默认去掉
+	KeepPrefix bool
+	// Rewrite 改写转发的路径，在去掉 prefix 之后执行
+	Rewrite func(path string) string
+	// Header 转发时设置的请求头，HeaderFunc 可以根据请求设置
+	Header     http.Header
+	HeaderFunc func(c *gin.Context, header http.Header)
+	// Retries 幂等请求连接失败或 upstream 响应 502/503/504 时，更换 upstream 重试的次数
+	Retries   int
+	Transport http.RoundTripper
+	// OpenAPISpecPath 注册时从 upstream 获取 openapi 文档，OpenAPISpec 直接指定文档，用于在服务的文档中描述转发的接口
+	OpenAPISpecPath string
+	OpenAPISpec     *openapi3.T
+	OpenAPIOptions  OpenAPIOptions
+}
+
+type ProxyOption func(*ProxyOptions)
+
+func mergeProxyOptions(opts ...ProxyOption) *ProxyOptions {
+	options := &ProxyOptions{
+		Balancer:            ProxyBalancerRoundRobin,
+		HealthCheckInterval: 10 * time.Second,
+		HealthCheckTimeout:  2 * time.Second,
+		Header:              http.Header{},
+		Transport:           http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+func WithProxyUpstreams(upstreams ...string) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.Upstreams = append(options.Upstreams, upstreams...)
+	}
+}
+
+func WithProxyBalancer(balancer ProxyBalancer) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.Balancer = balancer
+	}
+}
+
+// WithProxyHealthCheck 每 interval 请求一次 upstream 的 path
+func WithProxyHealthCheck(path string, interval time.Duration) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.HealthCheckPath = path
+		if interval > 0 {
+			options.HealthCheckInterval = interval
+		}
+	}
+}
+
+func WithProxyKeepPrefix() ProxyOption {
+	return func(options *ProxyOptions) {
+		options.KeepPrefix = true
+	}
+}
+
+// WithProxyRewrite 使用正则改写转发的路径，例如 WithProxyRewrite("^/v1/(.*)", "/api/$1")
+func WithProxyRewrite(pattern string, replacement string) ProxyOption {
+	re := regexp.MustCompile(pattern)
+	return WithProxyRewriteFunc(func(path string) string {
+		return re.ReplaceAllString(path, replacement)
+	})
+}
+
+func WithProxyRewriteFunc(rewrite func(path string) string) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.Rewrite = rewrite
+	}
+}
+
+func WithProxyHeader(key, value string) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.Header.Set(key, value)
+	}
+}
+
+func WithProxyHeaderFunc(f func(c *gin.Context, header http.Header)) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.HeaderFunc = f
+	}
+}
+
+func WithProxyRetries(retries int) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.Retries = retries
+	}
+}
+
+func WithProxyTransport(transport http.RoundTripper) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.Transport = transport
+	}
+}
+
+// WithProxyOpenAPI 注册时从 upstream 的 specPath 获取文档，转发的接口会出现在服务的文档中
+func WithProxyOpenAPI(specPath string, opts ...OpenAPIOption) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.OpenAPISpecPath = specPath
+		options.OpenAPIOptions = append(options.OpenAPIOptions, opts...)
+	}
+}
+
+func WithProxyOpenAPISpec(spec *openapi3.T, opts ...OpenAPIOption) ProxyOption {
+	return func(options *ProxyOptions) {
+		options.OpenAPISpec = spec
+		options.OpenAPIOptions = append(options.OpenAPIOptions, opts...)
+	}
+}
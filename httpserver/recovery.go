@@ -0,0 +1,254 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/requestid"
+)
+
+type RecoveryOptions struct {
+	Reporters []PanicReporter
+	// DedupWindow 相同路由相同 panic 在窗口内只上报一次，下一次上报时带上期间发生的次数
+	DedupWindow time.Duration
+	// RateLimit 每个 RateInterval 内最多上报的次数，小于等于 0 表示不限制
+	RateLimit    int
+	RateInterval time.Duration
+	// ReportTimeout 单次上报的超时时间
+	ReportTimeout time.Duration
+}
+
+type RecoveryOption func(*RecoveryOptions)
+
+func mergeRecoveryOptions(opts ...RecoveryOption) *RecoveryOptions {
+	opt := &RecoveryOptions{
+		DedupWindow:   5 * time.Minute,
+		RateLimit:     10,
+		RateInterval:  time.Minute,
+		ReportTimeout: 10 * time.Second,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+// WithPanicReporters 设置 panic 上报，例如 NewWebhookPanicReporter、NewEmailPanicReporter
+func WithPanicReporters(reporters ...PanicReporter) RecoveryOption {
+	return func(o *RecoveryOptions) {
+		o.Reporters = append(o.Reporters, reporters...)
+	}
+}
+
+func WithPanicDedupWindow(window time.Duration) RecoveryOption {
+	return func(o *RecoveryOptions) {
+		o.DedupWindow = window
+	}
+}
+
+func WithPanicRateLimit(limit int, interval time.Duration) RecoveryOption {
+	return func(o *RecoveryOptions) {
+		o.RateLimit = limit
+		o.RateInterval = interval
+	}
+}
+
+func WithPanicReportTimeout(timeout time.Duration) RecoveryOption {
+	return func(o *RecoveryOptions) {
+		o.ReportTimeout = timeout
+	}
+}
+
+// Recovery 捕获 panic 返回 CodeInternalServerError，记录日志与 span 并上报；客户端断开连接导致的 panic 只记录 warn 日志，
+// http.ErrAbortHandler 记录 span 后继续 panic。
+// 服务默认在 otel 中间件之后注册，通过 WithRecovery 设置上报
+func Recovery(opts ...RecoveryOption) gin.HandlerFunc {
+	options := mergeRecoveryOptions(opts...)
+	reporter := newPanicDispatcher(options)
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			ctx := c.Request.Context()
+
+			// http.ErrAbortHandler 用于中断连接，例如 httputil.ReverseProxy 复制响应失败，
+			// 记录 span 后继续 panic，由 net/http 中断连接，避免客户端收到被截断的成功响应
+			if r == http.ErrAbortHandler {
+				span := trace.SpanFromContext(ctx)
+				span.RecordError(http.ErrAbortHandler)
+				span.SetStatus(codes.Error, http.ErrAbortHandler.Error())
+				logger.Warnf(ctx, "handler aborted: %s %s", c.Request.Method, c.Request.URL.Path)
+				panic(r)
+			}
+			if err, ok := r.(error); ok && isBrokenConnection(err) {
+				logger.WithError(err).Warnf(ctx, "client connection broken: %s %s", c.Request.Method, c.Request.URL.Path)
+				_ = c.Error(err)
+				c.Abort()
+				return
+			}
+
+			stack := PanicStack()
+			logger.WithFields(map[string]interface{}{
+				"panic": fmt.Sprintf("%v", r),
+				"stack": stack,
+			}).Errorf(ctx, "panic recovered: %s %s", c.Request.Method, c.Request.URL.Path)
+
+			span := trace.SpanFromContext(ctx)
+			span.RecordError(fmt.Errorf("panic: %v", r), trace.WithAttributes(
+				attribute.String("exception.stacktrace", strings.Join(stack, "\n")),
+			))
+			span.SetStatus(codes.Error, fmt.Sprintf("panic: %v", r))
+
+			reporter.report(ctx, &PanicReport{
+				Service:   c.GetString(ServiceNameKey),
+				Method:    c.Request.Method,
+				Path:      c.Request.URL.Path,
+				Route:     c.FullPath(),
+				TraceID:   span.SpanContext().TraceID().String(),
+				RequestID: requestid.FromContext(ctx),
+				Panic:     fmt.Sprintf("%v", r),
+				Stack:     stack,
+				Time:      time.Now(),
+				Count:     1,
+			})
+
+			// 已经写出响应头时无法再修改响应
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			body := &Body[EmptyType]{}
+			body.WithErr(ErrorWithInternalServer())
+			c.AbortWithStatusJSON(body.status, body)
+		}()
+		c.Next()
+	}
+}
+
+// isBrokenConnection 客户端断开连接，例如 broken pipe、connection reset by peer
+func isBrokenConnection(err error) bool {
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		msg := strings.ToLower(opErr.Error())
+		return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+	}
+	return false
+}
+
+// PanicStack 从 panic 发生处开始的调用栈，每帧一行，在 recover 所在的 defer 中调用，
+// GraphQL、异步任务与 grpcserver 恢复 panic 时使用，日志中的 stack 字段与 Recovery 保持一致
+func PanicStack() []string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := make([]string, 0, n)
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			stack = stack[:0]
+		} else {
+			stack = append(stack, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// panicDispatcher 去重与限流后异步调用 reporter
+type panicDispatcher struct {
+	options *RecoveryOptions
+	mu      sync.Mutex
+	// seen key 为路由与 panic，记录窗口开始时间与窗口内被抑制的次数
+	seen        map[string]*panicSeen
+	windowStart time.Time
+	windowCount int
+}
+
+type panicSeen struct {
+	first      time.Time
+	suppressed int
+}
+
+func newPanicDispatcher(options *RecoveryOptions) *panicDispatcher {
+	return &panicDispatcher{options: options, seen: make(map[string]*panicSeen)}
+}
+
+func (d *panicDispatcher) report(ctx context.Context, report *PanicReport) {
+	if len(d.options.Reporters) == 0 || !d.allow(report) {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for _, reporter := range d.options.Reporters {
+		go func(reporter PanicReporter) {
+			ctx, cancel := context.WithTimeout(ctx, d.options.ReportTimeout)
+			defer cancel()
+			if err := reporter.Report(ctx, report); err != nil {
+				logger.WithError(err).Error(ctx, "report panic err")
+			}
+		}(reporter)
+	}
+}
+
+func (d *panicDispatcher) allow(report *PanicReport) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := report.Time
+	key := report.Method + " " + report.Route + " " + report.Panic
+	if d.options.DedupWindow > 0 {
+		if seen, ok := d.seen[key]; ok && now.Sub(seen.first) < d.options.DedupWindow {
+			seen.suppressed++
+			return false
+		} else if ok {
+			report.Count += seen.suppressed
+		}
+		d.seen[key] = &panicSeen{first: now}
+		d.prune(now)
+	}
+
+	if d.options.RateLimit > 0 {
+		if now.Sub(d.windowStart) >= d.options.RateInterval {
+			d.windowStart = now
+			d.windowCount = 0
+		}
+		if d.windowCount >= d.options.RateLimit {
+			return false
+		}
+		d.windowCount++
+	}
+	return true
+}
+
+// prune 清理过期的去重记录，避免不同 panic 过多时占用内存
+func (d *panicDispatcher) prune(now time.Time) {
+	if len(d.seen) < 1024 {
+		return
+	}
+	for key, seen := range d.seen {
+		if now.Sub(seen.first) >= d.options.DedupWindow {
+			delete(d.seen, key)
+		}
+	}
+}
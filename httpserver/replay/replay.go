@@ -0,0 +1,363 @@
+// Package replay 将 middleware.Recorder 录制的请求回放到本地服务，并比较响应与录制时的差异
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/httpserver/middleware"
+)
+
+// redacted 录制时脱敏的值，比较时跳过
+const redacted = "***"
+
+type Options struct {
+	Client *http.Client
+	// Headers 覆盖录制的 header，例如本地环境的 Authorization，录制时 Authorization 已经脱敏
+	Headers http.Header
+	// IgnoreJSONPaths 不比较的 json 字段，例如 data.updated_at、items.*.id，..request_id 表示任意层级的 request_id
+	IgnoreJSONPaths []string
+}
+
+type Option func(*Options)
+
+func mergeOptions(opts ...Option) *Options {
+	opt := &Options{
+		Client:  http.DefaultClient,
+		Headers: http.Header{},
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithClient(client *http.Client) Option {
+	return func(o *Options) {
+		o.Client = client
+	}
+}
+
+func WithHeader(key, value string) Option {
+	return func(o *Options) {
+		o.Headers.Set(key, value)
+	}
+}
+
+func WithIgnoreJSONPaths(paths ...string) Option {
+	return func(o *Options) {
+		o.IgnoreJSONPaths = append(o.IgnoreJSONPaths, paths...)
+	}
+}
+
+// Difference 回放的响应与录制时的一处差异
+type Difference struct {
+	// Path 差异所在位置，status 为状态码，body 为非 json 的响应体，其余为 json 字段，例如 data.items.0.name
+	Path     string `json:"path"`
+	Expected any    `json:"expected"`
+	Actual   any    `json:"actual"`
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: expected %v, actual %v", d.Path, format(d.Expected), format(d.Actual))
+}
+
+type Result struct {
+	Entry       middleware.HAREntry `json:"entry"`
+	Status      int                 `json:"status"`
+	Body        string              `json:"body"`
+	Differences []Difference        `json:"differences"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// Passed 请求成功且响应与录制时一致
+func (r Result) Passed() bool {
+	return r.Error == "" && len(r.Differences) == 0
+}
+
+func (r Result) String() string {
+	target := fmt.Sprintf("%s %s", r.Entry.Request.Method, r.Entry.Request.URL)
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("ERROR %s: %s", target, r.Error)
+	case len(r.Differences) > 0:
+		lines := make([]string, 0, len(r.Differences)+1)
+		lines = append(lines, "FAIL "+target)
+		for _, difference := range r.Differences {
+			lines = append(lines, "  "+difference.String())
+		}
+		return strings.Join(lines, "\n")
+	}
+	return "PASS " + target
+}
+
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+func (r *Report) Failed() []Result {
+	results := make([]Result, 0)
+	for _, result := range r.Results {
+		if !result.Passed() {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Load 读取录制，支持 NewFileRecordWriter 写入的 json lines 与浏览器导出的 HAR 文件
+func Load(reader io.Reader) ([]middleware.HAREntry, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "read records err")
+	}
+	har := struct {
+		Log *struct {
+			Entries []middleware.HAREntry `json:"entries"`
+		} `json:"log"`
+	}{}
+	if err = json.Unmarshal(data, &har); err == nil && har.Log != nil {
+		return har.Log.Entries, nil
+	}
+
+	entries := make([]middleware.HAREntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := middleware.HAREntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal record at line %d err", line)
+		}
+		entries = append(entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scan records err")
+	}
+	return entries, nil
+}
+
+func LoadFile(path string) ([]middleware.HAREntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open records %s err", path)
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Replay 按顺序将录制的请求发送到 target，例如 http://localhost:8080，并比较状态码与响应体
+func Replay(ctx context.Context, target string, entries []middleware.HAREntry, opts ...Option) (*Report, error) {
+	options := mergeOptions(opts...)
+	base, err := url.Parse(strings.TrimRight(target, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse target %s err", target)
+	}
+
+	report := &Report{Results: make([]Result, 0, len(entries))}
+	for _, entry := range entries {
+		result := Result{Entry: entry, Differences: make([]Difference, 0)}
+		status, body, err := send(ctx, options, base, entry)
+		if err != nil {
+			result.Error = err.Error()
+			report.Results = append(report.Results, result)
+			continue
+		}
+		result.Status, result.Body = status, string(body)
+		result.Differences = compare(entry, status, body, options.IgnoreJSONPaths)
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// skipHeaders 不回放的 header，Accept-Encoding 避免响应被压缩后无法比较
+var skipHeaders = map[string]struct{}{
+	"Host": {}, "Content-Length": {}, "Connection": {}, "Accept-Encoding": {}, "Transfer-Encoding": {}, "Keep-Alive": {}, "Upgrade": {},
+}
+
+func send(ctx context.Context, options *Options, base *url.URL, entry middleware.HAREntry) (int, []byte, error) {
+	recorded, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "parse url %s err", entry.Request.URL)
+	}
+	target := *base
+	target.Path = base.Path + recorded.Path
+	target.RawQuery = recorded.RawQuery
+
+	var body io.Reader
+	if entry.Request.PostData != nil {
+		body = strings.NewReader(entry.Request.PostData.Text)
+	}
+	req, err := http.NewRequestWithContext(ctx, entry.Request.Method, target.String(), body)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "new request err")
+	}
+	for _, header := range entry.Request.Headers {
+		if _, ok := skipHeaders[http.CanonicalHeaderKey(header.Name)]; ok || header.Value == redacted {
+			continue
+		}
+		req.Header.Add(header.Name, header.Value)
+	}
+	for key, values := range options.Headers {
+		req.Header[key] = values
+	}
+
+	resp, err := options.Client.Do(req)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "send request err")
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "read response err")
+	}
+	return resp.StatusCode, data, nil
+}
+
+// compare 录制被截断或不是文本时只比较状态码
+func compare(entry middleware.HAREntry, status int, body []byte, ignorePaths []string) []Difference {
+	differences := make([]Difference, 0)
+	if status != entry.Response.Status {
+		differences = append(differences, Difference{Path: "status", Expected: entry.Response.Status, Actual: status})
+	}
+	if entry.Truncated {
+		return differences
+	}
+
+	mimeType := entry.Response.Content.MimeType
+	expected := entry.Response.Content.Text
+	switch {
+	case strings.Contains(mimeType, "json"):
+		var expectedValue, actualValue any
+		if decode([]byte(expected), &expectedValue) == nil && decode(body, &actualValue) == nil {
+			return compareJSON(differences, "", expectedValue, actualValue, ignorePaths)
+		}
+		fallthrough
+	case strings.HasPrefix(mimeType, "text/") || strings.Contains(mimeType, "xml"):
+		if expected != string(body) {
+			differences = append(differences, Difference{Path: "body", Expected: expected, Actual: string(body)})
+		}
+	}
+	return differences
+}
+
+func decode(data []byte, v *any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func compareJSON(differences []Difference, path string, expected, actual any, ignorePaths []string) []Difference {
+	if path != "" && ignored(path, ignorePaths) {
+		return differences
+	}
+	if s, ok := expected.(string); ok && s == redacted {
+		return differences
+	}
+
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(e)+len(a))
+		for key := range e {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, ok := e[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			differences = compareJSON(differences, join(path, key), e[key], a[key], ignorePaths)
+		}
+		return differences
+	case []any:
+		a, ok := actual.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(e), len(a)); i++ {
+			var ev, av any
+			if i < len(e) {
+				ev = e[i]
+			}
+			if i < len(a) {
+				av = a[i]
+			}
+			differences = compareJSON(differences, join(path, strconv.Itoa(i)), ev, av, ignorePaths)
+		}
+		return differences
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		if path == "" {
+			path = "body"
+		}
+		differences = append(differences, Difference{Path: path, Expected: expected, Actual: actual})
+	}
+	return differences
+}
+
+func join(path, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
+
+// ignored path 是否匹配 ignorePaths，* 匹配任意一段，.. 开头表示匹配结尾的若干段
+func ignored(path string, ignorePaths []string) bool {
+	segments := strings.Split(path, ".")
+	for _, ignorePath := range ignorePaths {
+		anyDepth := strings.HasPrefix(ignorePath, "..")
+		patterns := strings.Split(strings.TrimPrefix(ignorePath, ".."), ".")
+		if anyDepth && len(segments) >= len(patterns) {
+			if matchSegments(patterns, segments[len(segments)-len(patterns):]) {
+				return true
+			}
+			continue
+		}
+		if len(patterns) == len(segments) && matchSegments(patterns, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(patterns, segments []string) bool {
+	for i, pattern := range patterns {
+		if pattern != "*" && pattern != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func format(v any) string {
+	if v == nil {
+		return "<missing>"
+	}
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
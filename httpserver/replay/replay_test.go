@@ -0,0 +1,129 @@
+package replay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihezebin/olympus/httpserver/middleware"
+)
+
+func newEngine(name string, recorder *middleware.Recorder) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	if recorder != nil {
+		engine.Use(recorder.Middleware())
+	}
+	engine.POST("/users/:id", func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer local" && c.GetHeader("Authorization") != "Bearer prod" {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 401})
+			return
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusOK, gin.H{
+			"code":       0,
+			"request_id": c.GetHeader("X-Request-Id") + name,
+			"data":       gin.H{"id": c.Param("id"), "name": name, "body": string(body), "tags": []string{"a", name}, "token": "t-" + name},
+		})
+	})
+	engine.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong "+name)
+	})
+	return engine
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	writer, err := middleware.NewFileRecordWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := middleware.NewRecorder(writer, middleware.WithRecordRedactJSONPaths("..token"))
+	recorder.SetRouteSampleRate("*", "/users/:id", 1)
+	recorder.SetRouteSampleRate(http.MethodGet, "/ping", 1)
+
+	prod := newEngine("prod", recorder)
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/users/1?verbose=true", strings.NewReader(`{"name":"prod"}`)),
+		httptest.NewRequest(http.MethodGet, "/ping", nil),
+	} {
+		req.Header.Set("Authorization", "Bearer prod")
+		req.Header.Set("Content-Type", "application/json")
+		prod.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err = recorder.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Route != "/users/:id" || entry.Request.PostData == nil || entry.Request.PostData.Text != `{"name":"prod"}` ||
+		len(entry.Request.QueryString) != 1 || !strings.Contains(entry.Response.Content.Text, `"token":"***"`) {
+		t.Fatalf("unexpected record: %+v", entry)
+	}
+	for _, header := range entry.Request.Headers {
+		if header.Name == "Authorization" && header.Value != "***" {
+			t.Fatalf("authorization should be redacted: %s", header.Value)
+		}
+	}
+
+	local := httptest.NewServer(newEngine("local", nil))
+	defer local.Close()
+
+	// 录制时 Authorization 已经脱敏，不指定时返回 401
+	report, err := Replay(context.Background(), local.URL, entries[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed()) != 1 || report.Results[0].Differences[0].Path != "status" {
+		t.Fatalf("unexpected report: %+v", report.Results)
+	}
+
+	report, err = Replay(context.Background(), local.URL, entries, WithHeader("Authorization", "Bearer local"), WithIgnoreJSONPaths("..request_id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0)
+	for _, difference := range report.Results[0].Differences {
+		paths = append(paths, difference.Path)
+	}
+	if strings.Join(paths, ",") != "data.name,data.tags.1" {
+		t.Fatalf("unexpected differences: %v", report.Results[0].Differences)
+	}
+	if d := report.Results[1].Differences; len(d) != 1 || d[0].Path != "body" || d[0].Expected != "pong prod" {
+		t.Fatalf("unexpected text differences: %v", d)
+	}
+	if !strings.HasPrefix(report.Results[0].String(), "FAIL POST") {
+		t.Fatalf("unexpected result string: %s", report.Results[0].String())
+	}
+
+	// 录制与回放一致时通过
+	report, err = Replay(context.Background(), local.URL, entries[:1], WithHeader("Authorization", "Bearer local"), WithIgnoreJSONPaths("..request_id", "data.name", "data.tags.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed()) != 0 {
+		t.Fatalf("unexpected failures: %v", report.Failed())
+	}
+
+	har := `{"log":{"version":"1.2","entries":[{"request":{"method":"GET","url":"https://example.com/ping"},"response":{"status":200,"content":{"mimeType":"text/plain","text":"pong local"}}}]}}`
+	entries, err = Load(strings.NewReader(har))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err = Replay(context.Background(), local.URL, entries); err != nil || len(report.Failed()) != 0 {
+		t.Fatalf("unexpected har replay: %v %+v", err, report)
+	}
+}
@@ -1,8 +1,11 @@
 package httpserver
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ihezebin/openapi"
@@ -10,6 +13,7 @@ import (
 
 type Router interface {
 	Group(...string) Router
+	GroupWithOptions(string, ...RouterOption) Router
 	Use(...gin.HandlerFunc) Router
 	Any(string, handlerGenerator, ...OpenAPIOption)
 	AnyWithOptions(string, handlerGenerator, ...RouterOption)
@@ -34,6 +38,21 @@ type openapiRouter struct {
 	prefix    string
 	ginRouter gin.IRouter
 	openapi   *openapi.API
+	// options 分组内所有路由默认的 RouterOptions
+	options *RouterOptions
+
+	versions  *versionRegistry
+	limits    *bodyLimits
+	admission *admission
+	proxies   *proxyRegistry
+	asyncs    *asyncRegistry
+	graphqls  *graphqlRegistry
+	// errs 注册路由的错误，由 RegisterRoutes 返回
+	errs *routeErrors
+	// version 不为空时为版本路由，versionParent 为调用 Version 的路由，versionPath 为相对版本根路由的路径
+	version       *apiVersion
+	versionParent *openapiRouter
+	versionPath   string
 }
 
 func (r *openapiRouter) Kernel() gin.IRouter {
@@ -43,37 +62,128 @@ func (r *openapiRouter) Kernel() gin.IRouter {
 func (r *openapiRouter) Group(prefixes ...string) Router {
 	prefix := strings.Join(prefixes, "/")
 
+	group := &openapiRouter{
+		prefix:        strings.ReplaceAll(strings.Join([]string{r.prefix, prefix}, "/"), "//", "/"),
+		ginRouter:     r.ginRouter.Group(prefix),
+		openapi:       r.openapi,
+		options:       r.options,
+		versions:      r.versions,
+		limits:        r.limits,
+		admission:     r.admission,
+		proxies:       r.proxies,
+		asyncs:        r.asyncs,
+		graphqls:      r.graphqls,
+		errs:          r.errs,
+		version:       r.version,
+		versionParent: r.versionParent,
+	}
+	if r.version != nil {
+		group.versionPath = r.mergePath(r.versionPath, prefix)
+	}
+	return group
+}
+
+// GroupWithOptions 分组内的路由都会应用 options，例如通过 WithTags("user") 在文档中按 tag 分组
+func (r *openapiRouter) GroupWithOptions(prefix string, options ...RouterOption) Router {
+	group := r.Group(prefix).(*openapiRouter)
+	group.options = r.options.with(mergeRouterOptions(options...))
+	return group
+}
+
+// Version 在 router 上创建版本路由，版本内的路由生成独立的 openapi 文档，同名版本共用同一个文档
+//
+//	v2, err := httpserver.Version(router, "v2", WithVersionStrategy(VersionStrategyPath|VersionStrategyHeader), WithVersionInherit("v1"))
+func Version(router Router, version string, opts ...VersionOption) (Router, error) {
+	r, err := openapiRouterOf(router)
+	if err != nil {
+		return nil, err
+	}
+	parent := r
+	if r.version != nil {
+		// 不支持嵌套版本，以外层版本的父路由为准
+		parent = r.versionParent
+	}
+	v := r.versions.version(version, opts...)
+
 	return &openapiRouter{
-		prefix:    strings.ReplaceAll(strings.Join([]string{r.prefix, prefix}, "/"), "//", "/"),
-		ginRouter: r.ginRouter.Group(prefix),
-		openapi:   r.openapi,
+		prefix:        parent.prefix,
+		ginRouter:     parent.ginRouter,
+		openapi:       v.openapi,
+		options:       parent.options,
+		versions:      r.versions,
+		limits:        r.limits,
+		admission:     r.admission,
+		proxies:       r.proxies,
+		asyncs:        r.asyncs,
+		graphqls:      r.graphqls,
+		errs:          r.errs,
+		version:       v,
+		versionParent: parent,
+	}, nil
+}
+
+// openapiRouterOf Version 等注册函数需要 httpserver 创建的 Router 中的注册信息
+func openapiRouterOf(router Router) (*openapiRouter, error) {
+	r, ok := router.(*openapiRouter)
+	if !ok {
+		return nil, fmt.Errorf("router %T is not created by httpserver", router)
 	}
+	return r, nil
+}
+
+// routeErrors 一次 RegisterRoutes 中注册路由的错误，注册失败的路由不会生效
+type routeErrors struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// add 记录错误并原样返回，便于注册函数同时返回错误
+func (e *routeErrors) add(err error) error {
+	if err == nil || e == nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, err)
+	return err
+}
+
+func (e *routeErrors) err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return errors.Join(e.errs...)
 }
 
 func (r *openapiRouter) mergePath(paths ...string) string {
-	path := strings.ReplaceAll(strings.Join(paths, "/"), "//", "/")
-	if strings.Contains(path, "//") {
-		return r.mergePath(paths...)
+	path := strings.Join(paths, "/")
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
 	}
 
 	return path
 }
 
 func (r *openapiRouter) Use(middleware ...gin.HandlerFunc) Router {
+	if r.version != nil {
+		// 版本路由注册在父路由上，中间件随路由一起注册
+		r.options = r.options.with(&RouterOptions{PreMiddlewares: middleware})
+		return r
+	}
 	r.ginRouter.Use(middleware...)
 	return r
 }
 
 func (r *openapiRouter) handle(method string, path string, h handlerGenerator, routerOptions *RouterOptions) {
-	requestBody, responseBody, query, params, requestHeader, responseHeader, handlerFunc := h()
+	routerOptions = r.options.with(routerOptions)
+	if r.version != nil {
+		r.version.handle(r, method, path, h, routerOptions)
+		return
+	}
 
-	ginFuncs := make([]gin.HandlerFunc, 0, 1)
-	ginFuncs = append(ginFuncs, routerOptions.PreMiddlewares...)
-	ginFuncs = append(ginFuncs, handlerFunc)
-	ginFuncs = append(ginFuncs, routerOptions.PostMiddlewares...)
+	route := newHandlerRoute(h)
 
 	// register gin route
-	r.ginRouter.Handle(method, path, ginFuncs...)
+	r.ginRouter.Handle(method, path, route.chain(routerOptions)...)
 
 	// handle openapi path
 	path = r.mergePath(r.prefix, path)
@@ -82,9 +192,40 @@ func (r *openapiRouter) handle(method string, path string, h handlerGenerator, r
 	if routerOptions.PathRegister != nil {
 		routerOptions.PathRegister(method, path)
 	}
+	r.limits.set(method, path, routerOptions.MaxBodyBytes)
+	r.admission.set(method, path, routerOptions.Priority)
 
-	// handle openapi route
-	route := r.openapi.Route(method, path)
+	route.document(r.openapi.Route(method, path), routerOptions, r.limits.effective(routerOptions.MaxBodyBytes))
+}
+
+// handlerRoute handlerGenerator 生成的文档模型与处理函数
+type handlerRoute struct {
+	requestBody    *openapi.Model
+	responseBody   *openapi.Model
+	query          map[string]openapi.QueryParam
+	params         map[string]openapi.PathParam
+	requestHeader  map[string]openapi.HeaderParam
+	responseHeader map[string]openapi.HeaderParam
+	handlerFunc    gin.HandlerFunc
+}
+
+func newHandlerRoute(h handlerGenerator) *handlerRoute {
+	route := &handlerRoute{}
+	route.requestBody, route.responseBody, route.query, route.params, route.requestHeader, route.responseHeader, route.handlerFunc = h()
+	return route
+}
+
+func (h *handlerRoute) chain(routerOptions *RouterOptions) []gin.HandlerFunc {
+	ginFuncs := make([]gin.HandlerFunc, 0, len(routerOptions.PreMiddlewares)+len(routerOptions.PostMiddlewares)+1)
+	ginFuncs = append(ginFuncs, routerOptions.PreMiddlewares...)
+	ginFuncs = append(ginFuncs, h.handlerFunc)
+	ginFuncs = append(ginFuncs, routerOptions.PostMiddlewares...)
+	return ginFuncs
+}
+
+// document 将模型与参数写入 openapi 路由，maxBodyBytes 大于 0 时在文档中说明请求体大小限制
+func (h *handlerRoute) document(route *openapi.Route, routerOptions *RouterOptions, maxBodyBytes int64) {
+	method, path := string(route.Method), string(route.Pattern)
 	route = mergeOpenAPIOptions(route, routerOptions.OpenAPIOptions...)
 	operationID := strings.ReplaceAll(path, "/", "_")
 	operationID = strings.TrimLeft(operationID, "_")
@@ -93,22 +234,34 @@ func (r *openapiRouter) handle(method string, path string, h handlerGenerator, r
 
 	route.HasOperationID(operationID)
 
-	if requestBody != nil {
-		route.HasRequestModel(*requestBody)
+	if h.requestBody != nil {
+		route.HasRequestModel(*h.requestBody)
+		if maxBodyBytes > 0 {
+			route.HasResponseModel(http.StatusRequestEntityTooLarge, openapi.ModelOf[Body[EmptyType]]())
+			limit := fmt.Sprintf("请求体最大 %s", formatBytes(maxBodyBytes))
+			if route.Description != "" {
+				limit = route.Description + "\n\n" + limit
+			}
+			route.HasDescription(limit)
+		}
 	}
 
 	route.HasResponseModel(http.StatusInternalServerError, openapi.ModelOf[Body[EmptyType]]())
-	if responseBody != nil {
-		route.HasResponseModel(http.StatusOK, *responseBody)
+	if h.responseBody != nil {
+		route.HasResponseModel(http.StatusOK, *h.responseBody)
 	}
 
-	if len(query) > 0 {
-		for k, v := range query {
+	if len(h.query) > 0 {
+		for k, v := range h.query {
 			route.HasQueryParameter(k, v)
 		}
 	}
 
 	// path 里面有，但是由于 uri tag 添加的 param 要删除
+	params := make(map[string]openapi.PathParam, len(h.params))
+	for k, v := range h.params {
+		params[k] = v
+	}
 	realExistParam := make(map[string]bool)
 	// path 里面包含 :id 格式的，添加 param
 	if strings.Contains(path, ":") {
@@ -136,14 +289,14 @@ func (r *openapiRouter) handle(method string, path string, h handlerGenerator, r
 		}
 	}
 
-	if len(requestHeader) > 0 {
-		for k, v := range requestHeader {
+	if len(h.requestHeader) > 0 {
+		for k, v := range h.requestHeader {
 			route.HasHeaderParameter(k, v)
 		}
 	}
 
-	if len(responseHeader) > 0 {
-		for k, v := range responseHeader {
+	if len(h.responseHeader) > 0 {
+		for k, v := range h.responseHeader {
 			route.HasResponseHeader(http.StatusOK, k, v)
 		}
 	}
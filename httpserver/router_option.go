@@ -7,6 +7,10 @@ type RouterOptions struct {
 	PostMiddlewares []gin.HandlerFunc
 	OpenAPIOptions  OpenAPIOptions
 	PathRegister    func(method, path string)
+	// MaxBodyBytes 路由的请求体大小限制，0 使用服务默认值，小于 0 表示不限制
+	MaxBodyBytes int64
+	// Priority 准入控制的优先级，默认 PriorityNormal
+	Priority Priority
 }
 
 type RouterOption func(*RouterOptions)
@@ -19,6 +23,35 @@ func mergeRouterOptions(options ...RouterOption) *RouterOptions {
 	return routerOptions
 }
 
+// with 合并分组与路由的 options，分组的 PreMiddlewares 在前、PostMiddlewares 在后，路由的 OpenAPIOptions 后应用
+func (o *RouterOptions) with(other *RouterOptions) *RouterOptions {
+	if o == nil {
+		return other
+	}
+	if other == nil {
+		return o
+	}
+
+	merged := &RouterOptions{
+		PreMiddlewares:  append(append([]gin.HandlerFunc{}, o.PreMiddlewares...), other.PreMiddlewares...),
+		PostMiddlewares: append(append([]gin.HandlerFunc{}, other.PostMiddlewares...), o.PostMiddlewares...),
+		OpenAPIOptions:  append(append(OpenAPIOptions{}, o.OpenAPIOptions...), other.OpenAPIOptions...),
+		PathRegister:    o.PathRegister,
+	}
+	if other.PathRegister != nil {
+		merged.PathRegister = other.PathRegister
+	}
+	merged.MaxBodyBytes = o.MaxBodyBytes
+	if other.MaxBodyBytes != 0 {
+		merged.MaxBodyBytes = other.MaxBodyBytes
+	}
+	merged.Priority = o.Priority
+	if other.Priority != PriorityNormal {
+		merged.Priority = other.Priority
+	}
+	return merged
+}
+
 func WithPreMiddlewares(middlewares ...gin.HandlerFunc) RouterOption {
 	return func(options *RouterOptions) {
 		options.PreMiddlewares = append(options.PreMiddlewares, middlewares...)
@@ -31,9 +64,17 @@ func WithPostMiddlewares(middlewares ...gin.HandlerFunc) RouterOption {
 	}
 }
 
+// WithOpenAPIOptions 追加路由的文档选项，可以与 WithTags、WithWebhookSignature 等任意顺序组合
 func WithOpenAPIOptions(opts ...OpenAPIOption) RouterOption {
 	return func(options *RouterOptions) {
-		options.OpenAPIOptions = NewOpenAPIOptions(opts...)
+		options.OpenAPIOptions = append(options.OpenAPIOptions, opts...)
+	}
+}
+
+// WithTags 路由在文档中的 tag，UI 按 tag 分组展示
+func WithTags(tags ...string) RouterOption {
+	return func(options *RouterOptions) {
+		options.OpenAPIOptions = append(options.OpenAPIOptions, WithOpenAPITags(tags...))
 	}
 }
 
@@ -42,3 +83,17 @@ func WithPathRegister(pathRegister func(method, path string)) RouterOption {
 		options.PathRegister = pathRegister
 	}
 }
+
+// WithMaxBodyBytes 路由的请求体大小限制，覆盖服务默认值，小于 0 表示不限制，例如文件上传
+func WithMaxBodyBytes(limit int64) RouterOption {
+	return func(options *RouterOptions) {
+		options.MaxBodyBytes = limit
+	}
+}
+
+// WithPriority 路由在准入控制中的优先级，PriorityCritical 的路由不会被拒绝，例如管理接口
+func WithPriority(priority Priority) RouterOption {
+	return func(options *RouterOptions) {
+		options.Priority = priority
+	}
+}
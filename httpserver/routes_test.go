@@ -0,0 +1,384 @@
+// 外部测试包通过 testkit 在进程内执行路由请求，testkit 依赖 httpserver，不能在 package httpserver 的测试中使用
+package httpserver_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/httpserver"
+	"github.com/ihezebin/olympus/httpserver/testkit"
+)
+
+type ListUserReq struct {
+	Pagination
+	Filter   UserFilter
+	Ids      []int64   `form:"ids" desc:"用户 id"`
+	Since    time.Time `form:"since"`
+	TenantId string    `header:"X-Tenant-Id" openapi:"required"`
+}
+
+type Pagination struct {
+	Page     uint `form:"page" example:"1"`
+	PageSize uint `form:"page_size" example:"20"`
+}
+
+type UserFilter struct {
+	Status string `form:"status" enum:"active,disabled" example:"active"`
+}
+
+type CreateUserReq struct {
+	Name   string   `json:"name" example:"olympus"`
+	Role   string   `json:"role" enum:"admin,member"`
+	Labels []string `json:"labels" example:"a,b"`
+}
+
+type auditInfo struct {
+	Name string `json:"name"`
+	By   string `json:"by"`
+}
+
+type ownerInfo struct {
+	Name string `json:"owner_name"`
+}
+
+// UpdateUserReq 匿名结构体中有相同的字段名，按 json 名区分
+type UpdateUserReq struct {
+	auditInfo
+	ownerInfo
+	Age int `json:"age"`
+}
+
+// RenameUserReq 外层的字段覆盖匿名结构体中的同名字段
+type RenameUserReq struct {
+	auditInfo
+	Name string `json:"name" example:"olympus"`
+}
+
+type UserRouter struct{}
+
+func (u *UserRouter) RegisterRoutes(router httpserver.Router) {
+	group := router.GroupWithOptions("/users", httpserver.WithTags("user"))
+	group.GET("/list", httpserver.NewHandler(func(c *gin.Context, req *ListUserReq) ([]string, error) {
+		return nil, nil
+	}))
+	group.POST("/create", httpserver.NewHandler(func(c *gin.Context, req *CreateUserReq) (string, error) {
+		return req.Name, nil
+	}))
+	group.POST("/update", httpserver.NewHandler(func(c *gin.Context, req *UpdateUserReq) (int, error) {
+		return req.Age, nil
+	}))
+	group.POST("/rename", httpserver.NewHandler(func(c *gin.Context, req *RenameUserReq) (string, error) {
+		return req.Name, nil
+	}))
+}
+
+func TestOpenAPIReflect(t *testing.T) {
+	kit := testkit.New(t, []httpserver.RegisterRoutes{&UserRouter{}})
+	kit.AssertOpenAPICoverage()
+	spec := kit.Spec()
+
+	list := spec.Paths.Value("/users/list").Get
+	if len(list.Tags) != 1 || list.Tags[0] != "user" {
+		t.Fatalf("unexpected tags: %v", list.Tags)
+	}
+	for _, name := range []string{"page", "page_size", "status", "ids", "since"} {
+		if list.Parameters.GetByInAndName("query", name) == nil {
+			t.Fatalf("query param %s not found", name)
+		}
+	}
+	ids := list.Parameters.GetByInAndName("query", "ids")
+	if !ids.Schema.Value.Type.Is("array") || !ids.Schema.Value.Items.Value.Type.Is("integer") {
+		t.Fatalf("ids should be an integer array")
+	}
+	if since := list.Parameters.GetByInAndName("query", "since"); since.Schema.Value.Format != "date-time" {
+		t.Fatalf("since should be date-time")
+	}
+	if status := list.Parameters.GetByInAndName("query", "status"); len(status.Schema.Value.Enum) != 2 || status.Example != "active" {
+		t.Fatalf("status should have enum and example")
+	}
+	if tenant := list.Parameters.GetByInAndName("header", "X-Tenant-Id"); tenant == nil || !tenant.Required {
+		t.Fatalf("tenant header should be required")
+	}
+
+	body := spec.Paths.Value("/users/create").Post.RequestBody.Value.Content.Get("application/json").Schema.Value
+	if role := body.Properties["role"].Value; len(role.Enum) != 2 {
+		t.Fatalf("role should have enum")
+	}
+	if labels := body.Properties["labels"].Value; len(labels.Example.([]any)) != 2 {
+		t.Fatalf("labels should have example")
+	}
+
+	update := spec.Paths.Value("/users/update").Post.RequestBody.Value.Content.Get("application/json").Schema.Value
+	for _, name := range []string{"age", "name", "by", "owner_name"} {
+		if update.Properties[name] == nil {
+			t.Fatalf("property %s should be documented: %v", name, update.Properties)
+		}
+	}
+	rename := spec.Paths.Value("/users/rename").Post.RequestBody.Value.Content.Get("application/json").Schema.Value
+	if name := rename.Properties["name"]; name == nil || name.Value.Example != "olympus" || rename.Properties["by"] == nil {
+		t.Fatalf("outer property should shadow embedded one: %v", rename.Properties)
+	}
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	kit := testkit.New(t, []httpserver.RegisterRoutes{&UserRouter{}}, testkit.WithServerOptions(
+		httpserver.WithRequestValidation(true), httpserver.WithResponseValidation(true)))
+
+	cases := []struct {
+		method   string
+		target   string
+		body     string
+		location string
+	}{
+		{http.MethodPost, "/users/create", `{"name":"olympus","role":"root","labels":[]}`, "/body/role"},
+		{http.MethodPost, "/users/create", `{"name":1,"role":"admin","labels":[]}`, "/body/name"},
+		{http.MethodGet, "/users/list?page=abc", "", "/query/page"},
+		{http.MethodGet, "/users/list", "", "/header/X-Tenant-Id"},
+	}
+	for _, c := range cases {
+		resp := kit.Do(c.method, c.target, testkit.WithBody("application/json", []byte(c.body)))
+		body := testkit.Decode[[]httpserver.ValidationError](t, resp)
+		if resp.Code != http.StatusBadRequest || body.Code != httpserver.CodeValidateRuleFailed {
+			t.Fatalf("%s %s: unexpected response: %d %s", c.method, c.target, resp.Code, resp.Body.String())
+		}
+		found := false
+		for _, e := range body.Data {
+			found = found || e.Location == c.location
+		}
+		if !found {
+			t.Fatalf("%s %s: expected location %s, got %+v", c.method, c.target, c.location, body.Data)
+		}
+	}
+
+	resp := kit.Do(http.MethodPost, "/users/create", testkit.WithJSON(CreateUserReq{Name: "olympus", Role: "admin", Labels: []string{"a"}}))
+	if name := testkit.AssertOK[string](t, resp); name != "olympus" {
+		t.Fatalf("unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+type listUsersRequest struct {
+	httpserver.OffsetPagination
+	httpserver.Sorting
+	httpserver.Filtering
+}
+
+type listEventsRequest struct {
+	httpserver.CursorPagination
+}
+
+type eventCursor struct {
+	ID int `json:"id"`
+}
+
+type pageRouter struct{}
+
+func (p *pageRouter) RegisterRoutes(router httpserver.Router) {
+	router.GET("/users", httpserver.NewHandler(func(c *gin.Context, req listUsersRequest) (httpserver.Page[string], error) {
+		sorts, err := req.Sorting.Parse("name", "created_at")
+		if err != nil {
+			return httpserver.Page[string]{}, err
+		}
+		filter, err := req.Filtering.Parse(httpserver.FilterFields{"status": httpserver.FilterString, "age": httpserver.FilterInt})
+		if err != nil {
+			return httpserver.Page[string]{}, err
+		}
+		items := []string{fmt.Sprint(sorts), fmt.Sprint(filter)}
+		return httpserver.NewOffsetPage(items, 42, req.OffsetPagination), nil
+	}))
+	router.GET("/events", httpserver.NewHandler(func(c *gin.Context, req listEventsRequest) (httpserver.Page[int], error) {
+		cursor := eventCursor{}
+		if err := req.Decode(&cursor); err != nil {
+			return httpserver.Page[int]{}, err
+		}
+		items := make([]int, 0, req.Limit())
+		for id := cursor.ID + 1; id <= min(cursor.ID+req.Limit(), 5); id++ {
+			items = append(items, id)
+		}
+		var next string
+		if len(items) > 0 && items[len(items)-1] < 5 {
+			next, _ = httpserver.EncodeCursor(eventCursor{ID: items[len(items)-1]})
+		}
+		return httpserver.NewCursorPage(items, next, req.CursorPagination), nil
+	}))
+}
+
+func TestPagination(t *testing.T) {
+	kit := testkit.New(t, []httpserver.RegisterRoutes{&pageRouter{}}, testkit.WithResponseValidation())
+	kit.AssertOpenAPICoverage()
+
+	query := url.Values{"page": {"2"}, "page_size": {"500"}, "sort": {"-created_at,name"}, "filter": {"status:eq:active", "or(age:gte:18,not(status:in:banned|\"a,b\"))"}}
+	page := testkit.AssertOK[httpserver.Page[string]](t, kit.Do(http.MethodGet, "/users?"+query.Encode()))
+	if page.Page != 2 || page.PageSize != httpserver.MaxPageSize || page.Total != 42 || page.HasMore {
+		t.Fatalf("unexpected offset page: %+v", page)
+	}
+	if page.Items[0] != "[{created_at true} {name false}]" ||
+		page.Items[1] != `and(status:eq:active,or(age:gte:18,not(status:in:banned|"a,b")))` {
+		t.Fatalf("unexpected sort and filter: %+v", page.Items)
+	}
+
+	for _, query := range []string{"sort=password", "filter=status:eq", "filter=age:gt:old", "filter=role:eq:admin", "filter=or(status:eq:a", "filter=status:regex:a"} {
+		resp := kit.Do(http.MethodGet, "/users?"+query)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s should be bad request: %d %s", query, resp.Code, resp.Body.String())
+		}
+		testkit.AssertCode(t, resp, httpserver.CodeBadRequest)
+	}
+
+	// 通过 next_cursor 遍历所有数据
+	var ids []int
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		events := testkit.AssertOK[httpserver.Page[int]](t, kit.Do(http.MethodGet, "/events", testkit.WithQuery("page_size", "2"), testkit.WithQuery("cursor", cursor)))
+		ids = append(ids, events.Items...)
+		if !events.HasMore {
+			break
+		}
+		cursor = events.NextCursor
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+		t.Fatalf("unexpected cursor pages: %v", ids)
+	}
+	if resp := kit.Do(http.MethodGet, "/events?cursor=invalid"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid cursor should be bad request: %d", resp.Code)
+	}
+
+	// 条件的值按字段类型转换
+	filter, err := httpserver.Filtering{Filter: []string{"age:in:1|2", "created_at:lt:2024-01-01T00:00:00Z", "deleted_at:null:true"}}.Parse(httpserver.FilterFields{
+		"age": httpserver.FilterInt, "created_at": httpserver.FilterTime, "deleted_at": httpserver.FilterTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	and := filter.(*httpserver.FilterAnd)
+	if in := and.Exprs[0].(*httpserver.FilterCondition); in.Op != httpserver.FilterOpIn || in.Values[1] != int64(2) {
+		t.Fatalf("unexpected in condition: %+v", in)
+	}
+	if lt := and.Exprs[1].(*httpserver.FilterCondition); !lt.Value.(time.Time).Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected time condition: %+v", lt)
+	}
+	if null := and.Exprs[2].(*httpserver.FilterCondition); null.Op != httpserver.FilterOpNull || null.Value != true {
+		t.Fatalf("unexpected null condition: %+v", null)
+	}
+
+	list := kit.Spec().Paths.Value("/users").Get
+	for _, name := range []string{"page", "page_size", "sort", "filter"} {
+		if list.Parameters.GetByInAndName("query", name) == nil {
+			t.Fatalf("query parameter %s should be documented", name)
+		}
+	}
+	if !list.Parameters.GetByInAndName("query", "filter").Schema.Value.Type.Is("array") {
+		t.Fatal("filter should be documented as array")
+	}
+}
+
+type batchRouter struct{}
+
+type batchUserRequest struct {
+	Id     string `uri:"id"`
+	Fields string `form:"fields"`
+}
+
+type batchUser struct {
+	Id      string `json:"id"`
+	Fields  string `json:"fields"`
+	Name    string `json:"name,omitempty"`
+	Auth    string `json:"auth"`
+	TraceId string `json:"trace_id"`
+	SpanId  string `json:"span_id"`
+}
+
+func (b *batchRouter) RegisterRoutes(router httpserver.Router) {
+	user := func(c *gin.Context, id string) batchUser {
+		spanContext := trace.SpanFromContext(c.Request.Context()).SpanContext()
+		return batchUser{Id: id, Auth: c.GetHeader("Authorization"), TraceId: spanContext.TraceID().String(), SpanId: spanContext.SpanID().String()}
+	}
+	router.GET("/users/:id", httpserver.NewHandler(func(c *gin.Context, req batchUserRequest) (batchUser, error) {
+		if req.Id == "0" {
+			return batchUser{}, httpserver.NewError(httpserver.CodeNotFound, "user not found").WithStatus(http.StatusNotFound)
+		}
+		u := user(c, req.Id)
+		u.Fields = req.Fields
+		return u, nil
+	}))
+	router.POST("/users", httpserver.NewHandler(func(c *gin.Context, req batchUser) (batchUser, error) {
+		u := user(c, "new")
+		u.Name = req.Name
+		return u, nil
+	}))
+}
+
+func TestBatch(t *testing.T) {
+	kit := testkit.New(t, []httpserver.RegisterRoutes{&batchRouter{}}, testkit.WithServerOptions(
+		httpserver.WithBatch(httpserver.WithBatchMaxRequests(6), httpserver.WithBatchConcurrency(2), httpserver.WithBatchMaxResponseBytes(1024))))
+
+	serve := func(body string) *testkit.Response {
+		return kit.Do(http.MethodPost, "/batch", testkit.WithBody("application/json", []byte(body)), testkit.WithHeader("Authorization", "Bearer token"))
+	}
+
+	results := testkit.AssertOK[[]httpserver.BatchResult](t, serve(`[
+		{"path":"/users/1?fields=name","query":{"lang":"en"}},
+		{"path":"/users/2","query":{"fields":"age"},"headers":{"Authorization":"Bearer other"}},
+		{"method":"post","path":"/users","body":{"name":"alice"}},
+		{"path":"/users/0"},
+		{"path":"/health"},
+		{"method":"POST","path":"/batch","body":[]}
+	]`))
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %+v", results)
+	}
+
+	users := make([]batchUser, 3)
+	for i := range users {
+		if results[i].Status != http.StatusOK || results[i].Code != httpserver.CodeOK {
+			t.Fatalf("unexpected result %d: %+v", i, results[i])
+		}
+		if err := json.Unmarshal(results[i].Data, &users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if users[0].Id != "1" || users[0].Fields != "name" || users[0].Auth != "Bearer token" ||
+		users[1].Fields != "age" || users[1].Auth != "Bearer other" || users[2].Name != "alice" {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+	// 子请求在同一个 trace 中并有各自的 span
+	if users[0].TraceId != users[1].TraceId || users[0].TraceId != users[2].TraceId ||
+		users[0].SpanId == users[1].SpanId || users[1].SpanId == users[2].SpanId {
+		t.Fatalf("unexpected spans: %+v", users)
+	}
+
+	if results[3].Status != http.StatusNotFound || results[3].Code != httpserver.CodeNotFound || results[3].Message != "user not found" {
+		t.Fatalf("unexpected not found result: %+v", results[3])
+	}
+	if results[4].Status != http.StatusOK || string(results[4].Data) != `"ok"` {
+		t.Fatalf("unexpected text result: %+v", results[4])
+	}
+	if results[5].Status != http.StatusBadRequest || results[5].Code != httpserver.CodeBadRequest {
+		t.Fatalf("nested batch should be rejected: %+v", results[5])
+	}
+
+	oversize := "[" + strings.TrimSuffix(strings.Repeat(`{"path":"/health"},`, 7), ",") + "]"
+	if resp := serve(oversize); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversize batch, got %d", resp.Code)
+	}
+	if resp := serve(`{"path":"/health"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid batch, got %d", resp.Code)
+	}
+	results = testkit.AssertOK[[]httpserver.BatchResult](t, serve(`[{"path":"https://example.com/health"},{"path":"/missing"}]`))
+	if results[0].Status != http.StatusBadRequest || results[1].Status != http.StatusNotFound || results[1].Code != httpserver.CodeNotFound {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	// 超过大小限制的响应不会保存
+	results = testkit.AssertOK[[]httpserver.BatchResult](t, serve(`[{"path":"/users/1?fields=`+strings.Repeat("a", 1024)+`"},{"path":"/users/1"}]`))
+	if results[0].Status != http.StatusBadGateway || results[0].Code != httpserver.CodeBadGateway || len(results[0].Data) > 0 || results[1].Status != http.StatusOK {
+		t.Fatalf("unexpected oversize response results: %+v", results)
+	}
+}
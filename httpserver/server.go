@@ -2,14 +2,19 @@ package httpserver
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/ihezebin/openapi"
@@ -26,17 +31,35 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
 
 	"github.com/ihezebin/olympus/httpserver/internal"
+	"github.com/ihezebin/olympus/httpserver/middleware"
 	"github.com/ihezebin/olympus/logger"
 )
 
 type server struct {
 	*http.Server
-	options   *ServerOptions
-	engine    *gin.Engine
-	openapi   *openapi.API
+	options         *ServerOptions
+	engine          *gin.Engine
+	openapi         *openapi.API
+	openapiSpec     atomic.Pointer[[]byte]
+	openapiSpecOnce sync.Once
+	// openapiVersionSpecs 版本名到 spec json 的映射
+	openapiVersionSpecs sync.Map
+	container           *Container
+	validator           *openapiValidator
+	versions            *versionRegistry
+	limits              *bodyLimits
+	admission           *admission
+	proxies             *proxyRegistry
+	asyncs              *asyncRegistry
+	graphqls            *graphqlRegistry
+	// admin 管理接口使用独立端口时的 http.Server
+	admin     *http.Server
 	shutdowns []ShutdownFunc
 }
 
+// OpenAPISpecPath 提供 openapi json 文档的路由
+const OpenAPISpecPath = "/openapi.json"
+
 type ShutdownFunc func(context.Context) error
 
 func NewServer(ctx context.Context, opts ...ServerOption) (*server, error) {
@@ -49,6 +72,12 @@ func NewServer(ctx context.Context, opts ...ServerOption) (*server, error) {
 	}
 
 	engine := gin.New()
+	// 依赖注入容器最先注入，保证中间件中也可以 Resolve
+	container := NewContainer()
+	engine.Use(container.Middleware())
+	// 请求体大小限制在读取请求体的中间件之前
+	limits := newBodyLimits(serverOptions.MaxBodyBytes)
+	engine.Use(limits.Middleware())
 	// 中间件
 	engine.Use(serverOptions.Middlewares...)
 
@@ -78,6 +107,18 @@ func NewServer(ctx context.Context, opts ...ServerOption) (*server, error) {
 	otel.SetTextMapPropagator(propagator)
 	engine.Use(internal.OtelExtractTrace(serviceName))
 	engine.Use(internal.OtelInjectTrace())
+	if serverOptions.RequestIdHeader != "" {
+		engine.Use(middleware.RequestId(serverOptions.RequestIdHeader))
+	}
+	// recovery 在 otel 之后，panic 时 span 还未结束
+	if serverOptions.Recovery {
+		engine.Use(Recovery(serverOptions.RecoveryOptions...))
+	}
+	// 准入控制在读取请求体之前，被拒绝的请求也有 span
+	admission := newAdmission()
+	if serverOptions.Admission {
+		engine.Use(admission.Middleware(serverOptions.AdmissionOptions...))
+	}
 
 	otelResource := resource.NewWithAttributes(
 		semconv.SchemaURL,
@@ -122,40 +163,91 @@ func NewServer(ctx context.Context, opts ...ServerOption) (*server, error) {
 		shutdowns = append(shutdowns, lp.Shutdown)
 	}
 
-	openapiOpts := make([]openapi.APIOpts, 0)
-	if serverOptions.OpenAPInfo != nil {
-		openapiOpts = append(openapiOpts, openapi.WithInfo(*serverOptions.OpenAPInfo))
-	}
-	if len(serverOptions.OpenAPIServers) > 0 {
-		openapiOpts = append(openapiOpts, openapi.WithServer(serverOptions.OpenAPIServers...))
+	openApi := newOpenAPI(serviceName, serverOptions, "")
+	versions := newVersionRegistry(func(version string) *openapi.API {
+		return newOpenAPI(serviceName, serverOptions, version)
+	})
+
+	validator := newOpenAPIValidator(openApi, versions)
+	if serverOptions.ValidateRequest || serverOptions.ValidateResponse {
+		engine.Use(validator.Middleware(serverOptions.ValidateRequest, serverOptions.ValidateResponse))
 	}
-	openApi := openapi.NewAPI(serviceName, openapiOpts...)
-	openApi.RegisterModel(openapi.ModelOf[Body[any]]())
 
 	//默认的健康检查接口
 	engine.GET("/health", func(c *gin.Context) {
 		c.String(http.StatusOK, "ok")
 	})
+	if serverOptions.Batch {
+		registerBatch(engine, serverOptions.BatchOptions...)
+	}
 
 	kernel := &http.Server{
-		Handler: engine,
-		Addr:    fmt.Sprintf(":%d", serverOptions.Port),
+		Handler:           engine,
+		Addr:              fmt.Sprintf(":%d", serverOptions.Port),
+		ReadHeaderTimeout: serverOptions.ReadHeaderTimeout,
+		ReadTimeout:       serverOptions.ReadTimeout,
+		WriteTimeout:      serverOptions.WriteTimeout,
+		IdleTimeout:       serverOptions.IdleTimeout,
 	}
 
-	// 先关闭http server，再关闭其他组件
-	shutdowns = append([]ShutdownFunc{kernel.Shutdown}, shutdowns...)
+	proxies := &proxyRegistry{}
+	asyncs := &asyncRegistry{}
+	// 先关闭http server，再等待异步任务完成，最后关闭其他组件
+	shutdowns = append([]ShutdownFunc{kernel.Shutdown, asyncs.Close, proxies.Close, container.Close}, shutdowns...)
 
 	server := &server{
 		Server:    kernel,
 		options:   serverOptions,
 		engine:    engine,
 		openapi:   openApi,
+		container: container,
+		validator: validator,
+		versions:  versions,
+		limits:    limits,
+		admission: admission,
+		proxies:   proxies,
+		asyncs:    asyncs,
+		graphqls:  &graphqlRegistry{},
 		shutdowns: shutdowns,
 	}
+	if serverOptions.Admin {
+		if err := server.registerAdmin(); err != nil {
+			return nil, err
+		}
+	}
 
 	return server, nil
 }
 
+// newOpenAPI 创建 openapi 文档，version 不为空时为该版本独立的文档
+func newOpenAPI(serviceName string, serverOptions *ServerOptions, version string) *openapi.API {
+	openapiOpts := make([]openapi.APIOpts, 0)
+	info := openapi3.Info{Title: serviceName}
+	if serverOptions.OpenAPInfo != nil {
+		info = *serverOptions.OpenAPInfo
+	}
+	if version != "" {
+		info.Version = version
+	}
+	if serverOptions.OpenAPInfo != nil || version != "" {
+		openapiOpts = append(openapiOpts, openapi.WithInfo(info))
+	}
+	if len(serverOptions.OpenAPIServers) > 0 {
+		openapiOpts = append(openapiOpts, openapi.WithServer(serverOptions.OpenAPIServers...))
+	}
+	openApi := openapi.NewAPI(serviceName, openapiOpts...)
+	// 默认的 KnownTypes 是全局共享的，复制后再添加
+	knownTypes := make(map[reflect.Type]openapi3.Schema, len(openApi.KnownTypes)+1)
+	for t, schema := range openApi.KnownTypes {
+		knownTypes[t] = schema
+	}
+	knownTypes[binaryType] = binarySchema()
+	openApi.KnownTypes = knownTypes
+	openApi.ApplyCustomSchemaToType = structTagSchemaApplier(openApi)
+	openApi.RegisterModel(openapi.ModelOf[Body[any]]())
+	return openApi
+}
+
 func (s *server) Name() string {
 	return fmt.Sprintf("httpserver[%s]", s.options.ServiceName)
 }
@@ -168,41 +260,208 @@ func (s *server) OpenAPI() *openapi.API {
 	return s.openapi
 }
 
+// OpenAPIVersions 通过 Version 创建的各版本文档，key 为版本名
+func (s *server) OpenAPIVersions() map[string]*openapi.API {
+	apis := make(map[string]*openapi.API)
+	for _, v := range s.versions.list() {
+		apis[v.name] = v.openapi
+	}
+	return apis
+}
+
+// Container 依赖注入容器，通过 httpserver.Provide 注册依赖
+func (s *server) Container() *Container {
+	return s.container
+}
+
 type RegisterRoutes interface {
 	RegisterRoutes(router Router)
 }
 
-func (s *server) RegisterRoutes(routers ...RegisterRoutes) {
+// RegisterRoutes 注册路由，返回注册过程中的错误，例如 Proxy 的配置错误、版本继承了不存在的版本
+func (s *server) RegisterRoutes(routers ...RegisterRoutes) error {
+	errs := &routeErrors{}
 	for _, router := range routers {
 		router.RegisterRoutes(&openapiRouter{
 			ginRouter: s.engine,
 			openapi:   s.openapi,
 			prefix:    "",
+			options:   mergeRouterOptions(),
+			versions:  s.versions,
+			limits:    s.limits,
+			admission: s.admission,
+			proxies:   s.proxies,
+			asyncs:    s.asyncs,
+			graphqls:  s.graphqls,
+			errs:      errs,
 		})
 	}
+	s.versions.finalize(errs)
+	s.validator.reset()
+	return errs.err()
 }
 
+// RegisterOpenAPIUI 注册 openapi 文档页面，spec 统一由 OpenAPISpecPath 提供，
+// ui 的 Assets 不为 nil 时静态资源挂载在 path/assets 下，SwaggerUI 内嵌了静态资源，其余 UI 未设置 WithAssets 时从 CDN 加载。
+// 通过 Version 创建的版本在 path/{version} 下有独立的页面，spec 为 OpenAPIVersionSpecPath(version)，
+// GraphQL 注册的接口在 GraphQLPlaygroundPath(path, endpoint) 下提供 playground，需要在 RegisterRoutes 之后调用
 func (s *server) RegisterOpenAPIUI(path string, ui OpenAPIUIBuilder) error {
 	if path == "" {
 		path = "/openapi"
 	}
-	spec, err := s.OpenAPI().Spec()
+	path = strings.TrimRight(path, "/")
+
+	specStr, err := s.OpenAPI().Json()
 	if err != nil {
 		return errors.Wrap(err, "get openapi spec err")
 	}
+	s.openapiSpec.Store(&specStr)
+	s.openapiSpecOnce.Do(func() {
+		s.engine.GET(OpenAPISpecPath, append(s.openapiGuards(), func(c *gin.Context) {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", *s.openapiSpec.Load())
+		})...)
+	})
 
-	specStr, err := json.Marshal(spec)
-	if err != nil {
-		return errors.Wrap(err, "marshal openapi spec err")
+	docs := s.engine.Group(path, s.openapiGuards()...)
+	if err = s.registerOpenAPIUIPage(docs, path, "", OpenAPISpecPath, specStr, ui); err != nil {
+		return err
+	}
+
+	for _, v := range s.versions.list() {
+		versionSpec, err := v.openapi.Json()
+		if err != nil {
+			return errors.Wrapf(err, "get openapi spec of version %s err", v.name)
+		}
+		specPath := OpenAPIVersionSpecPath(v.name)
+		if _, loaded := s.openapiVersionSpecs.Swap(v.name, &versionSpec); !loaded {
+			name := v.name
+			s.engine.GET(specPath, append(s.openapiGuards(), func(c *gin.Context) {
+				spec, _ := s.openapiVersionSpecs.Load(name)
+				c.Data(http.StatusOK, "application/json; charset=utf-8", *spec.(*[]byte))
+			})...)
+		}
+		if err = s.registerOpenAPIUIPage(docs, path, v.name, specPath, versionSpec, ui); err != nil {
+			return err
+		}
+	}
+
+	for _, playground := range s.graphqls.list() {
+		pagePath := GraphQLPlaygroundPath(path, playground.endpoint)
+		assetsURL := ""
+		if playground.assets != nil {
+			assetsURL = pagePath + "/assets"
+			s.engine.Group(assetsURL, s.openapiGuards()...).StaticFS("/", http.FS(playground.assets))
+		}
+		html := []byte(renderGraphiQL(s.options.ServiceName+" GraphQL", playground.endpoint, assetsURL))
+		s.engine.GET(pagePath, append(s.openapiGuards(), func(c *gin.Context) {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+		})...)
+	}
+
+	return nil
+}
+
+// OpenAPIVersionSpecPath 版本文档的 spec 路由，例如 /openapi/v2.json
+func OpenAPIVersionSpecPath(version string) string {
+	return strings.TrimSuffix(OpenAPISpecPath, ".json") + "/" + version + ".json"
+}
+
+func (s *server) registerOpenAPIUIPage(docs gin.IRouter, path string, version string, specURL string, spec []byte, ui OpenAPIUIBuilder) error {
+	title := s.options.ServiceName
+	pagePath := ""
+	if version != "" {
+		title += " " + version
+		pagePath = "/" + version
 	}
-	s.engine.GET(path, func(c *gin.Context) {
-		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(ui.HTML(string(specStr), s.options.ServiceName)))
+
+	pageBuilder, ok := ui.(OpenAPIUIPageBuilder)
+	if !ok {
+		// 自定义的 UI 仍然内联 spec
+		html := []byte(ui.HTML(string(spec), title))
+		docs.GET(pagePath, func(c *gin.Context) {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+		})
+		return nil
+	}
+
+	page := OpenAPIUIPage{
+		Title:   title,
+		SpecURL: specURL,
+	}
+	if assets := pageBuilder.Assets(); assets != nil {
+		page.AssetsURL = path + "/assets"
+		// 所有版本的页面共用一份静态资源
+		if version == "" {
+			docs.StaticFS("/assets", http.FS(assets))
+		}
+	}
+	html := []byte(pageBuilder.Page(page))
+	docs.GET(pagePath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html)
 	})
 
 	return nil
 }
 
+// openapiGuards 文档相关路由的访问限制
+func (s *server) openapiGuards() []gin.HandlerFunc {
+	guards := make([]gin.HandlerFunc, 0, 2)
+	if len(s.options.OpenAPIAllowIPs) > 0 {
+		guards = append(guards, allowIPs(s.options.OpenAPIAllowIPs))
+	}
+	if len(s.options.OpenAPIBasicAuth) > 0 {
+		guards = append(guards, gin.BasicAuthForRealm(s.options.OpenAPIBasicAuth, s.options.ServiceName))
+	}
+	return guards
+}
+
+// allowIPs 只允许指定 IP 或网段访问，ips 支持 127.0.0.1 与 10.0.0.0/8 两种格式
+func allowIPs(ips []string) gin.HandlerFunc {
+	nets := make([]*net.IPNet, 0, len(ips))
+	for _, ip := range ips {
+		if !strings.Contains(ip, "/") {
+			if strings.Contains(ip, ":") {
+				ip += "/128"
+			} else {
+				ip += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(ip)
+		if err != nil {
+			logger.WithError(err).Errorf(context.Background(), "invalid allowed ip: %s", ip)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return func(c *gin.Context) {
+		clientIP := net.ParseIP(c.ClientIP())
+		for _, ipNet := range nets {
+			if clientIP != nil && ipNet.Contains(clientIP) {
+				c.Next()
+				return
+			}
+		}
+
+		body := &Body[EmptyType]{}
+		body.WithErr(ErrorWithCode(CodeForbidden).WithStatus(http.StatusForbidden))
+		c.AbortWithStatusJSON(body.status, body)
+	}
+}
+
 func (s *server) Run(ctx context.Context) error {
+	// 导出 openapi 文档模式，不启动服务，关闭已经初始化的组件后返回
+	if exported, err := s.exportOpenAPIFromEnv(); exported {
+		closeErr := s.Close(ctx)
+		if err != nil {
+			return errors.Wrap(err, "export openapi spec err")
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+		return ErrOpenAPIExported
+	}
+
 	run := func(options *ServerOptions) error {
 		logger.Infof(ctx, "http server is starting in port: %d", options.Port)
 		if err := s.ListenAndServe(); err != nil {
@@ -217,6 +476,15 @@ func (s *server) Run(ctx context.Context) error {
 		return nil
 	}
 
+	if s.admin != nil {
+		go func() {
+			logger.Infof(ctx, "admin server is starting in %s", s.admin.Addr)
+			if err := s.admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.WithError(err).Error(ctx, "admin server ListenAndServe err")
+			}
+		}()
+	}
+
 	if s.options.Daemon {
 		go run(s.options)
 	} else {
@@ -1,10 +1,14 @@
 package httpserver
 
 import (
+	"time"
+
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/ihezebin/olympus/requestid"
 )
 
 type ServerOptions struct {
@@ -19,15 +23,48 @@ type ServerOptions struct {
 	Metrics         bool               `json:"metrics" yaml:"metrics" toml:"metrics"`
 	TraceExporter   trace.SpanExporter `json:"trace_exporter" yaml:"trace_exporter" toml:"trace_exporter"`
 	LogProcessor    log.Processor      `json:"log_processor" yaml:"log_processor" toml:"log_processor"`
+	// OpenAPIBasicAuth 文档页面与 spec 的 basic auth 账号
+	OpenAPIBasicAuth gin.Accounts `json:"openapi_basic_auth" yaml:"openapi_basic_auth" toml:"openapi_basic_auth"`
+	// OpenAPIAllowIPs 允许访问文档页面与 spec 的 IP 或网段
+	OpenAPIAllowIPs []string `json:"openapi_allow_ips" yaml:"openapi_allow_ips" toml:"openapi_allow_ips"`
+	// ValidateRequest 按 openapi 文档校验请求，不符合时返回 CodeValidateRuleFailed
+	ValidateRequest bool `json:"validate_request" yaml:"validate_request" toml:"validate_request"`
+	// ValidateResponse 按 openapi 文档校验响应并记录不一致，有性能开销，建议只在开发环境开启
+	ValidateResponse bool `json:"validate_response" yaml:"validate_response" toml:"validate_response"`
+	// MaxBodyBytes 请求体大小限制，默认为 0 不限制，通过 WithServerMaxBodyBytes 开启，路由可以通过 WithMaxBodyBytes 覆盖
+	MaxBodyBytes int64 `json:"max_body_bytes" yaml:"max_body_bytes" toml:"max_body_bytes"`
+	// ReadHeaderTimeout 防止慢速客户端占用连接，默认 10s；其余超时默认为 0 不限制，
+	// 避免中断下载、代理与 SSE 等长时间的响应，需要时通过 WithTimeouts 设置
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout" yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `json:"read_timeout" yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `json:"write_timeout" yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout"`
+	// RequestIdHeader 请求 ID 的 header，默认 X-Request-Id，为空时不处理请求 ID
+	RequestIdHeader string `json:"request_id_header" yaml:"request_id_header" toml:"request_id_header"`
+	// Recovery 默认开启，panic 时返回 CodeInternalServerError
+	Recovery        bool             `json:"recovery" yaml:"recovery" toml:"recovery"`
+	RecoveryOptions []RecoveryOption `json:"-" yaml:"-" toml:"-"`
+	// Admission 准入控制，并发超过上限时按路由优先级返回 503
+	Admission        bool              `json:"admission" yaml:"admission" toml:"admission"`
+	AdmissionOptions []AdmissionOption `json:"-" yaml:"-" toml:"-"`
+	// Admin 管理接口，运行时修改日志级别、查看路由、构建信息与配置
+	Admin        bool          `json:"admin" yaml:"admin" toml:"admin"`
+	AdminOptions []AdminOption `json:"-" yaml:"-" toml:"-"`
+	// Batch 批量接口，一次请求执行多个路由
+	Batch        bool          `json:"batch" yaml:"batch" toml:"batch"`
+	BatchOptions []BatchOption `json:"-" yaml:"-" toml:"-"`
 }
 
 type ServerOption func(*ServerOptions)
 
 func mergeServerOptions(opts ...ServerOption) *ServerOptions {
 	opt := &ServerOptions{
-		Port:    8080,
-		Pprof:   true,
-		Metrics: true,
+		Port:              8080,
+		Pprof:             true,
+		Metrics:           true,
+		Recovery:          true,
+		RequestIdHeader:   requestid.Header,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 	for _, o := range opts {
 		o(opt)
@@ -114,3 +151,94 @@ func WithOpenAPIServer(server ...openapi3.Server) ServerOption {
 		o.OpenAPIServers = append(o.OpenAPIServers, server...)
 	}
 }
+
+// WithOpenAPIBasicAuth 文档页面、静态资源与 spec 需要 basic auth 认证
+func WithOpenAPIBasicAuth(accounts gin.Accounts) ServerOption {
+	return func(o *ServerOptions) {
+		o.OpenAPIBasicAuth = accounts
+	}
+}
+
+// WithOpenAPIAllowIPs 文档页面、静态资源与 spec 只允许指定 IP 或网段访问
+func WithOpenAPIAllowIPs(ips ...string) ServerOption {
+	return func(o *ServerOptions) {
+		o.OpenAPIAllowIPs = append(o.OpenAPIAllowIPs, ips...)
+	}
+}
+
+// WithRequestValidation 按 openapi 文档校验请求参数与请求体
+func WithRequestValidation(enable bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.ValidateRequest = enable
+	}
+}
+
+// WithResponseValidation 按 openapi 文档校验响应，只记录日志不影响响应
+func WithResponseValidation(enable bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.ValidateResponse = enable
+	}
+}
+
+// WithServerMaxBodyBytes 服务默认的请求体大小限制，例如 DefaultMaxBodyBytes，小于等于 0 表示不限制
+func WithServerMaxBodyBytes(limit int64) ServerOption {
+	return func(o *ServerOptions) {
+		o.MaxBodyBytes = limit
+	}
+}
+
+// WithTimeouts 设置 http.Server 的超时时间，为 0 表示不限制，write 会中断超过该时间的下载、代理与 SSE 响应
+func WithTimeouts(readHeader, read, write, idle time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.ReadHeaderTimeout = readHeader
+		o.ReadTimeout = read
+		o.WriteTimeout = write
+		o.IdleTimeout = idle
+	}
+}
+
+// WithRecovery 设置 panic 上报、去重与限流
+func WithRecovery(opts ...RecoveryOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.Recovery = true
+		o.RecoveryOptions = append(o.RecoveryOptions, opts...)
+	}
+}
+
+// WithoutRecovery 关闭默认的 Recovery，由 WithMiddlewares 自行处理 panic
+func WithoutRecovery() ServerOption {
+	return func(o *ServerOptions) {
+		o.Recovery = false
+	}
+}
+
+// WithRequestIdHeader 设置请求 ID 的 header，为空时不处理请求 ID
+func WithRequestIdHeader(header string) ServerOption {
+	return func(o *ServerOptions) {
+		o.RequestIdHeader = header
+	}
+}
+
+// WithAdmission 开启准入控制，默认并发上限为 1000，可以通过 WithAdmissionLimiter 使用自适应的上限
+func WithAdmission(opts ...AdmissionOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.Admission = true
+		o.AdmissionOptions = append(o.AdmissionOptions, opts...)
+	}
+}
+
+// WithAdmin 开启管理接口，需要通过 WithAdminToken、WithAdminMiddlewares 保护或通过 WithAdminPort 使用只监听本机的独立端口，否则 NewServer 返回错误
+func WithAdmin(opts ...AdminOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.Admin = true
+		o.AdminOptions = append(o.AdminOptions, opts...)
+	}
+}
+
+// WithBatch 开启批量接口，POST /batch 的请求体为 BatchRequest 数组，响应的 data 为按顺序的 BatchResult 数组
+func WithBatch(opts ...BatchOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.Batch = true
+		o.BatchOptions = append(o.BatchOptions, opts...)
+	}
+}
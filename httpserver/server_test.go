@@ -1,15 +1,48 @@
 package httpserver
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/ihezebin/olympus/httpclient"
 	"github.com/ihezebin/olympus/httpserver/middleware"
 	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/oss"
+	"github.com/ihezebin/olympus/pubsub"
+	"github.com/ihezebin/olympus/requestid"
+	"github.com/ihezebin/olympus/tenant"
 )
 
 var ctx = context.Background()
@@ -44,13 +77,1987 @@ func TestServer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := server.RunWithNotifySignal(ctx); err != nil {
+	// 在进程内执行请求，不监听端口
+	for _, path := range []string{"/stoplight", "/swagger", "/redoc", "/rapidoc", OpenAPISpecPath} {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status of %s: %d", path, w.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/hello/world", strings.NewReader(`{"content":"olympus"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"message":"olympus"`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExportOpenAPI(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.RegisterRoutes(&HelloRouter{})
+
+	buf := &bytes.Buffer{}
+	if err = server.ExportOpenAPI(buf, OpenAPIFormatYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(buf.String())
+
+	// 导出模式下 Run 不监听端口，返回 ErrOpenAPIExported
+	output := filepath.Join(t.TempDir(), "openapi.json")
+	t.Setenv(OpenAPIExportEnv, string(OpenAPIFormatJSON))
+	t.Setenv(OpenAPIExportOutputEnv, output)
+	if err = server.Run(ctx); !errors.Is(err, ErrOpenAPIExported) {
+		t.Fatalf("expected ErrOpenAPIExported, got %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !strings.Contains(string(data), `"openapi"`) {
+		t.Fatalf("unexpected exported spec: %v %s", err, data)
+	}
+}
+
+type versionRouter struct{}
+
+func (v *versionRouter) RegisterRoutes(router Router) {
+	reply := func(message string) handlerGenerator {
+		return NewHandler(func(c *gin.Context, req HelloReq) (string, error) {
+			return message + " " + c.GetString(VersionKey), nil
+		})
+	}
+
+	strategy := WithVersionStrategy(VersionStrategyPath | VersionStrategyHeader | VersionStrategyMediaType)
+	v1, _ := Version(router, "v1", strategy, WithDefaultVersion(),
+		WithVersionDeprecation(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), "https://example.com/migrate"),
+		WithVersionSunset(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)))
+	v1.GET("/hello", reply("hello"))
+	v1.Group("/items").GET("/list", reply("items"))
+
+	v2, _ := Version(router, "v2", strategy, WithVersionInherit("v1"))
+	v2.GET("/hello", reply("hi"))
+}
+
+// versionConflictRouter 在 versionRouter 注册之后再注册，路由都会失败
+type versionConflictRouter struct{}
+
+func (v *versionConflictRouter) RegisterRoutes(router Router) {
+	ok := NewHandler(func(c *gin.Context, req EmptyType) (EmptyType, error) {
+		return EmptyResponse, nil
+	})
+	v1, _ := Version(router, "v1")
+	v1.GET("/hello", ok)
+
+	v3, _ := Version(router, "v3", WithVersionStrategy(VersionStrategyHeader), WithVersionInherit("v9"))
+	v3.GET("/hello", ok)
+}
+
+func TestVersion(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.RegisterRoutes(&versionRouter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		target string
+		header map[string]string
+		status int
+		expect string
+	}{
+		{"/v1/hello", nil, http.StatusOK, "hello v1"},
+		{"/v2/hello", nil, http.StatusOK, "hi v2"},
+		{"/v2/items/list", nil, http.StatusOK, "items v2"},
+		{"/hello", nil, http.StatusOK, "hello v1"},
+		{"/hello", map[string]string{HeaderAcceptVersion: "v2"}, http.StatusOK, "hi v2"},
+		{"/hello", map[string]string{"Accept": "application/vnd.olympus.v2+json"}, http.StatusOK, "hi v2"},
+		{"/items/list", map[string]string{"Accept": "application/json; version=v2"}, http.StatusOK, "items v2"},
+		{"/hello", map[string]string{HeaderAcceptVersion: "v9"}, http.StatusBadRequest, "unsupported api version"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.expect) {
+			t.Fatalf("%s %v: unexpected response: %d %s", c.target, c.header, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/hello", nil))
+	if w.Header().Get(HeaderDeprecation) != "@1767225600" || w.Header().Get(HeaderSunset) != "Fri, 01 Jan 2027 00:00:00 GMT" {
+		t.Fatalf("unexpected deprecation headers: %v", w.Header())
+	}
+
+	spec, err := server.OpenAPIVersions()["v2"].Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Info.Version != "v2" || spec.Paths.Value("/v2/items/list") == nil || spec.Paths.Value("/v1/hello") != nil {
+		t.Fatalf("unexpected v2 spec paths: %v", spec.Paths.InMatchingOrder())
+	}
+	spec, err = server.OpenAPIVersions()["v1"].Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.Paths.Value("/v1/hello").Get.Deprecated {
+		t.Fatal("v1 should be deprecated")
+	}
+
+	if err = server.RegisterOpenAPIUI("/openapi", SwaggerUI); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIVersionSpecPath("v2"), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/v2/hello") {
+		t.Fatalf("unexpected v2 spec response: %d", w.Code)
+	}
+
+	// 通过 WithAssets 使用业务自己的资源
+	redoc := RedocUI.WithAssets(fstest.MapFS{"redoc.standalone.js": {Data: []byte("redoc")}})
+	if err = server.RegisterOpenAPIUI("/redoc", redoc); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/redoc", nil))
+	if !strings.Contains(w.Body.String(), `src="/redoc/assets/redoc.standalone.js"`) || strings.Contains(w.Body.String(), redocCDN) {
+		t.Fatalf("unexpected redoc page: %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/redoc/assets/redoc.standalone.js", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "redoc" {
+		t.Fatalf("unexpected redoc asset: %d %s", w.Code, w.Body.String())
+	}
+
+	// 内嵌资源缺少文件时从 CDN 加载
+	embedded := fstest.MapFS{"stoplight/web-components.min.js": {Data: []byte("elements")}}
+	if subOpenAPIUIAssets(embedded, "stoplight", "web-components.min.js", "styles.min.css") != nil {
+		t.Fatal("expect nil assets when styles.min.css is missing")
+	}
+	embedded["stoplight/styles.min.css"] = &fstest.MapFile{Data: []byte("styles")}
+	if sub := subOpenAPIUIAssets(embedded, "stoplight", "web-components.min.js", "styles.min.css"); sub == nil {
+		t.Fatal("expect embedded stoplight assets")
+	}
+
+	err = server.RegisterRoutes(&versionConflictRouter{})
+	for _, expect := range []string{
+		"route GET /hello is already registered in api version v1",
+		"api version v3 of GET /hello must be registered in the same RegisterRoutes call as other versions",
+		"api version v3 inherits unknown version v9",
+	} {
+		if err == nil || !strings.Contains(err.Error(), expect) {
+			t.Fatalf("expect error %q, got: %v", expect, err)
+		}
+	}
+}
+
+// validationVersionRouter 两个版本的同一路由请求体不同
+type validationVersionRouter struct{}
+
+func (v *validationVersionRouter) RegisterRoutes(router Router) {
+	type v1Req struct {
+		Name string `json:"name"`
+	}
+	type v2Req struct {
+		Name int `json:"name"`
+	}
+	strategy := WithVersionStrategy(VersionStrategyPath | VersionStrategyHeader)
+	v1, _ := Version(router, "v1", strategy, WithDefaultVersion())
+	v1.POST("/echo", NewHandler(func(c *gin.Context, req v1Req) (string, error) {
+		return req.Name, nil
+	}))
+	v2, _ := Version(router, "v2", strategy)
+	v2.POST("/echo", NewHandler(func(c *gin.Context, req v2Req) (int, error) {
+		return req.Name, nil
+	}))
+}
+
+func TestVersionValidation(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithRequestValidation(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.RegisterRoutes(&validationVersionRouter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		target  string
+		version string
+		body    string
+		status  int
+	}{
+		{"/v1/echo", "", `{"name":"olympus"}`, http.StatusOK},
+		{"/v1/echo", "", `{"name":1}`, http.StatusBadRequest},
+		{"/v2/echo", "", `{"name":1}`, http.StatusOK},
+		{"/v2/echo", "", `{"name":"olympus"}`, http.StatusBadRequest},
+		{"/echo", "", `{"name":"olympus"}`, http.StatusOK},
+		{"/echo", "", `{"name":1}`, http.StatusBadRequest},
+		{"/echo", "v2", `{"name":1}`, http.StatusOK},
+		{"/echo", "v2", `{"name":"olympus"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, c.target, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		if c.version != "" {
+			req.Header.Set(HeaderAcceptVersion, c.version)
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Fatalf("%s %s %s: unexpected response: %d %s", c.target, c.version, c.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+type limitRouter struct{}
+
+func (l *limitRouter) RegisterRoutes(router Router) {
+	echo := NewHandler(func(c *gin.Context, req map[string]any) (map[string]any, error) {
+		return req, nil
+	})
+	router.POST("/small", echo)
+	router.PostWithOptions("/large", echo, WithMaxBodyBytes(1024))
+}
+
+func TestBodyLimit(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithServerMaxBodyBytes(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.RegisterRoutes(&limitRouter{})
+	if server.ReadHeaderTimeout != 10*time.Second || server.ReadTimeout != 0 || server.WriteTimeout != 0 {
+		t.Fatalf("unexpected default timeouts: %v %v %v", server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout)
+	}
+
+	payload := `{"content":"` + strings.Repeat("a", 64) + `"}`
+	cases := []struct {
+		target  string
+		chunked bool
+		status  int
+	}{
+		{"/small", false, http.StatusRequestEntityTooLarge},
+		{"/small", true, http.StatusRequestEntityTooLarge},
+		{"/large", false, http.StatusOK},
+		{"/large", true, http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, c.target, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		if c.chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Fatalf("%s chunked=%v: unexpected response: %d %s", c.target, c.chunked, w.Code, w.Body.String())
+		}
+		if c.status == http.StatusRequestEntityTooLarge && !strings.Contains(w.Body.String(), `"code":13`) {
+			t.Fatalf("%s: unexpected body: %s", c.target, w.Body.String())
+		}
+	}
+
+	spec, err := server.OpenAPI().Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := spec.Paths.Value("/small").Post
+	if small.Responses.Status(http.StatusRequestEntityTooLarge) == nil || !strings.Contains(small.Description, "16B") {
+		t.Fatalf("body limit should be documented: %q", small.Description)
+	}
+	if !strings.Contains(spec.Paths.Value("/large").Post.Description, "1KB") {
+		t.Fatal("route body limit should be documented")
+	}
+}
+
+// memoryOSS 只实现下载需要的方法
+type memoryOSS struct {
+	oss.Client
+	objects map[string]string
+}
+
+func (m *memoryOSS) StatObject(ctx context.Context, name string) (*oss.ObjectInfo, error) {
+	return &oss.ObjectInfo{Key: name, Size: int64(len(m.objects[name])), ETag: "oss-etag", ContentType: "text/plain"}, nil
+}
+
+func (m *memoryOSS) GetObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(m.objects[name])), nil
+}
+
+type FileReq struct {
+	Name string `uri:"name"`
+}
+
+type downloadRouter struct{}
+
+func (d *downloadRouter) RegisterRoutes(router Router) {
+	client := &memoryOSS{objects: map[string]string{"docs/report.txt": "hello world"}}
+	router.GET("/files/:name", NewDownloadHandler(func(c *gin.Context, req FileReq) (*Download, error) {
+		if req.Name == "oss" {
+			return &Download{Object: &DownloadObject{Client: client, Key: "docs/report.txt"}}, nil
+		}
+		return &Download{Reader: strings.NewReader("hello world"), Filename: "报告.txt", ETag: "v1"}, nil
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.RegisterRoutes(&downloadRouter{})
+
+	cases := []struct {
+		target string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{"/files/local", nil, http.StatusOK, "hello world"},
+		{"/files/local", map[string]string{"Range": "bytes=0-4"}, http.StatusPartialContent, "hello"},
+		{"/files/local", map[string]string{"If-None-Match": `"v1"`}, http.StatusNotModified, ""},
+		{"/files/oss", nil, http.StatusOK, "hello world"},
+		{"/files/oss", map[string]string{"Range": "bytes=6-"}, http.StatusPartialContent, "world"},
+		{"/files/oss", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "rld"},
+		{"/files/oss", map[string]string{"Range": "bytes=20-"}, http.StatusRequestedRangeNotSatisfiable, ""},
+		{"/files/oss", map[string]string{"If-None-Match": `"oss-etag"`}, http.StatusNotModified, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		if w.Code != c.status || (c.body != "" && w.Body.String() != c.body) {
+			t.Fatalf("%s %v: unexpected response: %d %s", c.target, c.header, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/oss", nil))
+	if w.Header().Get("Content-Disposition") != `attachment; filename=report.txt` || w.Header().Get("ETag") != `"oss-etag"` {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/local", nil))
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "filename*=utf-8''") {
+		t.Fatalf("unexpected content disposition: %s", w.Header().Get("Content-Disposition"))
+	}
+
+	spec, err := server.OpenAPI().Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := spec.Paths.Value("/files/:name").Get.Responses.Status(http.StatusOK).Value
+	if response.Content.Get("application/json").Schema.Value.Format != "binary" || response.Headers["Content-Disposition"] == nil {
+		t.Fatal("download should be documented as binary")
+	}
+}
+
+type proxyRouter struct {
+	upstreams []string
+	spec      *openapi3.T
+}
+
+func (p *proxyRouter) RegisterRoutes(router Router) {
+	Proxy(router.Group("/gateway"), "/legacy",
+		WithProxyUpstreams(p.upstreams...),
+		WithProxyHeader("X-Gateway", "olympus"),
+		WithProxyRewrite("^/v1/(.*)", "/api/$1"),
+		WithProxyRetries(1),
+		WithProxyHealthCheck("/health", time.Hour),
+		WithProxyOpenAPISpec(p.spec, WithOpenAPITags("legacy")),
+	)
+}
+
+// proxyConfigRouter 配置错误的代理不会注册路由
+type proxyConfigRouter struct{}
+
+func (p *proxyConfigRouter) RegisterRoutes(router Router) {
+	Proxy(router, "/", WithProxyUpstreams("http://127.0.0.1:8080"))
+	Proxy(router, "/missing")
+	Proxy(router, "/invalid", WithProxyUpstreams("://127.0.0.1:8080"))
+	v2, _ := Version(router, "v2", WithVersionStrategy(VersionStrategyHeader))
+	Proxy(v2, "/legacy", WithProxyUpstreams("http://127.0.0.1:8080"))
+}
+
+func TestProxy(t *testing.T) {
+	var failed atomic.Int64
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		failed.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"path":        r.URL.Path,
+			"query":       r.URL.RawQuery,
+			"gateway":     r.Header.Get("X-Gateway"),
+			"traceparent": r.Header.Get("traceparent"),
+			"body":        string(body),
+		})
+	}))
+	defer healthy.Close()
+
+	spec := &openapi3.T{OpenAPI: "3.0.0", Info: &openapi3.Info{Title: "legacy", Version: "1"}, Paths: openapi3.NewPaths()}
+	spec.Paths.Set("/v1/users/{id}", &openapi3.PathItem{Get: &openapi3.Operation{
+		Summary: "get user",
+		Parameters: openapi3.Parameters{
+			{Value: openapi3.NewQueryParameter("fields").WithSchema(openapi3.NewStringSchema())},
+			{Value: openapi3.NewPathParameter("id").WithSchema(openapi3.NewIntegerSchema())},
+		},
+		Responses: openapi3.NewResponses(openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("ok")})),
+	}})
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只停止健康检查，关闭服务会关闭全局的 TracerProvider
+	defer server.proxies.Close(ctx)
+	if err = server.RegisterRoutes(&proxyRouter{upstreams: []string{broken.URL, healthy.URL}, spec: spec}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 幂等请求重试到健康的 upstream
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/gateway/legacy/v1/users/1?fields=name", strings.NewReader("data")))
+		got := map[string]string{}
+		if err = json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+		}
+		if got["path"] != "/api/users/1" || got["query"] != "fields=name" || got["gateway"] != "olympus" || got["traceparent"] == "" || got["body"] != "data" {
+			t.Fatalf("unexpected upstream request: %v", got)
+		}
+	}
+	if failed.Load() != 1 {
+		t.Fatalf("broken upstream should be tried once, got %d", failed.Load())
+	}
+
+	// 非幂等请求不重试
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/gateway/legacy/v1/users", strings.NewReader("data")))
+		if w.Code != http.StatusOK && w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("unexpected status: %d", w.Code)
+		}
+	}
+	if failed.Load() != 2 {
+		t.Fatalf("post should not be retried, broken upstream tried %d times", failed.Load())
+	}
+
+	specOut, err := server.OpenAPI().Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathItem := specOut.Paths.Value("/gateway/legacy/v1/users/:id")
+	if pathItem == nil || pathItem.Get == nil || pathItem.Get.Summary != "get user" || len(pathItem.Get.Tags) != 1 || pathItem.Get.Parameters.GetByInAndName("query", "fields") == nil {
+		t.Fatalf("proxy route should be documented from upstream spec: %+v", pathItem)
+	}
+
+	server, err = NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.RegisterRoutes(&proxyConfigRouter{})
+	for _, expect := range []string{
+		"proxy prefix can not be empty",
+		"failed to create proxy for /missing: proxy has no upstream",
+		"failed to create proxy for /invalid: invalid upstream",
+		"proxy /legacy in api version v2 requires VersionStrategyPath",
+	} {
+		if err == nil || !strings.Contains(err.Error(), expect) {
+			t.Fatalf("expect error %q, got: %v", expect, err)
+		}
+	}
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("misconfigured proxy should not be registered: %d", w.Code)
+	}
+}
+
+func TestProxyBalancer(t *testing.T) {
+	a := &upstream{url: &url.URL{Host: "a"}}
+	b := &upstream{url: &url.URL{Host: "b"}}
+	for _, u := range []*upstream{a, b} {
+		u.healthy.Store(true)
+	}
+	p := &proxy{options: mergeProxyOptions(WithProxyBalancer(ProxyBalancerLeastConn)), upstreams: []*upstream{a, b}}
+
+	a.active.Store(3)
+	for i := 0; i < 4; i++ {
+		if p.next(map[*upstream]bool{}) != b {
+			t.Fatal("least conn should select upstream with fewer connections")
+		}
+	}
+	b.healthy.Store(false)
+	if p.next(map[*upstream]bool{}) != a {
+		t.Fatal("unhealthy upstream should be skipped")
+	}
+
+	p.options.Balancer = ProxyBalancerRoundRobin
+	b.healthy.Store(true)
+	if first, second := p.next(map[*upstream]bool{}), p.next(map[*upstream]bool{}); first == second {
+		t.Fatal("round robin should alternate upstreams")
+	}
+}
+
+type graphqlRouter struct {
+	hello GraphQLExecutor
+	sum   GraphQLExecutor
+}
+
+func (g *graphqlRouter) RegisterRoutes(router Router) {
+	api := router.Group("/api")
+	GraphQL(api, "/graphql", g.hello, WithGraphQLPlaygroundAssets(fstest.MapFS{"graphiql.min.js": {Data: []byte("graphiql")}}))
+	GraphQL(api, "/sum", g.sum, WithGraphQLPlayground(false))
+	GraphQL(api, "/nil", GraphQLExecutorFunc(func(ctx context.Context, req GraphQLRequest) *GraphQLResponse {
+		return nil
+	}), WithGraphQLPlayground(false))
+}
+
+func TestGraphQL(t *testing.T) {
+	hello := GraphQLExecutorFunc(func(ctx context.Context, req GraphQLRequest) *GraphQLResponse {
+		c, ok := GraphQLGinContext(ctx)
+		if !ok {
+			return &GraphQLResponse{Errors: []GraphQLError{{Message: "gin context not found"}}}
+		}
+		return &GraphQLResponse{Data: map[string]any{"hello": req.Query + " from " + c.GetHeader("X-User")}}
+	})
+	sum := GraphQLExecutorFunc(func(ctx context.Context, req GraphQLRequest) *GraphQLResponse {
+		return &GraphQLResponse{Data: req.Variables}
+	})
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.RegisterRoutes(&graphqlRouter{hello: hello, sum: sum}); err != nil {
+		t.Fatal(err)
+	}
+	if err = server.RegisterOpenAPIUI("/openapi", SwaggerUI); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(path string, contentType string, body []byte) *GraphQLResponse {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-User", "alice")
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+		}
+		resp := &GraphQLResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	data, _ := json.Marshal(GraphQLRequest{Query: "{ hello }"})
+	resp := do("/api/graphql", "application/json", data)
+	if data, _ := json.Marshal(resp.Data); string(data) != `{"hello":"{ hello } from alice"}` || len(resp.Errors) > 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	resp = do("/api/graphql", "application/graphql", []byte("{ raw }"))
+	if data, _ := json.Marshal(resp.Data); string(data) != `{"hello":"{ raw } from alice"}` {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	data, _ = json.Marshal(GraphQLRequest{Query: "{ sum }", Variables: map[string]any{"a": 1}})
+	if resp = do("/api/sum", "application/json", data); fmt.Sprint(resp.Data) != "map[a:1]" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid request should be rejected: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/nil", bytes.NewReader(data)))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"errors"`) {
+		t.Fatalf("nil response should be an internal error: %d %s", w.Code, w.Body.String())
+	}
+
+	// 自托管的静态资源挂载在 playground 的 /assets 下
+	playground := GraphQLPlaygroundPath("/openapi", "/api/graphql")
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, playground, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"/api/graphql"`) ||
+		!strings.Contains(w.Body.String(), `src="`+playground+`/assets/graphiql.min.js"`) || strings.Contains(w.Body.String(), "unpkg.com") {
+		t.Fatalf("playground should be served: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, playground+"/assets/graphiql.min.js", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "graphiql" {
+		t.Fatalf("playground assets should be served: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, GraphQLPlaygroundPath("/openapi", "/api/sum"), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("playground should be disabled: %d", w.Code)
+	}
+
+	spec, err := server.OpenAPI().Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathItem := spec.Paths.Value("/api/graphql"); pathItem == nil || pathItem.Post == nil {
+		t.Fatal("graphql endpoint should be documented")
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	reports := make(chan *PanicReport, 4)
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithRecovery(
+		WithPanicReporters(PanicReporterFunc(func(ctx context.Context, report *PanicReport) error {
+			reports <- report
+			return nil
+		})),
+		WithPanicDedupWindow(time.Hour),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var span trace.Span
+	server.Engine().GET("/panic/:id", func(c *gin.Context) {
+		span = trace.SpanFromContext(c.Request.Context())
+		panic("boom")
+	})
+	server.Engine().GET("/broken", func(c *gin.Context) {
+		panic(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)})
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic/1", nil))
+		body := &Body[EmptyType]{}
+		if err = json.Unmarshal(w.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusInternalServerError || body.Code != CodeInternalServerError {
+			t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// 相同的 panic 在去重窗口内只上报一次
+	select {
+	case report := <-reports:
+		if report.Route != "/panic/:id" || report.Panic != "boom" || report.Count != 1 || len(report.Stack) == 0 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+		if !strings.Contains(report.Stack[0], "TestRecovery") {
+			t.Fatalf("stack should start from the panic: %s", report.Stack[0])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic should be reported")
+	}
+	select {
+	case report := <-reports:
+		t.Fatalf("duplicate panic should not be reported: %+v", report)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	readOnly, ok := span.(sdktrace.ReadOnlySpan)
+	if !ok || readOnly.Status().Code != codes.Error || len(readOnly.Events()) == 0 {
+		t.Fatal("span should be marked as error")
+	}
+
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/broken", nil))
+	if w.Code == http.StatusInternalServerError || w.Body.Len() != 0 {
+		t.Fatalf("broken connection should not write response: %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case report := <-reports:
+		t.Fatalf("broken connection should not be reported: %+v", report)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// http.ErrAbortHandler 继续 panic，由 net/http 中断连接
+	server.Engine().GET("/abort", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic(http.ErrAbortHandler)
+	})
+	func() {
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Fatalf("expected http.ErrAbortHandler re-panicked, got %v", r)
+			}
+		}()
+		server.Engine().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+	select {
+	case report := <-reports:
+		t.Fatalf("aborted handler should not be reported: %+v", report)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 超过限流后不再上报，去重窗口过后带上期间发生的次数
+	dispatcher := newPanicDispatcher(mergeRecoveryOptions(WithPanicDedupWindow(time.Minute), WithPanicRateLimit(2, time.Minute)))
+	now := time.Now()
+	allowed := make([]bool, 0)
+	for i, p := range []string{"a", "a", "b", "c"} {
+		allowed = append(allowed, dispatcher.allow(&PanicReport{Panic: p, Time: now.Add(time.Duration(i) * time.Second), Count: 1}))
+	}
+	if fmt.Sprint(allowed) != "[true false true false]" {
+		t.Fatalf("unexpected allowed: %v", allowed)
+	}
+	report := &PanicReport{Panic: "a", Time: now.Add(2 * time.Minute), Count: 1}
+	if !dispatcher.allow(report) || report.Count != 2 {
+		t.Fatalf("report after window should carry suppressed count: %+v", report)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger.ResetLoggerWithOptions(logger.WithOutput(output))
+	defer logger.ResetLoggerWithOptions()
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithMiddlewares(middleware.Logging(
+		middleware.WithLoggingHeader(true, false),
+		middleware.WithRedactJSONPaths("user.token"),
+		middleware.WithRedactPatterns(regexp.MustCompile(`1[3-9]\d{9}`)),
+		middleware.WithLoggingSampling(0, time.Second, http.StatusInternalServerError),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Engine().POST("/login/:id", func(c *gin.Context) {
+		body := &Body[EmptyType]{}
+		body.WithErr(ErrorWithInternalServer())
+		c.JSON(http.StatusInternalServerError, body)
+	})
+	server.Engine().POST("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	server.Engine().GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusInternalServerError, "image/png", []byte{0x89, 'P', 'N', 'G'})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login/1?phone=13800138000", strings.NewReader(`{"password":"p@ss","user":{"token":"t0k","name":"bob"},"items":[{"password":"x"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	server.Engine().ServeHTTP(httptest.NewRecorder(), req)
+	// 采样率为 0，正常请求不记录
+	server.Engine().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ok", nil))
+	server.Engine().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/image", nil))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected access logs: %s", output.String())
+	}
+	access := map[string]any{}
+	if err = json.Unmarshal([]byte(lines[0]), &access); err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"p@ss", "t0k", "Bearer secret", "13800138000", `"x"`} {
+		if strings.Contains(lines[0], leaked) {
+			t.Fatalf("%s should be redacted: %s", leaked, lines[0])
+		}
+	}
+	if access["route"] != "/login/:id" || access["code"] != float64(CodeInternalServerError) || access["latency"] == nil ||
+		!strings.Contains(access["request_body"].(string), `"name":"bob"`) {
+		t.Fatalf("unexpected access log: %s", lines[0])
+	}
+	if strings.HasSuffix(access["response_body"].(string), "...") {
+		t.Fatalf("short body should not be truncated: %s", access["response_body"])
+	}
+
+	image := map[string]any{}
+	if err = json.Unmarshal([]byte(lines[1]), &image); err != nil {
+		t.Fatal(err)
+	}
+	if image["response_body"] != "[image/png 4 bytes]" {
+		t.Fatalf("binary body should not be logged: %s", lines[1])
+	}
+
+	// 响应体只保存到 MaxBodyBytes，不记录响应体时只解析业务码
+	large := &Body[string]{Code: CodeBadRequest, Data: strings.Repeat("a", 1024)}
+	for _, opt := range []middleware.LoggingOption{middleware.WithLoggingMaxBodyBytes(16), middleware.WithLoggingBody(false, false)} {
+		output.Reset()
+		engine := gin.New()
+		engine.Use(middleware.Logging(opt))
+		engine.GET("/large", func(c *gin.Context) {
+			c.JSON(http.StatusOK, large)
+		})
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/large", nil))
+
+		access = map[string]any{}
+		if err = json.Unmarshal(output.Bytes(), &access); err != nil {
+			t.Fatal(err)
+		}
+		if access["code"] != float64(CodeBadRequest) {
+			t.Fatalf("business code should be logged: %s", output.String())
+		}
+		if body, ok := access["response_body"].(string); ok && (len(body) > 16+len("...") || !strings.HasSuffix(body, "...")) {
+			t.Fatalf("response body should be truncated: %s", body)
+		}
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger.ResetLoggerWithOptions(logger.WithOutput(output))
+	defer logger.ResetLoggerWithOptions()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get(requestid.Header)))
+	}))
+	defer upstream.Close()
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var span trace.Span
+	server.Engine().GET("/forward", func(c *gin.Context) {
+		span = trace.SpanFromContext(c.Request.Context())
+		logger.Info(c.Request.Context(), "forward")
+		resp, err := httpclient.NewRequest(c.Request.Context()).Get(upstream.URL)
+		if err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		c.String(http.StatusOK, resp.String())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/forward", nil)
+	req.Header.Set(requestid.Header, "ticket-42")
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, req)
+	if w.Header().Get(requestid.Header) != "ticket-42" || w.Body.String() != "ticket-42" {
+		t.Fatalf("request id should be echoed and forwarded: %s %s", w.Header().Get(requestid.Header), w.Body.String())
+	}
+	line := map[string]any{}
+	if err = json.Unmarshal(output.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line[logger.FieldKeyRequestId] != "ticket-42" || line[logger.FieldKeyTraceId] == nil {
+		t.Fatalf("log should contain request id and trace id: %s", output.String())
+	}
+	found := false
+	for _, attr := range span.(sdktrace.ReadOnlySpan).Attributes() {
+		found = found || (attr.Key == "http.request_id" && attr.Value.AsString() == "ticket-42")
+	}
+	if !found {
+		t.Fatal("request id should be recorded in span")
+	}
+
+	// 非法的请求 ID 重新生成
+	req = httptest.NewRequest(http.MethodGet, "/forward", nil)
+	req.Header.Set(requestid.Header, "bad id")
+	w = httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, req)
+	if id := w.Header().Get(requestid.Header); len(id) != 32 || w.Body.String() != id {
+		t.Fatalf("request id should be generated: %s %s", id, w.Body.String())
+	}
+}
+
+type admissionRouter struct {
+	release chan struct{}
+	started chan struct{}
+}
+
+func (a *admissionRouter) RegisterRoutes(router Router) {
+	block := NewHandler(func(c *gin.Context, req EmptyType) (EmptyType, error) {
+		a.started <- struct{}{}
+		<-a.release
+		return EmptyResponse, nil
+	})
+	ok := NewHandler(func(c *gin.Context, req EmptyType) (EmptyType, error) {
+		return EmptyResponse, nil
+	})
+	router.GET("/block", block)
+	router.GetWithOptions("/low", ok, WithPriority(PriorityLow))
+	router.GetWithOptions("/high", ok, WithPriority(PriorityHigh))
+	router.GroupWithOptions("/admin", WithPriority(PriorityCritical)).GET("/routes", ok)
+}
+
+func TestAdmission(t *testing.T) {
+	// 上限为 4，普通请求最多 3 个，低优先级请求最多 2 个
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithAdmission(
+		WithAdmissionLimiter(NewStaticLimiter(4)),
+		WithAdmissionReserve(0.25),
+		WithAdmissionRetryAfter(2*time.Second),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := &admissionRouter{release: make(chan struct{}), started: make(chan struct{}, 3)}
+	server.RegisterRoutes(router)
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	done := make(chan int, 3)
+	for i := 0; i < 2; i++ {
+		go func() { done <- do("/block").Code }()
+		<-router.started
+	}
+
+	// 并发为 2 时低优先级请求被拒绝
+	w := do("/low")
+	body := &Body[AdmissionRejected]{}
+	if err = json.Unmarshal(w.Body.Bytes(), body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" ||
+		body.Code != CodeServiceUnavailable || body.Data.RetryAfter != 2 {
+		t.Fatalf("low priority request should be shed: %d %s", w.Code, w.Body.String())
+	}
+
+	go func() { done <- do("/block").Code }()
+	<-router.started
+	if w = do("/block"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("normal request should be shed: %d", w.Code)
+	}
+	if w = do("/high"); w.Code != http.StatusOK {
+		t.Fatalf("high priority request should use the reserve: %d", w.Code)
+	}
+	for _, path := range []string{"/health", "/admin/routes"} {
+		if w = do(path); w.Code != http.StatusOK {
+			t.Fatalf("%s should never be shed: %d", path, w.Code)
+		}
+	}
+
+	close(router.release)
+	for i := 0; i < 3; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Fatalf("admitted request should succeed: %d", code)
+		}
+	}
+	if w = do("/low"); w.Code != http.StatusOK {
+		t.Fatalf("low priority request should be admitted after release: %d", w.Code)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	aimd := NewAIMDLimiter(AIMDLimiterConfig{Initial: 10, Min: 2, Max: 12, LatencyThreshold: 100 * time.Millisecond, BackoffRatio: 0.5})
+	for i := 0; i < 5; i++ {
+		aimd.Observe(10*time.Millisecond, aimd.Limit(), false)
+	}
+	if aimd.Limit() != 12 {
+		t.Fatalf("aimd limit should increase to max: %d", aimd.Limit())
+	}
+	aimd.Observe(time.Second, 12, false)
+	if aimd.Limit() != 6 {
+		t.Fatalf("aimd limit should back off on slow request: %d", aimd.Limit())
+	}
+
+	gradient := NewGradientLimiter(GradientLimiterConfig{Initial: 50, Min: 5, Max: 100, Tolerance: 1})
+	for i := 0; i < 50; i++ {
+		gradient.Observe(10*time.Millisecond, gradient.Limit(), false)
+	}
+	grown := gradient.Limit()
+	if grown <= 50 {
+		t.Fatalf("gradient limit should grow with stable latency: %d", grown)
+	}
+	for i := 0; i < 20; i++ {
+		gradient.Observe(100*time.Millisecond, gradient.Limit(), false)
+	}
+	if gradient.Limit() >= grown {
+		t.Fatalf("gradient limit should shrink when latency rises: %d >= %d", gradient.Limit(), grown)
+	}
+}
+
+type webhookRouter struct{}
+
+func (w *webhookRouter) RegisterRoutes(router Router) {
+	echo := NewHandler(func(c *gin.Context, req map[string]any) (map[string]any, error) {
+		return req, nil
+	})
+	secrets := WithWebhookSecrets("old", "new")
+	router.PostWithOptions("/github", echo, WithWebhookSignature(WebhookFormatGitHub, secrets))
+	router.PostWithOptions("/stripe", echo, WithWebhookSignature(WebhookFormatStripe, secrets), WithOpenAPIOptions(WithOpenAPISummary("stripe")))
+	// ReuseBody 在校验签名之前读取请求体
+	router.Group("/reuse").Use(middleware.ReuseBody()).PostWithOptions("/slack", echo, WithWebhookSignature(WebhookFormatSlack, secrets))
+}
+
+func TestWebhook(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.RegisterRoutes(&webhookRouter{})
+
+	payload := `{"event":"paid"}`
+	sign := func(secret, content string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(content))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	cases := []struct {
+		name   string
+		path   string
+		header map[string]string
+		status int
+	}{
+		{"github", "/github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("new", payload)}, http.StatusOK},
+		{"github rotated secret", "/github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("old", payload)}, http.StatusOK},
+		{"github wrong secret", "/github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("other", payload)}, http.StatusUnauthorized},
+		{"github missing signature", "/github", nil, http.StatusUnauthorized},
+		{"stripe", "/stripe", map[string]string{"Stripe-Signature": "t=" + now + ",v1=" + sign("other", now+"."+payload) + ",v1=" + sign("new", now+"."+payload)}, http.StatusOK},
+		{"stripe replay", "/stripe", map[string]string{"Stripe-Signature": "t=" + expired + ",v1=" + sign("new", expired+"."+payload)}, http.StatusUnauthorized},
+		{"slack", "/reuse/slack", map[string]string{"X-Slack-Signature": "v0=" + sign("old", "v0:"+now+":"+payload), "X-Slack-Request-Timestamp": now}, http.StatusOK},
+		{"slack tampered timestamp", "/reuse/slack", map[string]string{"X-Slack-Signature": "v0=" + sign("old", "v0:"+now+":"+payload), "X-Slack-Request-Timestamp": expired}, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		body := &Body[map[string]any]{}
+		if err = json.Unmarshal(w.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != c.status {
+			t.Fatalf("%s: unexpected status %d %s", c.name, w.Code, w.Body.String())
+		}
+		if c.status == http.StatusOK && body.Data["event"] != "paid" {
+			t.Fatalf("%s: body should be bound after verification: %s", c.name, w.Body.String())
+		}
+		if c.status == http.StatusUnauthorized && body.Code != CodeAuthorizationFailed {
+			t.Fatalf("%s: unexpected code %d", c.name, body.Code)
+		}
+	}
+
+	spec, err := server.OpenAPI().Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	operation := spec.Paths.Value("/stripe").Post
+	if operation.Parameters.GetByInAndName("header", "Stripe-Signature") == nil || operation.Responses.Value("401") == nil || operation.Summary != "stripe" {
+		t.Fatal("webhook signature should be documented")
+	}
+}
+
+type requestCounter struct {
+	count int
+}
+
+type helloDeps struct {
+	Counter *requestCounter
+	Name    string
+}
+
+type depsRouter struct {
+	t *testing.T
+}
+
+func (d *depsRouter) RegisterRoutes(router Router) {
+	router.GET("/deps", NewHandlerWithDeps(func(c *gin.Context, req HelloReq, deps helloDeps) (string, error) {
+		if MustResolve[*requestCounter](c) != deps.Counter {
+			d.t.Fatal("request scoped dependency should be shared in one request")
+		}
+		return deps.Name, nil
+	}))
+	router.GET("/deps/stringer", NewHandler(func(c *gin.Context, req EmptyType) (bool, error) {
+		stringer, err := Resolve[fmt.Stringer](c)
+		return stringer == nil, err
+	}))
+}
+
+func TestTenant(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger.ResetLoggerWithOptions(logger.WithOutput(output))
+	defer logger.ResetLoggerWithOptions()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Baggage")))
+	}))
+	defer upstream.Close()
+
+	secret := []byte("secret")
+	tenants := map[string]*tenant.Tenant{
+		"acme":   {ID: "acme", RateLimit: 1, Burst: 1, Config: map[string]any{"theme": "dark"}},
+		"globex": {ID: "globex"},
+	}
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := server.Engine().Group("/api", ResolveTenant(
+		WithTenantResolvers(
+			TenantFromHeader("X-Tenant-Id"),
+			TenantFromSubdomain("example.com"),
+			TenantFromJWTClaim("tid", func(token *jwt.Token) (any, error) { return secret, nil }),
+		),
+		WithTenantLoader(func(ctx context.Context, id string) (*tenant.Tenant, error) {
+			return tenants[id], nil
+		}),
+		WithTenantRateLimit(100, 100),
+	))
+	api.GET("/theme", func(c *gin.Context) {
+		logger.Info(c.Request.Context(), "theme")
+		c.String(http.StatusOK, tenant.IDFromContext(c.Request.Context())+":"+tenant.Config(c.Request.Context(), "theme", "light"))
+	})
+	api.GET("/forward", func(c *gin.Context) {
+		resp, err := httpclient.NewRequest(c.Request.Context()).Get(upstream.URL)
+		if err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		c.String(http.StatusOK, resp.String())
+	})
+
+	serve := func(host string, header http.Header, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		return w
+	}
+	code := func(w *httptest.ResponseRecorder) Code {
+		body := &Body[any]{}
+		if err := json.Unmarshal(w.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Code
+	}
+
+	// header
+	w := serve("api.test", http.Header{"X-Tenant-Id": {"globex"}}, "/api/theme")
+	if w.Code != http.StatusOK || w.Body.String() != "globex:light" {
+		t.Fatalf("tenant should be resolved from header: %d %s", w.Code, w.Body.String())
+	}
+	line := map[string]any{}
+	if err = json.Unmarshal(output.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line[logger.FieldKeyTenantId] != "globex" {
+		t.Fatalf("log should contain tenant id: %s", output.String())
+	}
+
+	// 子域名，租户的配置覆盖
+	w = serve("acme.example.com:8080", nil, "/api/theme")
+	if w.Code != http.StatusOK || w.Body.String() != "acme:dark" {
+		t.Fatalf("tenant should be resolved from subdomain: %d %s", w.Code, w.Body.String())
+	}
+	// 租户的限流覆盖默认限流
+	w = serve("acme.example.com", nil, "/api/theme")
+	if w.Code != http.StatusTooManyRequests || code(w) != CodeTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("tenant should be rate limited: %d %s", w.Code, w.Body.String())
+	}
+
+	// jwt
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tid": "globex"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = serve("api.test", http.Header{"Authorization": {"Bearer " + token}}, "/api/forward")
+	if w.Code != http.StatusOK || w.Body.String() != tenant.BaggageKey+"=globex" {
+		t.Fatalf("tenant should be resolved from jwt and forwarded by baggage: %d %s", w.Code, w.Body.String())
+	}
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tid": "globex"}).SignedString([]byte("forged"))
+	w = serve("api.test", http.Header{"Authorization": {"Bearer " + forged}}, "/api/theme")
+	if w.Code != http.StatusUnauthorized || code(w) != CodeAuthorizationFailed {
+		t.Fatalf("forged jwt should be rejected: %d %s", w.Code, w.Body.String())
+	}
+
+	// 无法获取租户、租户不存在
+	w = serve("example.com", nil, "/api/theme")
+	if w.Code != http.StatusBadRequest || code(w) != CodeTenantUnresolved {
+		t.Fatalf("missing tenant should be rejected: %d %s", w.Code, w.Body.String())
+	}
+	w = serve("initech.example.com", nil, "/api/theme")
+	if w.Code != http.StatusForbidden || code(w) != CodeTenantUnresolved {
+		t.Fatalf("unknown tenant should be rejected: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenantLimiters(t *testing.T) {
+	limiters := newTenantLimiters(mergeTenantOptions(WithTenantRateLimit(1, 1), WithTenantMaxLimiters(2)))
+	a := limiters.get(&tenant.Tenant{ID: "a"})
+	limiters.get(&tenant.Tenant{ID: "b"})
+	if limiters.get(&tenant.Tenant{ID: "a"}) != a {
+		t.Fatal("limiter of the same tenant should be reused")
+	}
+	// b 最久未访问，被淘汰
+	limiters.get(&tenant.Tenant{ID: "c"})
+	if len(limiters.limiters) != 2 || limiters.limiters["b"] != nil || limiters.get(&tenant.Tenant{ID: "a"}) != a {
+		t.Fatalf("least recently used tenant should be evicted: %v", limiters.limiters)
+	}
+}
+
+type exportRequest struct {
+	Name string `json:"name"`
+	Fail bool   `json:"fail"`
+}
+
+type exportResponse struct {
+	URL string `json:"url"`
+}
+
+// chanPubSub 在测试中代替队列
+type chanPubSub struct {
+	messages chan pubsub.ProducerMessage
+}
+
+type chanMessage struct {
+	pubsub.ConsumerMessage
+	msg pubsub.ProducerMessage
+}
+
+func (m *chanMessage) Payload() []byte               { return m.msg.Payload }
+func (m *chanMessage) Properties() map[string]string { return m.msg.Properties }
+func (m *chanMessage) Ack() error                    { return nil }
+
+func (p *chanPubSub) Close() error { return nil }
+
+func (p *chanPubSub) Send(ctx context.Context, msg pubsub.ProducerMessage) error {
+	p.messages <- msg
+	return nil
+}
+
+func (p *chanPubSub) SendAsync(ctx context.Context, msg pubsub.ProducerMessage, callback func(pubsub.ProducerMessage, error)) {
+	callback(msg, p.Send(ctx, msg))
+}
+
+func (p *chanPubSub) Receive(ctx context.Context, handler pubsub.MessageHandler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-p.messages:
+			_ = handler(ctx, &chanMessage{msg: msg})
+		}
+	}
+}
+
+type asyncRouter struct {
+	exports AsyncRoute
+	queued  AsyncRoute
+}
+
+func (a *asyncRouter) RegisterRoutes(router Router) {
+	Async(router, "/exports", a.exports)
+	Async(router, "/queued", a.queued)
+}
+
+func TestAsync(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req exportRequest, progress JobProgress) (exportResponse, error) {
+		progress(0.5, "exporting")
+		<-release
+		if req.Fail {
+			return exportResponse{}, NewError(CodeBadRequest, "export failed")
+		}
+		return exportResponse{URL: "/files/" + req.Name + ".xlsx"}, nil
+	}
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := &chanPubSub{messages: make(chan pubsub.ProducerMessage, 1)}
+	store := NewMemoryJobStore(time.Minute)
+	server.RegisterRoutes(&asyncRouter{
+		exports: NewAsyncHandler(handler),
+		queued:  NewAsyncHandler(handler, WithJobStore(store), WithJobPublisher(queue)),
+	})
+	// 其他进程中的 worker 使用同一个 store
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = NewAsyncHandler(handler, WithJobStore(store)).Work(workerCtx, queue)
+	}()
+
+	submit := func(path string, export exportRequest) JobAccepted {
+		data, _ := json.Marshal(export)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		body := &Body[JobAccepted]{}
+		if err := json.Unmarshal(w.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusAccepted || body.Code != CodeAccepted || body.Data.ID == "" || w.Header().Get("Location") != body.Data.StatusURL {
+			t.Fatalf("job should be accepted: %d %s", w.Code, w.Body.String())
+		}
+		return body.Data
+	}
+	state := func(url string) (int, *Body[JobState[exportResponse]]) {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		body := &Body[JobState[exportResponse]]{}
+		if err := json.Unmarshal(w.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, body
+	}
+	wait := func(url string, status JobStatus) *Body[JobState[exportResponse]] {
+		for i := 0; i < 100; i++ {
+			if _, body := state(url); body.Data.Status == status {
+				return body
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job %s should be %s", url, status)
+		return nil
+	}
+
+	for _, path := range []string{"/exports", "/queued"} {
+		accepted := submit(path, exportRequest{Name: "report"})
+		if accepted.StatusURL != path+"/jobs/"+accepted.ID {
+			t.Fatalf("unexpected status url: %s", accepted.StatusURL)
+		}
+		running := wait(accepted.StatusURL, JobStatusRunning)
+		if running.Data.Progress != 0.5 || running.Data.Message != "exporting" || running.Data.Result != nil {
+			t.Fatalf("running job should report progress: %+v", running.Data)
+		}
+		release <- struct{}{}
+		done := wait(accepted.StatusURL, JobStatusSucceeded)
+		if done.Data.Progress != 1 || done.Data.Result == nil || done.Data.Result.Code != CodeOK || done.Data.Result.Data.URL != "/files/report.xlsx" {
+			t.Fatalf("succeeded job should contain result: %+v", done.Data)
+		}
+
+		accepted = submit(path, exportRequest{Name: "report", Fail: true})
+		release <- struct{}{}
+		failed := wait(accepted.StatusURL, JobStatusFailed)
+		if failed.Data.Result == nil || failed.Data.Result.Code != CodeBadRequest || failed.Data.Result.Message != "export failed" {
+			t.Fatalf("failed job should contain error: %+v", failed.Data)
+		}
+	}
+
+	// 重复投递的任务只领取一次
+	pending := &Job{ID: "duplicated", Status: JobStatusPending}
+	if err = store.Save(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.Claim(ctx, pending.ID)
+	if err != nil || claimed == nil || claimed.Status != JobStatusRunning {
+		t.Fatalf("pending job should be claimed: %+v %v", claimed, err)
+	}
+	if claimed, err = store.Claim(ctx, pending.ID); err != nil || claimed != nil {
+		t.Fatalf("job should be claimed only once: %+v %v", claimed, err)
+	}
+
+	if code, body := state("/exports/jobs/unknown"); code != http.StatusNotFound || body.Code != CodeNotFound {
+		t.Fatalf("unknown job should be not found: %d %+v", code, body)
+	}
+
+	spec, err := server.OpenAPI().Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := spec.Paths.Value("/exports").Post
+	if post.Responses.Value("202") == nil || post.Responses.Value("200") != nil {
+		t.Fatal("submit route should be documented as 202")
+	}
+	if spec.Paths.Value("/exports/jobs/:id").Get == nil {
+		t.Fatal("job state route should be documented")
+	}
+}
+
+func TestAsyncWorkers(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req exportRequest, progress JobProgress) (exportResponse, error) {
+		started <- struct{}{}
+		<-release
+		return exportResponse{URL: "/files/" + req.Name + ".xlsx"}, nil
+	}
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.RegisterRoutes(&asyncRouter{
+		exports: NewAsyncHandler(handler, WithJobWorkers(1, 1)),
+		queued:  NewAsyncHandler(handler),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	submit := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/exports", strings.NewReader(`{"name":"report"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 一个任务在执行，一个任务等待，超出队列的任务被拒绝
+	if code := submit(); code != http.StatusAccepted {
+		t.Fatalf("job should be accepted: %d", code)
+	}
+	<-started
+	if code := submit(); code != http.StatusAccepted {
+		t.Fatalf("job should be queued: %d", code)
+	}
+	if code := submit(); code != http.StatusServiceUnavailable {
+		t.Fatalf("job should be rejected when queue is full: %d", code)
+	}
+
+	// 关闭时等待已经提交的任务执行完成
+	closed := make(chan error, 1)
+	go func() {
+		closed <- server.asyncs.Close(ctx)
+	}()
+	close(release)
+	if err = <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if len(started) != 1 {
+		t.Fatal("queued job should be executed before close returns")
+	}
+	if code := submit(); code != http.StatusServiceUnavailable {
+		t.Fatalf("job should be rejected after close: %d", code)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	logger.ResetLoggerWithOptions(logger.WithOutput(io.Discard), logger.WithLevel(logger.LevelInfo))
+	defer logger.ResetLoggerWithOptions()
+
+	type database struct {
+		Host     string `json:"host"`
+		Password string `json:"password"`
+	}
+	cfg := struct {
+		Name      string     `json:"name"`
+		ApiKey    string     `json:"api_key"`
+		Databases []database `json:"databases"`
+	}{Name: "test", ApiKey: "key", Databases: []database{{Host: "localhost", Password: "123456"}}}
+
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(),
+		WithAdmin(WithAdminToken("admin-token"), WithAdminConfig(cfg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Engine().GET("/hello", middleware.RequestId("X-Trace-Id"), func(c *gin.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+
+	serve := func(method, path, body string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, data any) {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &Body[any]{Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if w := serve(http.MethodGet, "/admin/log/level", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/admin/log/level", "", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", w.Code)
+	}
+
+	level := AdminLogLevel{}
+	decode(serve(http.MethodGet, "/admin/log/level", "", "admin-token"), &level)
+	if level.Level != logger.LevelInfo || level.RevertAt != nil {
+		t.Fatalf("unexpected level: %+v", level)
+	}
+	if w := serve(http.MethodPut, "/admin/log/level", `{"level":"verbose"}`, "admin-token"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid level, got %d", w.Code)
+	}
+	decode(serve(http.MethodPut, "/admin/log/level", `{"level":"debug","ttl":"100ms"}`, "admin-token"), &level)
+	if level.Level != logger.LevelDebug || level.RevertAt == nil {
+		t.Fatalf("unexpected level: %+v", level)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if logger.GetLevel() != logger.LevelInfo || !logger.LevelRevertAt().IsZero() {
+		t.Fatalf("expected level reverted to info, got %s", logger.GetLevel())
+	}
+
+	routes := make([]AdminRoute, 0)
+	decode(serve(http.MethodGet, "/admin/routes", "", "admin-token"), &routes)
+	var hello *AdminRoute
+	for i := range routes {
+		if routes[i].Method == http.MethodGet && routes[i].Path == "/hello" {
+			hello = &routes[i]
+		}
+	}
+	if hello == nil {
+		t.Fatalf("route /hello not listed: %+v", routes)
+	}
+	middlewares := strings.Join(hello.Middlewares, ",")
+	if !strings.Contains(middlewares, "middleware.RequestId") || !strings.Contains(middlewares, "Middleware") {
+		t.Fatalf("unexpected middlewares: %v", hello.Middlewares)
+	}
+
+	build := AdminBuildInfo{}
+	decode(serve(http.MethodGet, "/admin/build", "", "admin-token"), &build)
+	if build.ServiceName != "test_server" || build.GoVersion == "" {
+		t.Fatalf("unexpected build info: %+v", build)
+	}
+
+	settings := map[string]any{}
+	decode(serve(http.MethodGet, "/admin/config", "", "admin-token"), &settings)
+	data, _ := json.Marshal(settings)
+	if strings.Contains(string(data), "123456") || strings.Contains(string(data), `"key"`) || !strings.Contains(string(data), "localhost") {
+		t.Fatalf("unexpected config: %s", data)
+	}
+
+	// 注册在服务的路由上时必须有保护
+	if _, err = NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithAdmin()); err == nil {
+		t.Fatal("expected err for unprotected admin routes")
+	}
+
+	// 独立端口时不注册在服务的路由上
+	server, err = NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithAdmin(WithAdminPort(9091)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.admin.Addr != "127.0.0.1:9091" {
+		t.Fatalf("admin server should listen on loopback by default: %s", server.admin.Addr)
+	}
+	if w := serve(http.MethodGet, "/admin/log/level", "", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 on service port, got %d", w.Code)
+	}
+	w := httptest.NewRecorder()
+	server.admin.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without config, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	server.admin.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/health") {
+		t.Fatalf("unexpected routes: %d %s", w.Code, w.Body.String())
+	}
+
+	// 独立端口监听其他地址时同样需要保护
+	if _, err = NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithAdmin(WithAdminPort(9091), WithAdminHost("0.0.0.0"))); err == nil {
+		t.Fatal("expected err for unprotected admin server on public host")
+	}
+	server, err = NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithAdmin(WithAdminPort(9091), WithAdminHost("0.0.0.0"), WithAdminToken("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.admin.Addr != "0.0.0.0:9091" {
+		t.Fatalf("unexpected admin addr: %s", server.admin.Addr)
+	}
+}
+
+func TestSession(t *testing.T) {
+	userIdKey := SessionKey[int64]("user_id")
+	newEngine := func(store SessionStore, keys ...[]byte) *gin.Engine {
+		engine := gin.New()
+		admin := engine.Group("/admin", Sessions(WithSessionKeys(keys...), WithSessionStore(store), WithSessionCookie("/", "", false, http.SameSiteLaxMode)))
+		admin.POST("/login", func(c *gin.Context) {
+			SessionFromContext(c).Regenerate()
+			if err := userIdKey.Set(c, 42); err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+			c.String(http.StatusOK, SessionFromContext(c).ID())
+		})
+		admin.GET("/me", func(c *gin.Context) {
+			userId, ok := userIdKey.Get(c)
+			c.String(http.StatusOK, "%d %v", userId, ok)
+		})
+		admin.POST("/logout", func(c *gin.Context) {
+			SessionFromContext(c).Destroy()
+			c.Status(http.StatusNoContent)
+		})
+		forms := admin.Group("/forms", CSRF(WithCSRFCookie("csrf_token", "/", "", false)))
+		forms.GET("", func(c *gin.Context) {
+			c.String(http.StatusOK, CSRFToken(c))
+		})
+		forms.POST("", func(c *gin.Context) {
+			c.String(http.StatusOK, "submitted")
+		})
+		return engine
+	}
+
+	type client struct {
+		engine  *gin.Engine
+		cookies map[string]*http.Cookie
+	}
+	do := func(cl *client, method, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		for _, cookie := range cl.cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		cl.engine.ServeHTTP(w, req)
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.MaxAge < 0 {
+				delete(cl.cookies, cookie.Name)
+				continue
+			}
+			cl.cookies[cookie.Name] = cookie
+		}
+		return w
+	}
+
+	for name, store := range map[string]SessionStore{"cookie": NewCookieSessionStore(), "memory": NewMemorySessionStore()} {
+		t.Run(name, func(t *testing.T) {
+			key := []byte("session-key")
+			cl := &client{engine: newEngine(store, key), cookies: map[string]*http.Cookie{}}
+			if w := do(cl, http.MethodGet, "/admin/me", nil); w.Body.String() != "0 false" || len(cl.cookies) != 0 {
+				t.Fatalf("unexpected anonymous session: %s %v", w.Body.String(), cl.cookies)
+			}
+
+			w := do(cl, http.MethodPost, "/admin/login", nil)
+			firstId := w.Body.String()
+			cookie := cl.cookies["session"]
+			if cookie == nil || !cookie.HttpOnly || strings.Contains(cookie.Value, "42") {
+				t.Fatalf("unexpected session cookie: %+v", cookie)
+			}
+			if w = do(cl, http.MethodGet, "/admin/me", nil); w.Body.String() != "42 true" {
+				t.Fatalf("unexpected session value: %s", w.Body.String())
+			}
+
+			// 再次登录更换会话 ID，旧的 cookie 在服务端存储时失效
+			oldCookie := *cookie
+			if w = do(cl, http.MethodPost, "/admin/login", nil); w.Body.String() == firstId {
+				t.Fatal("expected session id regenerated")
+			}
+			stale := &client{engine: cl.engine, cookies: map[string]*http.Cookie{"session": &oldCookie}}
+			expected := "0 false"
+			if name == "cookie" {
+				expected = "42 true"
+			}
+			if w = do(stale, http.MethodGet, "/admin/me", nil); w.Body.String() != expected {
+				t.Fatalf("unexpected stale session: %s", w.Body.String())
+			}
+
+			// 篡改或使用其他密钥加密的 cookie 视为新会话
+			value := []byte(cl.cookies["session"].Value)
+			value[20] ^= 1
+			tampered := &client{engine: cl.engine, cookies: map[string]*http.Cookie{"session": {Name: "session", Value: string(value)}}}
+			if w = do(tampered, http.MethodGet, "/admin/me", nil); w.Body.String() != "0 false" {
+				t.Fatalf("unexpected tampered session: %s", w.Body.String())
+			}
+			rotated := &client{engine: newEngine(store, []byte("new-key"), key), cookies: cl.cookies}
+			if w = do(rotated, http.MethodGet, "/admin/me", nil); w.Body.String() != "42 true" {
+				t.Fatalf("unexpected session after key rotation: %s", w.Body.String())
+			}
+
+			// csrf
+			w = do(cl, http.MethodGet, "/admin/forms", nil)
+			token := w.Body.String()
+			if token == "" || cl.cookies["csrf_token"] == nil || cl.cookies["csrf_token"].Value != token || cl.cookies["csrf_token"].HttpOnly {
+				t.Fatalf("unexpected csrf token: %s %+v", token, cl.cookies["csrf_token"])
+			}
+			if w = do(cl, http.MethodPost, "/admin/forms", nil); w.Code != http.StatusForbidden {
+				t.Fatalf("expected 403 without csrf token, got %d", w.Code)
+			}
+			if w = do(cl, http.MethodPost, "/admin/forms", http.Header{"X-Csrf-Token": {"wrong"}}); w.Code != http.StatusForbidden {
+				t.Fatalf("expected 403 with wrong csrf token, got %d", w.Code)
+			}
+			if w = do(cl, http.MethodPost, "/admin/forms", http.Header{"X-Csrf-Token": {token}}); w.Code != http.StatusOK {
+				t.Fatalf("expected 200 with csrf token, got %d", w.Code)
+			}
+			// 没有开启 csrf 的分组不校验
+			if w = do(cl, http.MethodPost, "/admin/logout", nil); w.Code != http.StatusNoContent || cl.cookies["session"] != nil {
+				t.Fatalf("unexpected logout: %d %v", w.Code, cl.cookies)
+			}
+			if w = do(cl, http.MethodGet, "/admin/me", nil); w.Body.String() != "0 false" {
+				t.Fatalf("unexpected session after logout: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+type staticRouter struct {
+	fsys fs.FS
+}
+
+func (r *staticRouter) RegisterRoutes(router Router) {
+	Static(router, "/console", r.fsys, WithStaticSPA())
+	Static(router.Group("/docs"), "/", r.fsys)
+	Static(router, "/", r.fsys)
+}
+
+func TestStatic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":                    {Data: []byte("<html>index</html>")},
+		"favicon.ico":                   {Data: []byte("icon")},
+		".env":                          {Data: []byte("SECRET=1")},
+		"assets/index-BkL3xQ2a.js":      {Data: []byte("console.log('app')")},
+		"assets/index-BkL3xQ2a.js.br":   {Data: []byte("br")},
+		"assets/index-BkL3xQ2a.js.gz":   {Data: []byte("gz")},
+		"assets/vendor.3f9a1c2e.css":    {Data: []byte("body{}")},
+		"assets/vendor.3f9a1c2e.css.gz": {Data: []byte("gz")},
+		"settings/index.html":           {Data: []byte("<html>settings</html>")},
+	}
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分组上的根路径不会注册，其他静态路由不受影响
+	if err = server.RegisterRoutes(&staticRouter{fsys: fsys}); err == nil || !strings.Contains(err.Error(), "static prefix / can not be root of group /docs") {
+		t.Fatalf("unexpected register error: %v", err)
+	}
+
+	serve := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/console/", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "<html>index</html>" || w.Header().Get("Cache-Control") != "no-cache" || w.Header().Get("ETag") == "" {
+		t.Fatalf("unexpected index: %d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+	if w = serve(http.MethodGet, "/console/", http.Header{"If-None-Match": {w.Header().Get("ETag")}}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+	if w = serve(http.MethodGet, "/console/settings", nil); w.Body.String() != "<html>settings</html>" {
+		t.Fatalf("unexpected directory index: %s", w.Body.String())
+	}
+
+	// 前端路由回退到 index.html，缺失的资源文件与隐藏文件返回 404
+	if w = serve(http.MethodGet, "/console/users/42", nil); w.Code != http.StatusOK || w.Body.String() != "<html>index</html>" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("unexpected spa fallback: %d %s", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/console/assets/missing.js", "/console/.env", "/console/../.env"} {
+		if w = serve(http.MethodGet, path, nil); w.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", path, w.Code)
+		}
+	}
+	if w = serve(http.MethodGet, "/docs/users/42", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without spa, got %d", w.Code)
+	}
+
+	// 包含 hash 的文件长期缓存，按 Accept-Encoding 返回预压缩的文件
+	w = serve(http.MethodGet, "/console/assets/index-BkL3xQ2a.js", http.Header{"Accept-Encoding": {"gzip, deflate, br"}})
+	if w.Body.String() != "br" || w.Header().Get("Content-Encoding") != "br" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") ||
+		w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("unexpected br asset: %s %v", w.Body.String(), w.Header())
+	}
+	if w = serve(http.MethodGet, "/console/assets/index-BkL3xQ2a.js", http.Header{"Accept-Encoding": {"gzip, br;q=0"}}); w.Body.String() != "gz" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("unexpected gzip asset: %s %v", w.Body.String(), w.Header())
+	}
+	if w = serve(http.MethodGet, "/console/assets/vendor.3f9a1c2e.css", nil); w.Body.String() != "body{}" || w.Header().Get("Content-Encoding") != "" ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") || !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Fatalf("unexpected css asset: %s %v", w.Body.String(), w.Header())
+	}
+	if w = serve(http.MethodGet, "/console/favicon.ico", nil); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("unexpected favicon cache: %v", w.Header())
+	}
+	if w = serve(http.MethodHead, "/console/favicon.ico", nil); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("unexpected head: %d %s", w.Code, w.Body.String())
+	}
+
+	// 根路径通过 NoRoute 提供，不影响其他路由
+	if w = serve(http.MethodGet, "/favicon.ico", nil); w.Body.String() != "icon" {
+		t.Fatalf("unexpected root static: %d %s", w.Code, w.Body.String())
+	}
+	if w = serve(http.MethodGet, "/health", nil); w.Body.String() != "ok" {
+		t.Fatalf("unexpected health: %s", w.Body.String())
+	}
+	if w = serve(http.MethodPost, "/favicon.ico", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for post, got %d", w.Code)
+	}
+
+	if !hashedFileName("app.3f9a1c2e.js") || !hashedFileName("index-BkL3xQ2a.js.map") || hashedFileName("index-settings.js") || hashedFileName("favicon.ico") {
+		t.Fatal("unexpected hashed file name detection")
+	}
+
+	spec, err := server.OpenAPI().Json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(spec), "/console") {
+		t.Fatalf("static routes should not be in openapi: %s", spec)
+	}
+}
+
+type memoryRecordWriter struct {
+	mu      sync.Mutex
+	entries []middleware.HAREntry
+}
+
+func (w *memoryRecordWriter) WriteRecords(ctx context.Context, entries []middleware.HAREntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries = append(w.entries, entries...)
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	writer := &memoryRecordWriter{}
+	recorder := middleware.NewRecorder(writer, middleware.WithRecordBuffer(10, 1, time.Second), middleware.WithRecordRedactPatterns(regexp.MustCompile(`1[3-9]\d{9}`)))
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog(), WithMiddlewares(recorder.Middleware()),
+		WithAdmin(WithAdminToken("admin-token"), WithAdminRecorder(recorder)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Engine().POST("/orders/:id", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"id": c.Param("id"), "password": "123456"}})
+	})
+
+	serve := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, req)
+		return w
+	}
+	records := func() []middleware.HAREntry {
+		time.Sleep(50 * time.Millisecond)
+		writer.mu.Lock()
+		defer writer.mu.Unlock()
+		return append([]middleware.HAREntry{}, writer.entries...)
+	}
+	admin := http.Header{"Authorization": {"Bearer admin-token"}}
+
+	// 默认不录制，通过管理接口开启路由后录制
+	serve(http.MethodPost, "/orders/1", `{}`, nil)
+	if entries := records(); len(entries) != 0 {
+		t.Fatalf("expected no records, got %d", len(entries))
+	}
+	if w := serve(http.MethodPut, "/admin/recorder/routes", `{"method":"post","route":"/orders/:id","sample_rate":1}`, admin); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"POST /orders/:id":1`) {
+		t.Fatalf("unexpected enable: %d %s", w.Code, w.Body.String())
+	}
+	serve(http.MethodPost, "/orders/2?phone=13812345678", `{"password":"secret"}`, http.Header{"Authorization": {"Bearer user"}})
+	entries := records()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(entries))
+	}
+	entry := entries[0]
+	data, _ := json.Marshal(entry)
+	if entry.Route != "/orders/:id" || entry.Response.Status != http.StatusOK || entry.RequestId == "" ||
+		strings.Contains(string(data), "13812345678") || strings.Contains(string(data), "secret") ||
+		strings.Contains(string(data), "123456") || strings.Contains(string(data), "Bearer user") {
+		t.Fatalf("unexpected record: %s", data)
+	}
+
+	// 恢复默认后不再录制
+	if w := serve(http.MethodPut, "/admin/recorder/routes", `{"method":"POST","route":"/orders/:id"}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("unexpected reset: %d %s", w.Code, w.Body.String())
+	}
+	serve(http.MethodPost, "/orders/3", `{}`, nil)
+	if entries = records(); len(entries) != 1 {
+		t.Fatalf("expected 1 record after reset, got %d", len(entries))
+	}
+
+	if err = recorder.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recorder.SetRouteSampleRate("*", "/orders/:id", 1)
+	serve(http.MethodPost, "/orders/4", `{}`, nil)
+	if entries = records(); len(entries) != 1 {
+		t.Fatalf("expected no records after close, got %d", len(entries))
+	}
+}
+
+func TestRequestFields(t *testing.T) {
+	// 通过 reflect 构造同一层有相同 json 名的匿名结构体，源码中的写法会被 go vet 拒绝
+	embedded := func(jsonName string) reflect.Type {
+		return reflect.StructOf([]reflect.StructField{
+			{Name: "Name", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`json:"name"`)},
+			{Name: "By", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`json:"` + jsonName + `"`)},
+		})
+	}
+	request := reflect.StructOf([]reflect.StructField{
+		{Name: "A", Type: embedded("a_by"), Anonymous: true},
+		{Name: "B", Type: embedded("b_by"), Anonymous: true},
+		{Name: "Age", Type: reflect.TypeOf(0), Tag: reflect.StructTag(`json:"age"`)},
+	})
+
+	fields := newRequestFields()
+	fields.collect(request, map[reflect.Type]bool{})
+	body := fields.bodyFields()
+	// 与 NewHandler 一样构造请求体模型，字段名重复时会 panic
+	_ = reflect.StructOf(body)
+	names := make([]string, 0)
+	for _, field := range body {
+		names = append(names, field.Name+":"+tagName(field.Tag.Get("json")))
+	}
+	if strings.Join(names, ",") != "By:a_by,By2:b_by,Age:age" {
+		t.Fatalf("unexpected body fields: %v", names)
+	}
+}
+
+func TestContainer(t *testing.T) {
+	server, err := NewServer(ctx, WithServiceName("test_server"), WithHiddenRoutesLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleaned := 0
+	ProvideValue(server.Container(), "olympus")
+	ProvideWithCleanup(server.Container(), LifetimeRequest, func(c *gin.Context) (*requestCounter, func(), error) {
+		return &requestCounter{}, func() { cleaned++ }, nil
+	})
+	// 接口类型的 provider 返回 nil
+	Provide(server.Container(), LifetimeRequest, func(c *gin.Context) (fmt.Stringer, error) {
+		return nil, nil
+	})
+
+	if err = server.RegisterRoutes(&depsRouter{t: t}); err != nil {
 		t.Fatal(err)
 	}
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/deps", nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "olympus") {
+			t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if cleaned != 2 {
+		t.Fatalf("expected 2 cleanups, got %d", cleaned)
+	}
+
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/deps/stringer", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":true`) {
+		t.Fatalf("nil interface dependency should resolve to nil: %d %s", w.Code, w.Body.String())
+	}
 }
 
 /*
-curl --location 'http://127.0.0.1:8000/hello/ping' \
+curl --location 'http://127.0.0.1:8080/hello/ping' \
 --header 'Traceparent: 00-5e64f77760384d153783c96049550881-b7ad6b7169203331-01'
 
 这个 Traceparent 的格式：
@@ -66,7 +2073,6 @@ flags: 01
 func TestServerWithOtel(t *testing.T) {
 	server, err := NewServer(
 		ctx,
-		WithPort(8000),
 		WithServiceName("test_server"),
 	)
 	if err != nil {
@@ -75,8 +2081,12 @@ func TestServerWithOtel(t *testing.T) {
 
 	server.RegisterRoutes(&HelloRouter{})
 
-	if err := server.RunWithNotifySignal(ctx); err != nil {
-		t.Fatal(err)
+	req := httptest.NewRequest(http.MethodGet, "/hello/ping", nil)
+	req.Header.Set("Traceparent", "00-5e64f77760384d153783c96049550881-b7ad6b7169203331-01")
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "pong!5e64f77760384d153783c96049550881") {
+		t.Fatalf("trace should be propagated: %d %s", w.Code, w.Body.String())
 	}
 }
 
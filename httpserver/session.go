@@ -0,0 +1,412 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+// maxCookieSize 浏览器对单个 cookie 的大小限制
+const maxCookieSize = 4096
+
+const sessionContextKey = "httpserver.session"
+
+type SessionOptions struct {
+	// Name cookie 名称，默认 session
+	Name string
+	// Keys cookie 加密的密钥，第一个用于加密，所有的都用于解密，轮换密钥时将新密钥放在第一个
+	Keys [][]byte
+	// Store 默认为 NewCookieSessionStore
+	Store SessionStore
+	// MaxAge 会话空闲多久后过期，默认 24 小时，剩余不足一半时自动续期
+	MaxAge   time.Duration
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+type SessionOption func(*SessionOptions)
+
+func mergeSessionOptions(opts ...SessionOption) *SessionOptions {
+	opt := &SessionOptions{
+		Name:     "session",
+		MaxAge:   24 * time.Hour,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.Store == nil {
+		opt.Store = NewCookieSessionStore()
+	}
+	return opt
+}
+
+func WithSessionName(name string) SessionOption {
+	return func(o *SessionOptions) {
+		o.Name = name
+	}
+}
+
+// WithSessionKeys cookie 加密的密钥，不设置时使用随机密钥，重启后会话失效
+func WithSessionKeys(keys ...[]byte) SessionOption {
+	return func(o *SessionOptions) {
+		o.Keys = keys
+	}
+}
+
+func WithSessionStore(store SessionStore) SessionOption {
+	return func(o *SessionOptions) {
+		o.Store = store
+	}
+}
+
+func WithSessionMaxAge(maxAge time.Duration) SessionOption {
+	return func(o *SessionOptions) {
+		o.MaxAge = maxAge
+	}
+}
+
+// WithSessionCookie 设置 cookie 的属性，secure 默认为 true，只通过 https 发送
+func WithSessionCookie(path, domain string, secure bool, sameSite http.SameSite) SessionOption {
+	return func(o *SessionOptions) {
+		o.Path = path
+		o.Domain = domain
+		o.Secure = secure
+		o.SameSite = sameSite
+	}
+}
+
+// Session 当前请求的会话，通过 SessionFromContext 获取，修改在响应写入前自动保存
+type Session struct {
+	id        string
+	values    SessionValues
+	expiresAt time.Time
+	isNew     bool
+	modified  bool
+	destroyed bool
+	// oldID Regenerate 前的会话 ID，保存时从 store 中删除
+	oldID string
+}
+
+// SessionFromContext 没有使用 Sessions 中间件时返回 nil
+func SessionFromContext(c *gin.Context) *Session {
+	value, _ := c.Get(sessionContextKey)
+	session, _ := value.(*Session)
+	return session
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew 请求没有携带有效的会话
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Get 将 key 的值解析到 v 中，key 不存在时返回 false
+func (s *Session) Get(key string, v any) (bool, error) {
+	value, ok := s.values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		return false, errors.Wrapf(err, "unmarshal session value %s err", key)
+	}
+	return true, nil
+}
+
+func (s *Session) Set(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "marshal session value %s err", key)
+	}
+	s.values[key] = value
+	s.modified = true
+	return nil
+}
+
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+func (s *Session) Clear() {
+	s.values = SessionValues{}
+	s.modified = true
+}
+
+// Regenerate 更换会话 ID 并保留数据，登录、提权等权限变化时调用，防止会话固定攻击
+func (s *Session) Regenerate() {
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = newSessionID()
+	s.modified = true
+}
+
+// Destroy 删除会话与 cookie，例如退出登录
+func (s *Session) Destroy() {
+	s.values = SessionValues{}
+	s.destroyed = true
+}
+
+// SessionKey 类型安全的会话数据 key
+//
+//	var sessionUserId = httpserver.SessionKey[int64]("user_id")
+//	err := sessionUserId.Set(c, user.Id)
+//	userId, ok := sessionUserId.Get(c)
+type SessionKey[T any] string
+
+// Get key 不存在、值的类型不匹配或没有使用 Sessions 中间件时返回 false
+func (k SessionKey[T]) Get(c *gin.Context) (T, bool) {
+	var value T
+	session := SessionFromContext(c)
+	if session == nil {
+		return value, false
+	}
+	ok, err := session.Get(string(k), &value)
+	if err != nil {
+		logger.WithError(err).Warnf(c.Request.Context(), "get session value %s failed", k)
+		return value, false
+	}
+	return value, ok
+}
+
+func (k SessionKey[T]) Set(c *gin.Context, value T) error {
+	session := SessionFromContext(c)
+	if session == nil {
+		return errors.New("session middleware is not used")
+	}
+	return session.Set(string(k), value)
+}
+
+func (k SessionKey[T]) Delete(c *gin.Context) {
+	if session := SessionFromContext(c); session != nil {
+		session.Delete(string(k))
+	}
+}
+
+// sessionCookie cookie 中加密保存的内容，cookie 存储时包含 Values
+type sessionCookie struct {
+	ID        string        `json:"id"`
+	ExpiresAt int64         `json:"exp"`
+	Values    SessionValues `json:"values,omitempty"`
+}
+
+// Sessions 会话中间件，cookie 使用 AES-GCM 加密与签名，通过 WithSessionStore 选择 cookie、内存或 redis 存储
+//
+//	admin := router.Group("/admin").Use(httpserver.Sessions(httpserver.WithSessionKeys(key), httpserver.WithSessionStore(store)))
+func Sessions(opts ...SessionOption) gin.HandlerFunc {
+	options := mergeSessionOptions(opts...)
+	if len(options.Keys) == 0 {
+		logger.Warn(context.Background(), "session keys are not set, use a random key, sessions will be lost after restart")
+		key := make([]byte, 32)
+		_, _ = rand.Read(key)
+		options.Keys = [][]byte{key}
+	}
+	codec := newSessionCodec(options.Keys)
+	_, cookieOnly := options.Store.(cookieSessionStore)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		session, err := loadSession(c, options, codec, cookieOnly)
+		if err != nil {
+			logger.WithError(err).Errorf(ctx, "failed to load session, uri: %s", c.Request.RequestURI)
+			body := &Body[EmptyType]{}
+			body.WithErr(ErrorWithInternalServer())
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+		c.Set(sessionContextKey, session)
+
+		writer := &sessionWriter{ResponseWriter: c.Writer}
+		writer.save = func() {
+			if err := saveSession(c, writer.ResponseWriter, options, codec, cookieOnly, session); err != nil {
+				logger.WithError(err).Errorf(ctx, "failed to save session, uri: %s", c.Request.RequestURI)
+			}
+		}
+		c.Writer = writer
+		c.Next()
+		writer.saveOnce()
+	}
+}
+
+// loadSession cookie 无效、过期或 store 中不存在时创建新的会话
+func loadSession(c *gin.Context, options *SessionOptions, codec *sessionCodec, cookieOnly bool) (*Session, error) {
+	session := &Session{id: newSessionID(), values: SessionValues{}, isNew: true}
+	value, err := c.Cookie(options.Name)
+	if err != nil || value == "" {
+		return session, nil
+	}
+	payload := &sessionCookie{}
+	data, err := codec.decode(options.Name, value)
+	if err != nil || json.Unmarshal(data, payload) != nil || payload.ID == "" || time.Now().Unix() > payload.ExpiresAt {
+		return session, nil
+	}
+
+	values := payload.Values
+	if !cookieOnly {
+		if values, err = options.Store.Load(c.Request.Context(), payload.ID); err != nil {
+			return nil, err
+		}
+		if values == nil {
+			return session, nil
+		}
+	}
+	if values == nil {
+		values = SessionValues{}
+	}
+	return &Session{id: payload.ID, values: values, expiresAt: time.Unix(payload.ExpiresAt, 0)}, nil
+}
+
+func saveSession(c *gin.Context, w http.ResponseWriter, options *SessionOptions, codec *sessionCodec, cookieOnly bool, session *Session) error {
+	ctx := c.Request.Context()
+	cookie := &http.Cookie{
+		Name:     options.Name,
+		Path:     options.Path,
+		Domain:   options.Domain,
+		Secure:   options.Secure,
+		HttpOnly: true,
+		SameSite: options.SameSite,
+	}
+	if session.destroyed {
+		if !session.isNew && !cookieOnly {
+			if err := options.Store.Delete(ctx, session.id); err != nil {
+				return err
+			}
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		return nil
+	}
+
+	if session.oldID != "" && !cookieOnly {
+		if err := options.Store.Delete(ctx, session.oldID); err != nil {
+			return err
+		}
+	}
+	renew := !session.isNew && time.Until(session.expiresAt) < options.MaxAge/2
+	if !session.modified && !renew {
+		return nil
+	}
+	if session.isNew && len(session.values) == 0 {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(options.MaxAge)
+	payload := sessionCookie{ID: session.id, ExpiresAt: expiresAt.Unix()}
+	if cookieOnly {
+		payload.Values = session.values
+	} else if err := options.Store.Save(ctx, session.id, session.values, options.MaxAge); err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal session cookie err")
+	}
+	cookie.Value = codec.encode(options.Name, data)
+	cookie.Expires = expiresAt
+	cookie.MaxAge = int(options.MaxAge.Seconds())
+	if len(cookie.String()) > maxCookieSize {
+		return errors.Errorf("session cookie exceeds %d bytes, use a server side store", maxCookieSize)
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// sessionWriter 第一次写入响应前保存会话，保证 Set-Cookie 在 header 中
+type sessionWriter struct {
+	gin.ResponseWriter
+	once sync.Once
+	save func()
+}
+
+func (w *sessionWriter) saveOnce() {
+	w.once.Do(w.save)
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.saveOnce()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.saveOnce()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.saveOnce()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *sessionWriter) Flush() {
+	w.saveOnce()
+	w.ResponseWriter.Flush()
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionCodec AES-256-GCM 加密，cookie 名称作为附加数据，防止不同 cookie 之间替换
+type sessionCodec struct {
+	aeads []cipher.AEAD
+}
+
+func newSessionCodec(keys [][]byte) *sessionCodec {
+	codec := &sessionCodec{}
+	for _, key := range keys {
+		// 任意长度的密钥派生为 32 字节
+		sum := sha256.Sum256(key)
+		block, _ := aes.NewCipher(sum[:])
+		aead, _ := cipher.NewGCM(block)
+		codec.aeads = append(codec.aeads, aead)
+	}
+	return codec
+}
+
+func (c *sessionCodec) encode(name string, data []byte) string {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, []byte(name)))
+}
+
+func (c *sessionCodec) decode(name string, value string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode session cookie err")
+	}
+	for _, aead := range c.aeads {
+		if len(data) < aead.NonceSize() {
+			continue
+		}
+		plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+		if err == nil {
+			return plain, nil
+		}
+	}
+	return nil, errors.New("invalid session cookie")
+}
@@ -0,0 +1,142 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionValues 会话数据，值为 json，通过 Session.Get 或 SessionKey 读取
+type SessionValues map[string]json.RawMessage
+
+// SessionStore 保存会话数据，Load 在会话不存在或过期时返回 nil
+type SessionStore interface {
+	Load(ctx context.Context, id string) (SessionValues, error)
+	Save(ctx context.Context, id string, values SessionValues, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// cookieSessionStore 会话数据加密后保存在 cookie 中，由 Sessions 中间件直接读写 cookie
+type cookieSessionStore struct{}
+
+// NewCookieSessionStore 会话数据保存在加密的 cookie 中，不需要服务端存储，cookie 不能超过 4KB，
+// 无法在服务端使会话失效，Regenerate 只更换会话 ID
+func NewCookieSessionStore() SessionStore {
+	return cookieSessionStore{}
+}
+
+func (cookieSessionStore) Load(ctx context.Context, id string) (SessionValues, error) {
+	return nil, nil
+}
+
+func (cookieSessionStore) Save(ctx context.Context, id string, values SessionValues, ttl time.Duration) error {
+	return nil
+}
+
+func (cookieSessionStore) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+type memorySession struct {
+	values    SessionValues
+	expiresAt time.Time
+}
+
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+// NewMemorySessionStore 保存在内存中，只适用于单实例，重启后会话失效
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: map[string]memorySession{}}
+}
+
+func (s *memorySessionStore) Load(ctx context.Context, id string) (SessionValues, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return copySessionValues(session.values), nil
+}
+
+func (s *memorySessionStore) Save(ctx context.Context, id string, values SessionValues, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	s.sessions[id] = memorySession{values: copySessionValues(values), expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *memorySessionStore) evict(now time.Time) {
+	for id, session := range s.sessions {
+		if now.After(session.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func copySessionValues(values SessionValues) SessionValues {
+	copied := make(SessionValues, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
+type redisSessionStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisSessionStore 保存在 redis 中，key 为 prefix+id，多实例共享会话
+func NewRedisSessionStore(client redis.UniversalClient, prefix string) SessionStore {
+	return &redisSessionStore{client: client, prefix: prefix}
+}
+
+func (s *redisSessionStore) Load(ctx context.Context, id string) (SessionValues, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "get session err")
+	}
+	values := SessionValues{}
+	if err = json.Unmarshal(data, &values); err != nil {
+		return nil, errors.Wrap(err, "unmarshal session err")
+	}
+	return values, nil
+}
+
+func (s *redisSessionStore) Save(ctx context.Context, id string, values SessionValues, ttl time.Duration) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return errors.Wrap(err, "marshal session err")
+	}
+	if err = s.client.Set(ctx, s.prefix+id, data, ttl).Err(); err != nil {
+		return errors.Wrap(err, "save session err")
+	}
+	return nil
+}
+
+func (s *redisSessionStore) Delete(ctx context.Context, id string) error {
+	if err := s.client.Del(ctx, s.prefix+id).Err(); err != nil {
+		return errors.Wrap(err, "delete session err")
+	}
+	return nil
+}
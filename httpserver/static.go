@@ -0,0 +1,277 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+type StaticOptions struct {
+	// Index 目录与 SPA 回退时返回的文件，默认 index.html
+	Index string
+	// SPA 不存在且没有扩展名的路径返回 Index，由前端路由处理
+	SPA bool
+	// Precompressed 客户端支持时返回同目录下预压缩的 .br、.gz 文件，默认开启
+	Precompressed bool
+	// Immutable 返回 true 的文件名包含内容 hash，缓存 MaxAge 且不再校验，默认匹配 app.3f9a1c2e.js、index-BkL3xQ2a.js
+	Immutable func(name string) bool
+	// MaxAge 包含 hash 的文件的缓存时间，默认一年，其他文件每次通过 ETag 校验
+	MaxAge time.Duration
+}
+
+type StaticOption func(*StaticOptions)
+
+func mergeStaticOptions(opts ...StaticOption) *StaticOptions {
+	opt := &StaticOptions{
+		Index:         "index.html",
+		Precompressed: true,
+		Immutable:     hashedFileName,
+		MaxAge:        365 * 24 * time.Hour,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithStaticIndex(index string) StaticOption {
+	return func(o *StaticOptions) {
+		o.Index = index
+	}
+}
+
+// WithStaticSPA 单页应用，前端路由的路径返回 Index
+func WithStaticSPA() StaticOption {
+	return func(o *StaticOptions) {
+		o.SPA = true
+	}
+}
+
+func WithStaticPrecompressed(enable bool) StaticOption {
+	return func(o *StaticOptions) {
+		o.Precompressed = enable
+	}
+}
+
+func WithStaticImmutable(immutable func(name string) bool) StaticOption {
+	return func(o *StaticOptions) {
+		o.Immutable = immutable
+	}
+}
+
+func WithStaticMaxAge(maxAge time.Duration) StaticOption {
+	return func(o *StaticOptions) {
+		o.MaxAge = maxAge
+	}
+}
+
+// hashedFileRegexp 文件名中 . 或 - 之后的 hash，webpack 为 8 位以上十六进制，vite 为 8 位 base64url
+var hashedFileRegexp = regexp.MustCompile(`[.-]([0-9a-fA-F]{8,}|[A-Za-z0-9_-]{8})\.[A-Za-z0-9]+(\.map)?$`)
+
+// hashedFileName hash 至少包含一个数字，避免将 index-settings.js 之类的文件名当作 hash
+func hashedFileName(name string) bool {
+	matches := hashedFileRegexp.FindStringSubmatch(path.Base(name))
+	return matches != nil && strings.ContainsAny(matches[1], "0123456789")
+}
+
+// Static 在 router 的 prefix 下提供 fsys 中的静态文件，只注册 GET 与 HEAD，不生成 openapi 文档；
+// prefix 为 / 时通过 NoRoute 提供，不与其他路由冲突，只能在服务的根路由上使用，在分组上使用时返回错误
+//
+//	//go:embed dist
+//	var dist embed.FS
+//	ui, _ := fs.Sub(dist, "dist")
+//	httpserver.Static(router, "/console", ui, httpserver.WithStaticSPA())
+func Static(router Router, prefix string, fsys fs.FS, opts ...StaticOption) error {
+	r, err := openapiRouterOf(router)
+	if err != nil {
+		return err
+	}
+	h := &staticHandler{fsys: fsys, options: mergeStaticOptions(opts...)}
+
+	parent, routePrefix := r, r.mergePath("/", prefix)
+	if r.version != nil {
+		parent = r.versionParent
+		routePrefix = r.mergePath("/", r.version.name, r.versionPath, prefix)
+	}
+	routePrefix = strings.TrimRight(routePrefix, "/")
+
+	handlers := make([]gin.HandlerFunc, 0, len(r.options.PreMiddlewares)+len(r.options.PostMiddlewares)+1)
+	handlers = append(handlers, r.options.PreMiddlewares...)
+	handlers = append(handlers, h.handle)
+	handlers = append(handlers, r.options.PostMiddlewares...)
+
+	if routePrefix == "" {
+		engine, ok := parent.ginRouter.(*gin.Engine)
+		if !ok {
+			return r.errs.add(errors.Errorf("static prefix %s can not be root of group %s", prefix, parent.prefix))
+		}
+		engine.NoRoute(handlers...)
+		return nil
+	}
+	parent.ginRouter.GET(routePrefix+"/*filepath", handlers...)
+	parent.ginRouter.HEAD(routePrefix+"/*filepath", handlers...)
+	return nil
+}
+
+type staticHandler struct {
+	fsys    fs.FS
+	options *StaticOptions
+	// etags 文件名到 ETag 的缓存，嵌入的文件没有修改时间，通过内容 hash 校验缓存
+	etags sync.Map
+}
+
+func (h *staticHandler) handle(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		h.notFound(c)
+		return
+	}
+	filepath, ok := c.Params.Get("filepath")
+	if !ok {
+		// 通过 NoRoute 提供时使用完整的路径
+		filepath = c.Request.URL.Path
+	}
+	name := strings.TrimPrefix(path.Clean("/"+filepath), "/")
+	if name == "" {
+		name = h.options.Index
+	}
+	if !fs.ValidPath(name) || hiddenFileName(name) {
+		h.notFound(c)
+		return
+	}
+
+	info, err := fs.Stat(h.fsys, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, h.options.Index)
+		info, err = fs.Stat(h.fsys, name)
+	}
+	fallback := false
+	if err != nil || info.IsDir() {
+		// 有扩展名的路径是缺失的资源文件，不回退，避免返回 html 作为 js
+		if !h.options.SPA || path.Ext(name) != "" {
+			h.notFound(c)
+			return
+		}
+		name, fallback = h.options.Index, true
+	}
+
+	cacheControl := "no-cache"
+	if !fallback && h.options.Immutable != nil && h.options.Immutable(name) {
+		cacheControl = fmt.Sprintf("public, max-age=%d, immutable", int(h.options.MaxAge.Seconds()))
+	}
+	if err = h.serve(c, name, cacheControl); err != nil {
+		logger.WithError(err).Errorf(c.Request.Context(), "failed to serve static file %s", name)
+		h.notFound(c)
+	}
+}
+
+func (h *staticHandler) serve(c *gin.Context, name string, cacheControl string) error {
+	served, encoding := name, ""
+	if h.options.Precompressed {
+		c.Header("Vary", "Accept-Encoding")
+		for _, candidate := range []struct{ ext, encoding string }{{".br", "br"}, {".gz", "gzip"}} {
+			if !acceptsEncoding(c.GetHeader("Accept-Encoding"), candidate.encoding) {
+				continue
+			}
+			if info, err := fs.Stat(h.fsys, name+candidate.ext); err == nil && !info.IsDir() {
+				served, encoding = name+candidate.ext, candidate.encoding
+				break
+			}
+		}
+	}
+
+	file, err := h.fsys.Open(served)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := h.etag(served, content)
+	if err != nil {
+		return err
+	}
+
+	// 预压缩的文件按原文件的扩展名设置类型，避免 ServeContent 根据压缩后的内容推断
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	if encoding != "" {
+		c.Header("Content-Encoding", encoding)
+	}
+	c.Header("Cache-Control", cacheControl)
+	c.Header("ETag", etag)
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), content)
+	return nil
+}
+
+func (h *staticHandler) etag(name string, content io.ReadSeeker) (string, error) {
+	if etag, ok := h.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.etags.Store(name, etag)
+	return etag, nil
+}
+
+func (h *staticHandler) notFound(c *gin.Context) {
+	body := &Body[EmptyType]{}
+	body.WithErr(ErrorWithCode(CodeNotFound).WithStatus(http.StatusNotFound))
+	c.AbortWithStatusJSON(body.status, body)
+}
+
+// hiddenFileName 不提供 .env、.git 等以 . 开头的文件
+func hiddenFileName(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding Accept-Encoding 中包含 encoding 且 q 不为 0
+func acceptsEncoding(header string, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(value), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package httpserver
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+
+	"github.com/ihezebin/olympus/logger"
+	"github.com/ihezebin/olympus/tenant"
+)
+
+// TenantResolver 从请求中获取租户 ID，无法获取时返回空字符串，由下一个 resolver 继续尝试
+type TenantResolver interface {
+	ResolveTenant(c *gin.Context) (string, error)
+}
+
+type TenantResolverFunc func(c *gin.Context) (string, error)
+
+func (f TenantResolverFunc) ResolveTenant(c *gin.Context) (string, error) {
+	return f(c)
+}
+
+// TenantFromHeader 从 header 获取租户 ID，例如 X-Tenant-Id
+func TenantFromHeader(header string) TenantResolver {
+	return TenantResolverFunc(func(c *gin.Context) (string, error) {
+		return strings.TrimSpace(c.GetHeader(header)), nil
+	})
+}
+
+// TenantFromSubdomain 从 baseDomain 的子域名获取租户 ID，例如 acme.example.com 的租户为 acme
+func TenantFromSubdomain(baseDomain string) TenantResolver {
+	suffix := "." + strings.Trim(strings.ToLower(baseDomain), ".")
+	return TenantResolverFunc(func(c *gin.Context) (string, error) {
+		host := strings.ToLower(c.Request.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		subdomain, ok := strings.CutSuffix(host, suffix)
+		if !ok || subdomain == "" || strings.Contains(subdomain, ".") {
+			return "", nil
+		}
+		return subdomain, nil
+	})
+}
+
+// TenantFromJWTClaim 从 Authorization: Bearer 的 JWT claim 获取租户 ID，
+// keyFunc 为 nil 时不校验签名，只能用于网关或前置中间件已经校验过 token 的场景
+func TenantFromJWTClaim(claim string, keyFunc jwt.Keyfunc) TenantResolver {
+	return TenantResolverFunc(func(c *gin.Context) (string, error) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return "", nil
+		}
+
+		claims := jwt.MapClaims{}
+		var err error
+		if keyFunc == nil {
+			_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+		} else {
+			_, err = jwt.ParseWithClaims(token, claims, keyFunc)
+		}
+		if err != nil {
+			return "", ErrorWithAuthorizationFailed(errors.Wrap(err, "parse jwt err").Error())
+		}
+
+		switch id := claims[claim].(type) {
+		case string:
+			return id, nil
+		case float64:
+			return strconv.FormatFloat(id, 'f', -1, 64), nil
+		}
+		return "", nil
+	})
+}
+
+// TenantLoader 根据租户 ID 获取租户的配置，租户不存在时返回 nil
+type TenantLoader func(ctx context.Context, id string) (*tenant.Tenant, error)
+
+type TenantOptions struct {
+	Resolvers []TenantResolver
+	// Loader 为空时租户只有 ID
+	Loader TenantLoader
+	// Optional 无法获取租户时继续处理请求
+	Optional bool
+	// RateLimit 每个租户默认的每秒请求数，租户的 RateLimit 可以覆盖，为 0 表示不限流
+	RateLimit float64
+	Burst     int
+	// MaxLimiters 最多保存的租户令牌桶数量，超出时淘汰最久未访问的租户，默认 10000
+	MaxLimiters int
+}
+
+type TenantOption func(*TenantOptions)
+
+func mergeTenantOptions(opts ...TenantOption) *TenantOptions {
+	opt := &TenantOptions{
+		MaxLimiters: 10000,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.MaxLimiters <= 0 {
+		opt.MaxLimiters = 10000
+	}
+	return opt
+}
+
+// WithTenantResolvers 按顺序尝试的 resolver
+func WithTenantResolvers(resolvers ...TenantResolver) TenantOption {
+	return func(o *TenantOptions) {
+		o.Resolvers = append(o.Resolvers, resolvers...)
+	}
+}
+
+func WithTenantLoader(loader TenantLoader) TenantOption {
+	return func(o *TenantOptions) {
+		o.Loader = loader
+	}
+}
+
+func WithTenantOptional() TenantOption {
+	return func(o *TenantOptions) {
+		o.Optional = true
+	}
+}
+
+// WithTenantRateLimit 每个租户默认的限流，burst 小于等于 0 时为 limit 向上取整
+func WithTenantRateLimit(limit float64, burst int) TenantOption {
+	return func(o *TenantOptions) {
+		o.RateLimit = limit
+		o.Burst = burst
+	}
+}
+
+// WithTenantMaxLimiters 最多保存 max 个租户的令牌桶，没有 Loader 时租户 ID 来自请求，需要限制数量
+func WithTenantMaxLimiters(max int) TenantOption {
+	return func(o *TenantOptions) {
+		o.MaxLimiters = max
+	}
+}
+
+// ResolveTenant 获取租户写入 context，通过 tenant.FromContext 读取；logger 记录 tenant_id，
+// httpclient 通过 baggage 将租户 ID 传递给下游服务；无法获取租户时返回 CodeTenantUnresolved
+//
+//	api := router.Group("/api").Use(ResolveTenant(WithTenantResolvers(TenantFromHeader("X-Tenant-Id"), TenantFromSubdomain("example.com"))))
+func ResolveTenant(opts ...TenantOption) gin.HandlerFunc {
+	options := mergeTenantOptions(opts...)
+	limiters := newTenantLimiters(options)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		t, err := resolveTenant(c, options)
+		if err != nil {
+			abortWithErr(c, err)
+			return
+		}
+		if t == nil {
+			if options.Optional {
+				c.Next()
+				return
+			}
+			abortWithErr(c, ErrorWithTenantUnresolved("tenant is required"))
+			return
+		}
+
+		if limiter := limiters.get(t); limiter != nil && !limiter.Allow() {
+			retryAfter := int(math.Ceil(1 / float64(limiter.Limit())))
+			c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			abortWithErr(c, ErrorWithTooManyRequests())
+			return
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(tenant.BaggageKey, t.ID))
+		c.Request = c.Request.WithContext(tenant.NewContext(ctx, t))
+		c.Next()
+	}
+}
+
+func resolveTenant(c *gin.Context, options *TenantOptions) (*tenant.Tenant, error) {
+	var id string
+	for _, resolver := range options.Resolvers {
+		var err error
+		id, err = resolver.ResolveTenant(c)
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			break
+		}
+	}
+	if id == "" {
+		return nil, nil
+	}
+
+	if options.Loader == nil {
+		return &tenant.Tenant{ID: id}, nil
+	}
+	t, err := options.Loader(c.Request.Context(), id)
+	if err != nil {
+		logger.WithError(err).Errorf(c.Request.Context(), "load tenant %s err", id)
+		return nil, ErrorWithInternalServer()
+	}
+	if t == nil {
+		return nil, ErrorWithTenantUnresolved(fmt.Sprintf("unknown tenant %s", id)).WithStatus(http.StatusForbidden)
+	}
+	return t, nil
+}
+
+func abortWithErr(c *gin.Context, err error) {
+	body := &Body[EmptyType]{}
+	var e *Err
+	if errors.As(err, &e) {
+		body.WithErr(e)
+	} else {
+		body.WithErr(ErrorWithTenantUnresolved(err.Error()))
+	}
+	c.AbortWithStatusJSON(body.status, body)
+}
+
+// tenantLimiters 每个租户一个令牌桶，租户的限流配置变化时更新，超过 MaxLimiters 时淘汰最久未访问的租户
+type tenantLimiters struct {
+	options *TenantOptions
+
+	mu       sync.Mutex
+	lru      *list.List
+	limiters map[string]*list.Element
+}
+
+type tenantLimiter struct {
+	id      string
+	limiter *rate.Limiter
+}
+
+func newTenantLimiters(options *TenantOptions) *tenantLimiters {
+	return &tenantLimiters{
+		options:  options,
+		lru:      list.New(),
+		limiters: make(map[string]*list.Element),
+	}
+}
+
+func (l *tenantLimiters) get(t *tenant.Tenant) *rate.Limiter {
+	limit, burst := l.options.RateLimit, l.options.Burst
+	if t.RateLimit != 0 {
+		limit, burst = t.RateLimit, t.Burst
+	}
+	if limit <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(limit))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var limiter *rate.Limiter
+	if element, ok := l.limiters[t.ID]; ok {
+		l.lru.MoveToFront(element)
+		limiter = element.Value.(*tenantLimiter).limiter
+	} else {
+		limiter = rate.NewLimiter(rate.Limit(limit), burst)
+		l.limiters[t.ID] = l.lru.PushFront(&tenantLimiter{id: t.ID, limiter: limiter})
+		if l.lru.Len() > l.options.MaxLimiters {
+			oldest := l.lru.Remove(l.lru.Back()).(*tenantLimiter)
+			delete(l.limiters, oldest.id)
+		}
+	}
+	if limiter.Limit() != rate.Limit(limit) {
+		limiter.SetLimit(rate.Limit(limit))
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+	return limiter
+}
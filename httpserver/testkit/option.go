@@ -0,0 +1,104 @@
+package testkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/ihezebin/olympus/httpserver"
+)
+
+type Options struct {
+	ServerOptions []httpserver.ServerOption
+	// ValidateResponse 使用生成的 openapi 文档校验每个响应
+	ValidateResponse bool
+	// IgnoredRoutes 覆盖率检查忽略的路由前缀，默认忽略框架内置的路由
+	IgnoredRoutes []string
+}
+
+type Option func(*Options)
+
+func mergeOptions(opts ...Option) *Options {
+	opt := &Options{
+		IgnoredRoutes: []string{"/health", "/metrics", "/debug/pprof", httpserver.OpenAPISpecPath},
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+// WithServerOptions 构建服务时的 ServerOption
+func WithServerOptions(opts ...httpserver.ServerOption) Option {
+	return func(o *Options) {
+		o.ServerOptions = append(o.ServerOptions, opts...)
+	}
+}
+
+// WithResponseValidation 使用生成的 openapi 文档校验响应，不符合时测试失败
+func WithResponseValidation() Option {
+	return func(o *Options) {
+		o.ValidateResponse = true
+	}
+}
+
+// WithIgnoredRoutes 追加覆盖率检查忽略的路由前缀，例如 openapi 文档页面
+func WithIgnoredRoutes(prefixes ...string) Option {
+	return func(o *Options) {
+		o.IgnoredRoutes = append(o.IgnoredRoutes, prefixes...)
+	}
+}
+
+type RequestOptions struct {
+	Header http.Header
+	Query  url.Values
+	Body   []byte
+
+	err error
+}
+
+type RequestOption func(*RequestOptions)
+
+func mergeRequestOptions(opts ...RequestOption) *RequestOptions {
+	opt := &RequestOptions{
+		Header: http.Header{},
+		Query:  url.Values{},
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithHeader(key, value string) RequestOption {
+	return func(o *RequestOptions) {
+		o.Header.Add(key, value)
+	}
+}
+
+func WithQuery(key string, values ...string) RequestOption {
+	return func(o *RequestOptions) {
+		o.Query[key] = append(o.Query[key], values...)
+	}
+}
+
+// WithBody 原始请求体
+func WithBody(contentType string, body []byte) RequestOption {
+	return func(o *RequestOptions) {
+		o.Header.Set("Content-Type", contentType)
+		o.Body = body
+	}
+}
+
+// WithJSON 将 v 序列化为 json 请求体
+func WithJSON(v any) RequestOption {
+	return func(o *RequestOptions) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			o.err = err
+			return
+		}
+		o.Header.Set("Content-Type", "application/json")
+		o.Body = data
+	}
+}
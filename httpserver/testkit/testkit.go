@@ -0,0 +1,320 @@
+// Package testkit 在进程内执行路由请求，不需要监听端口
+//
+//	kit := testkit.New(t, []httpserver.RegisterRoutes{&UserRouter{}}, testkit.WithResponseValidation())
+//	resp := kit.Do(http.MethodPost, "/users/create", testkit.WithJSON(req))
+//	name := testkit.AssertOK[string](t, resp)
+//	kit.AssertOpenAPICoverage()
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+
+	"github.com/ihezebin/olympus/httpserver"
+)
+
+// server httpserver.NewServer 的返回值
+type server interface {
+	Engine() *gin.Engine
+	OpenAPI() *openapi.API
+	OpenAPIVersions() map[string]*openapi.API
+	RegisterRoutes(routers ...httpserver.RegisterRoutes) error
+}
+
+type Kit struct {
+	tb      testing.TB
+	options *Options
+	server  server
+	spec    *openapi3.T
+	// versionSpecs 各版本的文档，key 为版本名
+	versionSpecs map[string]*openapi3.T
+}
+
+type routeCaptureKey struct{}
+
+// routeCapture 记录请求命中的路由模板、路径参数与版本，用于查找 openapi operation
+type routeCapture struct {
+	fullPath string
+	params   gin.Params
+	version  string
+}
+
+// New 使用 routers 构建服务，服务不会监听端口
+func New(tb testing.TB, routers []httpserver.RegisterRoutes, opts ...Option) *Kit {
+	tb.Helper()
+	options := mergeOptions(opts...)
+
+	serverOptions := append([]httpserver.ServerOption{
+		httpserver.WithServiceName("testkit"),
+		httpserver.WithHiddenRoutesLog(),
+	}, options.ServerOptions...)
+
+	s, err := httpserver.NewServer(context.Background(), serverOptions...)
+	if err != nil {
+		tb.Fatalf("new server err: %v", err)
+	}
+
+	// 必须在注册路由之前添加，否则不会作用到路由上
+	s.Engine().Use(func(c *gin.Context) {
+		if capture, ok := c.Request.Context().Value(routeCaptureKey{}).(*routeCapture); ok {
+			capture.fullPath = c.FullPath()
+			capture.params = c.Params
+			// 版本在路由的处理链中确定
+			defer func() {
+				capture.version = c.GetString(httpserver.VersionKey)
+			}()
+		}
+		c.Next()
+	})
+	if err = s.RegisterRoutes(routers...); err != nil {
+		tb.Fatalf("register routes err: %v", err)
+	}
+
+	return &Kit{
+		tb:           tb,
+		options:      options,
+		server:       s,
+		versionSpecs: make(map[string]*openapi3.T),
+	}
+}
+
+// Engine 用于注册额外的 gin 路由或中间件
+func (k *Kit) Engine() *gin.Engine {
+	return k.server.Engine()
+}
+
+// Spec 生成的 openapi 文档，$ref 已经解析
+func (k *Kit) Spec() *openapi3.T {
+	k.tb.Helper()
+	if k.spec == nil {
+		k.spec = k.load(k.server.OpenAPI())
+	}
+	return k.spec
+}
+
+// versionSpec 版本的 openapi 文档，$ref 已经解析，版本不存在时返回 nil
+func (k *Kit) versionSpec(version string) *openapi3.T {
+	k.tb.Helper()
+	if spec, ok := k.versionSpecs[version]; ok {
+		return spec
+	}
+	api, ok := k.server.OpenAPIVersions()[version]
+	if !ok {
+		return nil
+	}
+	k.versionSpecs[version] = k.load(api)
+	return k.versionSpecs[version]
+}
+
+func (k *Kit) load(api *openapi.API) *openapi3.T {
+	k.tb.Helper()
+	data, err := api.Json()
+	if err != nil {
+		k.tb.Fatalf("generate openapi spec err: %v", err)
+	}
+	spec, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		k.tb.Fatalf("load openapi spec err: %v", err)
+	}
+	return spec
+}
+
+// Response 请求的响应
+type Response struct {
+	*httptest.ResponseRecorder
+	Request *http.Request
+	// FullPath 命中的路由模板，例如 /users/:id，未命中时为空
+	FullPath string
+}
+
+// Do 在进程内执行请求
+func (k *Kit) Do(method, path string, opts ...RequestOption) *Response {
+	k.tb.Helper()
+	options := mergeRequestOptions(opts...)
+
+	if options.err != nil {
+		k.tb.Fatalf("build request err: %v", options.err)
+	}
+	bodyData := options.Body
+
+	capture := &routeCapture{}
+	req := httptest.NewRequest(method, path, bytes.NewReader(bodyData))
+	req = req.WithContext(context.WithValue(req.Context(), routeCaptureKey{}, capture))
+	if len(options.Query) > 0 {
+		query := req.URL.Query()
+		for key, values := range options.Query {
+			query[key] = append(query[key], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	for key, values := range options.Header {
+		req.Header[key] = values
+	}
+
+	recorder := httptest.NewRecorder()
+	k.server.Engine().ServeHTTP(recorder, req)
+
+	resp := &Response{
+		ResponseRecorder: recorder,
+		Request:          req,
+		FullPath:         capture.fullPath,
+	}
+
+	if k.options.ValidateResponse && capture.fullPath != "" {
+		// 校验时重新读取请求体
+		req.Body = io.NopCloser(bytes.NewReader(bodyData))
+		if err := k.validateResponse(req, capture, recorder); err != nil {
+			k.tb.Errorf("response of %s %s does not match openapi spec: %v", method, capture.fullPath, err)
+		}
+	}
+
+	return resp
+}
+
+func (k *Kit) validateResponse(req *http.Request, capture *routeCapture, recorder *httptest.ResponseRecorder) error {
+	spec, path := k.Spec(), capture.fullPath
+	if capture.version != "" {
+		if spec = k.versionSpec(capture.version); spec == nil {
+			return nil
+		}
+		path = versionPath(spec, capture.fullPath, capture.version)
+	}
+	pathItem := spec.Paths.Value(path)
+	if pathItem == nil {
+		return nil
+	}
+	operation := pathItem.GetOperation(req.Method)
+	if operation == nil {
+		return nil
+	}
+
+	pathParams := make(map[string]string, len(capture.params))
+	for _, param := range capture.params {
+		pathParams[param.Key] = param.Value
+	}
+
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route: &routers.Route{
+				Spec:      spec,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    req.Method,
+				Operation: operation,
+			},
+		},
+		Status: recorder.Code,
+		Header: recorder.Header(),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	}
+	input.SetBodyBytes(recorder.Body.Bytes())
+
+	return openapi3filter.ValidateResponse(context.Background(), input)
+}
+
+// versionPath 同时通过路径与 Header 区分版本时，Header 命中的 gin 路由中没有版本，文档中的路径包含版本
+func versionPath(spec *openapi3.T, fullPath string, version string) string {
+	if spec.Paths.Value(fullPath) != nil {
+		return fullPath
+	}
+	for path := range spec.Paths.Map() {
+		if strings.Replace(path, "/"+version+"/", "/", 1) == fullPath {
+			return path
+		}
+	}
+	return fullPath
+}
+
+// UndocumentedRoutes 返回没有 openapi operation 的路由，格式为 "GET /path"，版本路由在对应版本的文档中查找
+func (k *Kit) UndocumentedRoutes() []string {
+	k.tb.Helper()
+	specs := []*openapi3.T{k.Spec()}
+	for version, api := range k.server.OpenAPIVersions() {
+		spec, err := api.Spec()
+		if err != nil {
+			k.tb.Fatalf("generate openapi spec of version %s err: %v", version, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	undocumented := make([]string, 0)
+	for _, route := range k.server.Engine().Routes() {
+		if k.ignored(route.Path) {
+			continue
+		}
+		documented := false
+		for _, spec := range specs {
+			if pathItem := spec.Paths.Value(route.Path); pathItem != nil && pathItem.GetOperation(route.Method) != nil {
+				documented = true
+				break
+			}
+		}
+		if !documented {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+		}
+	}
+	return undocumented
+}
+
+// AssertOpenAPICoverage 断言所有注册的路由都在 openapi 文档中
+func (k *Kit) AssertOpenAPICoverage() {
+	k.tb.Helper()
+	if undocumented := k.UndocumentedRoutes(); len(undocumented) > 0 {
+		k.tb.Errorf("routes without openapi operation:\n%s", strings.Join(undocumented, "\n"))
+	}
+}
+
+func (k *Kit) ignored(path string) bool {
+	for _, prefix := range k.options.IgnoredRoutes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode 将响应解析为 Body[T]
+func Decode[T any](tb testing.TB, resp *Response) *httpserver.Body[T] {
+	tb.Helper()
+	body := &httpserver.Body[T]{}
+	if err := json.Unmarshal(resp.Body.Bytes(), body); err != nil {
+		tb.Fatalf("decode response body err: %v, status: %d, body: %s", err, resp.Code, resp.Body.String())
+	}
+	return body
+}
+
+// AssertCode 断言响应的业务码
+func AssertCode(tb testing.TB, resp *Response, code httpserver.Code) {
+	tb.Helper()
+	body := Decode[json.RawMessage](tb, resp)
+	if body.Code != code {
+		tb.Fatalf("expected code %d, got %d, status: %d, message: %s", code, body.Code, resp.Code, body.Message)
+	}
+}
+
+// AssertOK 断言请求成功并返回 data
+func AssertOK[T any](tb testing.TB, resp *Response) T {
+	tb.Helper()
+	body := Decode[T](tb, resp)
+	if body.Code != httpserver.CodeOK {
+		tb.Fatalf("expected code %d, got %d, status: %d, message: %s", httpserver.CodeOK, body.Code, resp.Code, body.Message)
+	}
+	return body.Data
+}
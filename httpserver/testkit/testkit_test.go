@@ -0,0 +1,103 @@
+package testkit
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ihezebin/olympus/httpserver"
+)
+
+type GetUserReq struct {
+	Id string `uri:"id"`
+}
+
+type CreateUserReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type User struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userRouter struct{}
+
+func (u *userRouter) RegisterRoutes(router httpserver.Router) {
+	group := router.Group("/users")
+	group.GET("/:id", httpserver.NewHandler(func(c *gin.Context, req GetUserReq) (*User, error) {
+		if req.Id != "1" {
+			return nil, httpserver.ErrorWithCode(httpserver.CodeNotFound)
+		}
+		return &User{Id: req.Id, Name: "olympus"}, nil
+	}))
+	group.POST("/create", httpserver.NewHandler(func(c *gin.Context, req CreateUserReq) (*User, error) {
+		return &User{Id: "2", Name: req.Name}, nil
+	}))
+}
+
+func TestKit(t *testing.T) {
+	kit := New(t, []httpserver.RegisterRoutes{&userRouter{}}, WithResponseValidation())
+
+	resp := kit.Do(http.MethodGet, "/users/1")
+	if resp.FullPath != "/users/:id" {
+		t.Fatalf("unexpected full path: %s", resp.FullPath)
+	}
+	user := AssertOK[User](t, resp)
+	if user.Name != "olympus" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	AssertCode(t, kit.Do(http.MethodGet, "/users/2"), httpserver.CodeNotFound)
+
+	user = AssertOK[User](t, kit.Do(http.MethodPost, "/users/create", WithJSON(CreateUserReq{Name: "hezebin"})))
+	if user.Name != "hezebin" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	kit.AssertOpenAPICoverage()
+
+	kit.Engine().GET("/raw", func(c *gin.Context) {
+		c.String(http.StatusOK, "raw")
+	})
+	undocumented := kit.UndocumentedRoutes()
+	if len(undocumented) != 1 || undocumented[0] != "GET /raw" {
+		t.Fatalf("unexpected undocumented routes: %v", undocumented)
+	}
+}
+
+type versionRouter struct{}
+
+func (v *versionRouter) RegisterRoutes(router httpserver.Router) {
+	strategy := httpserver.WithVersionStrategy(httpserver.VersionStrategyPath | httpserver.VersionStrategyHeader)
+	v1, _ := httpserver.Version(router, "v1", strategy, httpserver.WithDefaultVersion())
+	v1.GET("/users/:id", httpserver.NewHandler(func(c *gin.Context, req GetUserReq) (*User, error) {
+		// 响应与文档不一致
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"id": 1}})
+		return nil, nil
+	}))
+}
+
+// errorRecorder 记录 Errorf，用于断言响应校验失败
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestKitVersion(t *testing.T) {
+	recorder := &errorRecorder{TB: t}
+	kit := New(recorder, []httpserver.RegisterRoutes{&versionRouter{}}, WithResponseValidation())
+
+	// 通过路径与 Header 命中的版本路由都使用版本的文档校验
+	kit.Do(http.MethodGet, "/v1/users/1")
+	kit.Do(http.MethodGet, "/users/1", WithHeader(httpserver.HeaderAcceptVersion, "v1"))
+	if len(recorder.errors) != 2 {
+		t.Fatalf("versioned responses should be validated: %v", recorder.errors)
+	}
+}
@@ -0,0 +1,452 @@
+package httpserver
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+)
+
+// VersionStrategy 客户端指定版本的方式，可以组合使用
+type VersionStrategy int
+
+const (
+	// VersionStrategyPath 版本作为路径前缀，例如 /v2/users
+	VersionStrategyPath VersionStrategy = 1 << iota
+	// VersionStrategyHeader 通过 Accept-Version: v2 指定
+	VersionStrategyHeader
+	// VersionStrategyMediaType 通过 Accept: application/vnd.olympus.v2+json 或 application/json; version=v2 指定
+	VersionStrategyMediaType
+)
+
+const (
+	// VersionKey 请求命中的版本，通过 c.GetString(VersionKey) 获取
+	VersionKey = "olympus_api_version"
+
+	HeaderAcceptVersion = "Accept-Version"
+	HeaderDeprecation   = "Deprecation"
+	HeaderSunset        = "Sunset"
+)
+
+var mediaTypeVersionRegexp = regexp.MustCompile(`^application/vnd\.[^+;]*\.(v[^.+;]+)(\+|$)`)
+
+type VersionOptions struct {
+	Strategy VersionStrategy
+	// Default 请求没有指定版本时使用，只对 Header 与 MediaType 方式有效，没有默认版本时使用最早注册的版本
+	Default bool
+	// Inherit 继承的版本，该版本中没有重新定义的路由沿用继承版本的处理函数
+	Inherit string
+	// Deprecation 弃用时间，不为零时响应 Deprecation 头，并在文档中标记为 deprecated
+	Deprecation time.Time
+	// Sunset 下线时间，不为零时响应 Sunset 头
+	Sunset time.Time
+	// Link 迁移说明的链接，随 Deprecation 一起响应
+	Link string
+}
+
+type VersionOption func(*VersionOptions)
+
+func mergeVersionOptions(opts ...VersionOption) *VersionOptions {
+	opt := &VersionOptions{}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.Strategy == 0 {
+		opt.Strategy = VersionStrategyPath
+	}
+	return opt
+}
+
+func WithVersionStrategy(strategy VersionStrategy) VersionOption {
+	return func(o *VersionOptions) {
+		o.Strategy = strategy
+	}
+}
+
+func WithDefaultVersion() VersionOption {
+	return func(o *VersionOptions) {
+		o.Default = true
+	}
+}
+
+// WithVersionInherit 继承 version 中本版本没有重新定义的路由
+func WithVersionInherit(version string) VersionOption {
+	return func(o *VersionOptions) {
+		o.Inherit = version
+	}
+}
+
+func WithVersionDeprecation(deprecation time.Time, link string) VersionOption {
+	return func(o *VersionOptions) {
+		o.Deprecation = deprecation
+		o.Link = link
+	}
+}
+
+func WithVersionSunset(sunset time.Time) VersionOption {
+	return func(o *VersionOptions) {
+		o.Sunset = sunset
+	}
+}
+
+// apiVersion 一个接口版本，拥有独立的 openapi 文档
+type apiVersion struct {
+	name     string
+	options  *VersionOptions
+	openapi  *openapi.API
+	registry *versionRegistry
+	routes   []*versionRoute
+}
+
+// versionRoute 版本中注册的路由，用于继承
+type versionRoute struct {
+	// parent 调用 Version 的路由，path 为相对版本根路由的路径
+	parent    *openapiRouter
+	method    string
+	path      string
+	handler   handlerGenerator
+	options   *RouterOptions
+	inherited bool
+}
+
+// versionRegistry 服务内所有的版本
+type versionRegistry struct {
+	mu         sync.Mutex
+	newAPI     func(version string) *openapi.API
+	versions   []*apiVersion
+	dispatches []*versionDispatch
+}
+
+func newVersionRegistry(newAPI func(version string) *openapi.API) *versionRegistry {
+	return &versionRegistry{newAPI: newAPI}
+}
+
+func (registry *versionRegistry) version(name string, opts ...VersionOption) *apiVersion {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, v := range registry.versions {
+		if v.name == name {
+			return v
+		}
+	}
+
+	v := &apiVersion{
+		name:     name,
+		options:  mergeVersionOptions(opts...),
+		openapi:  registry.newAPI(name),
+		registry: registry,
+	}
+	registry.versions = append(registry.versions, v)
+	return v
+}
+
+// list 按注册顺序返回所有版本
+func (registry *versionRegistry) list() []*apiVersion {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]*apiVersion{}, registry.versions...)
+}
+
+func (registry *versionRegistry) lookup(name string) *apiVersion {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, v := range registry.versions {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// finalize 处理版本继承，并注册通过 Header 或 MediaType 区分版本的路由，在 RegisterRoutes 结束时调用
+func (registry *versionRegistry) finalize(errs *routeErrors) {
+	for _, v := range registry.list() {
+		if v.options.Inherit == "" {
+			continue
+		}
+		base := registry.lookup(v.options.Inherit)
+		if base == nil {
+			errs.add(errors.Errorf("api version %s inherits unknown version %s", v.name, v.options.Inherit))
+			continue
+		}
+		for _, route := range base.routes {
+			if v.has(route.method, route.path) {
+				continue
+			}
+			inherited := *route
+			inherited.inherited = true
+			v.routes = append(v.routes, &inherited)
+			errs.add(v.register(&inherited))
+		}
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, dispatch := range registry.dispatches {
+		if !dispatch.registered {
+			dispatch.registered = true
+			dispatch.ginRouter.Handle(dispatch.method, dispatch.path, dispatch.chain()...)
+		}
+	}
+}
+
+// dispatch 同一路径的多个版本共用一个 gin 路由，按请求中的版本分发
+func (registry *versionRegistry) dispatch(ginRouter gin.IRouter, method, path string, v *apiVersion, handlers []gin.HandlerFunc) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	var dispatch *versionDispatch
+	for _, d := range registry.dispatches {
+		if d.ginRouter == ginRouter && d.method == method && d.path == path {
+			dispatch = d
+			break
+		}
+	}
+	if dispatch == nil {
+		dispatch = &versionDispatch{
+			registry:  registry,
+			ginRouter: ginRouter,
+			method:    method,
+			path:      path,
+			handlers:  make(map[*apiVersion][]gin.HandlerFunc),
+		}
+		registry.dispatches = append(registry.dispatches, dispatch)
+	}
+	if dispatch.registered {
+		return errors.Errorf("api version %s of %s %s must be registered in the same RegisterRoutes call as other versions", v.name, method, path)
+	}
+	if _, ok := dispatch.handlers[v]; !ok {
+		dispatch.versions = append(dispatch.versions, v)
+	}
+	dispatch.handlers[v] = handlers
+	return nil
+}
+
+// match 找到 gin 路由对应的版本与该路由在版本文档中的路径；通过 Header 或 MediaType 区分版本的路由共用一个 gin 路由，
+// 与 selectVersion 一样按请求中的版本选择，没有指定时使用默认版本
+func (registry *versionRegistry) match(req *http.Request, fullPath string) (*apiVersion, string) {
+	var (
+		candidates []*apiVersion
+		paths      []string
+	)
+	for _, v := range registry.list() {
+		for _, route := range v.routes {
+			if route.method != req.Method {
+				continue
+			}
+			parent := route.parent
+			versionPath := parent.mergePath(parent.prefix, "/"+v.name, route.path)
+			if v.options.Strategy&VersionStrategyPath != 0 && versionPath == fullPath {
+				return v, versionPath
+			}
+			if v.options.Strategy&(VersionStrategyHeader|VersionStrategyMediaType) == 0 || parent.mergePath(parent.prefix, route.path) != fullPath {
+				continue
+			}
+			candidates = append(candidates, v)
+			if v.options.Strategy&VersionStrategyPath != 0 {
+				paths = append(paths, versionPath)
+			} else {
+				paths = append(paths, fullPath)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ""
+	}
+
+	requested := requestedVersion(req)
+	for i, v := range candidates {
+		if (requested != "" && v.name == requested) || (requested == "" && v.options.Default) {
+			return v, paths[i]
+		}
+	}
+	if requested == "" {
+		return candidates[0], paths[0]
+	}
+	return nil, ""
+}
+
+func (v *apiVersion) has(method, path string) bool {
+	for _, route := range v.routes {
+		if route.method == method && route.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *apiVersion) handle(r *openapiRouter, method string, path string, h handlerGenerator, routerOptions *RouterOptions) {
+	route := &versionRoute{
+		parent:  r.versionParent,
+		method:  method,
+		path:    r.mergePath("/", r.versionPath, path),
+		handler: h,
+		options: routerOptions,
+	}
+	// 重新定义继承的路由
+	for i, existed := range v.routes {
+		if existed.method == route.method && existed.path == route.path {
+			if !existed.inherited {
+				r.errs.add(errors.Errorf("route %s %s is already registered in api version %s", method, route.path, v.name))
+				return
+			}
+			v.routes = append(v.routes[:i], v.routes[i+1:]...)
+			break
+		}
+	}
+	v.routes = append(v.routes, route)
+	r.errs.add(v.register(route))
+}
+
+// register 注册版本路由，同一路径的其他版本已经生效时返回错误
+func (v *apiVersion) register(route *versionRoute) error {
+	handler := newHandlerRoute(route.handler)
+	handlers := append([]gin.HandlerFunc{v.middleware()}, handler.chain(route.options)...)
+
+	parent := route.parent
+	path := parent.mergePath(parent.prefix, "/"+v.name, route.path)
+	negotiated := v.options.Strategy&(VersionStrategyHeader|VersionStrategyMediaType) != 0
+
+	if v.options.Strategy&VersionStrategyPath != 0 {
+		parent.ginRouter.Handle(route.method, parent.mergePath("/"+v.name, route.path), handlers...)
+	}
+	if negotiated {
+		if err := v.registry.dispatch(parent.ginRouter, route.method, route.path, v, handlers); err != nil {
+			return err
+		}
+		if v.options.Strategy&VersionStrategyPath == 0 {
+			path = parent.mergePath(parent.prefix, route.path)
+		}
+	}
+
+	if route.options.PathRegister != nil {
+		route.options.PathRegister(route.method, path)
+	}
+	parent.limits.set(route.method, path, route.options.MaxBodyBytes)
+	parent.admission.set(route.method, path, route.options.Priority)
+
+	openapiRoute := v.openapi.Route(route.method, path)
+	if negotiated && v.options.Strategy&VersionStrategyPath == 0 {
+		openapiRoute.HasHeaderParameter(HeaderAcceptVersion, openapi.HeaderParam{
+			Description: fmt.Sprintf("接口版本，也可以通过 Accept 的 media type 指定，例如 application/vnd.api.%s+json", v.name),
+			Type:        openapi.PrimitiveTypeString,
+		})
+	}
+	if !v.options.Deprecation.IsZero() {
+		openapiRoute.HasDeprecated(true)
+	}
+	handler.document(openapiRoute, route.options, parent.limits.effective(route.options.MaxBodyBytes))
+	return nil
+}
+
+// middleware 标记请求的版本，并响应弃用与下线时间
+func (v *apiVersion) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(VersionKey, v.name)
+		if !v.options.Deprecation.IsZero() {
+			// RFC 9745
+			c.Header(HeaderDeprecation, fmt.Sprintf("@%d", v.options.Deprecation.Unix()))
+			if v.options.Link != "" {
+				c.Header("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, v.options.Link))
+			}
+		}
+		if !v.options.Sunset.IsZero() {
+			// RFC 8594
+			c.Header(HeaderSunset, v.options.Sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Next()
+	}
+}
+
+// versionDispatch 通过 Header 或 MediaType 区分版本的同一个路由
+// gin 的处理链为 [选择版本, v1 的处理链, v2 的处理链...]，未命中的版本直接跳过，保证中间件中 c.Next 的语义不变
+type versionDispatch struct {
+	registry   *versionRegistry
+	ginRouter  gin.IRouter
+	method     string
+	path       string
+	versions   []*apiVersion
+	handlers   map[*apiVersion][]gin.HandlerFunc
+	registered bool
+}
+
+func (d *versionDispatch) chain() []gin.HandlerFunc {
+	chain := []gin.HandlerFunc{d.selectVersion}
+	for _, v := range d.versions {
+		for _, handler := range d.handlers[v] {
+			chain = append(chain, skipOtherVersion(v.name, handler))
+		}
+	}
+	return chain
+}
+
+func (d *versionDispatch) selectVersion(c *gin.Context) {
+	requested := requestedVersion(c.Request)
+	if requested == "" {
+		selected := d.versions[0]
+		for _, v := range d.versions {
+			if v.options.Default {
+				selected = v
+				break
+			}
+		}
+		c.Set(VersionKey, selected.name)
+		c.Next()
+		return
+	}
+
+	for _, v := range d.versions {
+		if v.name == requested {
+			c.Set(VersionKey, v.name)
+			c.Next()
+			return
+		}
+	}
+
+	body := &Body[EmptyType]{}
+	if d.registry.lookup(requested) != nil {
+		body.WithErr(NewError(CodeNotFound, fmt.Sprintf("api version %s does not support %s %s", requested, d.method, d.path)).WithStatus(http.StatusNotFound))
+	} else {
+		body.WithErr(NewError(CodeBadRequest, fmt.Sprintf("unsupported api version: %s", requested)).WithStatus(http.StatusBadRequest))
+	}
+	c.AbortWithStatusJSON(body.status, body)
+}
+
+func skipOtherVersion(version string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(VersionKey) != version {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
+
+// requestedVersion 优先读取 Accept-Version，其次是 Accept 中的 media type
+func requestedVersion(req *http.Request) string {
+	if version := strings.TrimSpace(req.Header.Get(HeaderAcceptVersion)); version != "" {
+		return version
+	}
+
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if version := params["version"]; version != "" {
+			return version
+		}
+		if matches := mediaTypeVersionRegexp.FindStringSubmatch(mediaType); len(matches) == 3 {
+			return matches[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ihezebin/openapi"
+	"github.com/pkg/errors"
+
+	"github.com/ihezebin/olympus/logger"
+)
+
+// WebhookFormat 签名 header 的格式，签名算法均为 HMAC-SHA256
+type WebhookFormat int
+
+const (
+	// WebhookFormatGitHub X-Hub-Signature-256: sha256=<hex>，签名内容为 body
+	WebhookFormatGitHub WebhookFormat = iota
+	// WebhookFormatStripe Stripe-Signature: t=<unix>,v1=<hex>，签名内容为 t.body，可以有多个 v1
+	WebhookFormatStripe
+	// WebhookFormatSlack X-Slack-Signature: v0=<hex> 与 X-Slack-Request-Timestamp: <unix>，签名内容为 v0:t:body
+	WebhookFormatSlack
+)
+
+type WebhookOptions struct {
+	// Secrets 同时生效的多个密钥，轮换密钥时新旧密钥都可以通过校验
+	Secrets []string
+	// Tolerance 签名时间与当前时间允许的误差，防止重放，只对带时间戳的格式生效，小于等于 0 表示不校验
+	Tolerance time.Duration
+	// SignatureHeader、TimestampHeader 覆盖格式默认的 header
+	SignatureHeader string
+	TimestampHeader string
+	now             func() time.Time
+}
+
+type WebhookOption func(*WebhookOptions)
+
+func mergeWebhookOptions(format WebhookFormat, opts ...WebhookOption) *WebhookOptions {
+	opt := &WebhookOptions{
+		Tolerance: 5 * time.Minute,
+		now:       time.Now,
+	}
+	switch format {
+	case WebhookFormatStripe:
+		opt.SignatureHeader = "Stripe-Signature"
+	case WebhookFormatSlack:
+		opt.SignatureHeader = "X-Slack-Signature"
+		opt.TimestampHeader = "X-Slack-Request-Timestamp"
+	default:
+		opt.SignatureHeader = "X-Hub-Signature-256"
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return opt
+}
+
+func WithWebhookSecrets(secrets ...string) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Secrets = append(o.Secrets, secrets...)
+	}
+}
+
+func WithWebhookTolerance(tolerance time.Duration) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Tolerance = tolerance
+	}
+}
+
+// WithWebhookHeaders 自定义签名与时间戳的 header，为空时使用格式默认的 header
+func WithWebhookHeaders(signature, timestamp string) WebhookOption {
+	return func(o *WebhookOptions) {
+		if signature != "" {
+			o.SignatureHeader = signature
+		}
+		if timestamp != "" {
+			o.TimestampHeader = timestamp
+		}
+	}
+}
+
+// WithWebhookSignature 路由在处理请求前校验 webhook 签名，失败时返回 ErrorWithAuthorizationFailed，
+// 校验后请求体会被放回，可以继续使用 ShouldBind 或 ReuseBody，签名 header 会写入文档
+//
+//	router.PostWithOptions("/stripe", handler, WithWebhookSignature(WebhookFormatStripe, WithWebhookSecrets(current, previous)))
+func WithWebhookSignature(format WebhookFormat, opts ...WebhookOption) RouterOption {
+	options := mergeWebhookOptions(format, opts...)
+	return func(o *RouterOptions) {
+		o.PreMiddlewares = append(o.PreMiddlewares, VerifyWebhook(format, opts...))
+		o.OpenAPIOptions = append(o.OpenAPIOptions, func(route *openapi.Route) {
+			route.HasHeaderParameter(options.SignatureHeader, openapi.HeaderParam{
+				Description: "webhook 签名",
+				Required:    true,
+				Type:        openapi.PrimitiveTypeString,
+			})
+			if options.TimestampHeader != "" {
+				route.HasHeaderParameter(options.TimestampHeader, openapi.HeaderParam{
+					Description: "webhook 签名时间戳",
+					Required:    true,
+					Type:        openapi.PrimitiveTypeString,
+				})
+			}
+			route.HasResponseModel(http.StatusUnauthorized, openapi.ModelOf[Body[EmptyType]]())
+		})
+	}
+}
+
+// VerifyWebhook 校验 webhook 签名的中间件
+func VerifyWebhook(format WebhookFormat, opts ...WebhookOption) gin.HandlerFunc {
+	options := mergeWebhookOptions(format, opts...)
+	return func(c *gin.Context) {
+		var payload []byte
+		if c.Request.Body != nil {
+			var err error
+			payload, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				body := &Body[EmptyType]{}
+				body.WithErr(bindError(err, ErrorWithBadRequest()))
+				c.AbortWithStatusJSON(body.status, body)
+				return
+			}
+			_ = c.Request.Body.Close()
+		}
+		// 放回请求体，ShouldBindBodyWith 也可以直接使用
+		c.Request.Body = io.NopCloser(bytes.NewReader(payload))
+		c.Set(gin.BodyBytesKey, payload)
+
+		if err := verifyWebhook(format, options, c.Request.Header, payload); err != nil {
+			logger.WithError(err).Warnf(c.Request.Context(), "verify webhook signature failed: %s", c.Request.URL.Path)
+			body := &Body[EmptyType]{}
+			body.WithErr(ErrorWithAuthorizationFailed(err.Error()))
+			c.AbortWithStatusJSON(body.status, body)
+			return
+		}
+		c.Next()
+	}
+}
+
+func verifyWebhook(format WebhookFormat, options *WebhookOptions, header http.Header, payload []byte) error {
+	value := header.Get(options.SignatureHeader)
+	if value == "" {
+		return errors.Errorf("missing webhook signature header %s", options.SignatureHeader)
+	}
+
+	var timestamp string
+	var signatures []string
+	var signed []byte
+	switch format {
+	case WebhookFormatStripe:
+		for _, part := range strings.Split(value, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = val
+			case "v1":
+				signatures = append(signatures, val)
+			}
+		}
+		if options.TimestampHeader != "" {
+			timestamp = header.Get(options.TimestampHeader)
+		}
+		signed = append([]byte(timestamp+"."), payload...)
+	case WebhookFormatSlack:
+		timestamp = header.Get(options.TimestampHeader)
+		signatures = append(signatures, strings.TrimPrefix(value, "v0="))
+		signed = append([]byte("v0:"+timestamp+":"), payload...)
+	default:
+		signatures = append(signatures, strings.TrimPrefix(value, "sha256="))
+		signed = payload
+	}
+
+	if format != WebhookFormatGitHub {
+		if err := checkWebhookTimestamp(timestamp, options); err != nil {
+			return err
+		}
+	}
+
+	for _, secret := range options.Secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		expected := mac.Sum(nil)
+		for _, signature := range signatures {
+			actual, err := hex.DecodeString(signature)
+			if err == nil && hmac.Equal(actual, expected) {
+				return nil
+			}
+		}
+	}
+	return errors.New("invalid webhook signature")
+}
+
+func checkWebhookTimestamp(timestamp string, options *WebhookOptions) error {
+	if timestamp == "" {
+		return errors.New("missing webhook timestamp")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "invalid webhook timestamp %s", timestamp)
+	}
+	if options.Tolerance > 0 {
+		diff := math.Abs(float64(options.now().Unix() - unix))
+		if diff > options.Tolerance.Seconds() {
+			return errors.Errorf("webhook timestamp %s is outside the tolerance %s", timestamp, options.Tolerance)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LevelController 运行时修改日志级别，New 创建的 Logger 都实现了该接口
+type LevelController interface {
+	GetLevel() Level
+	SetLevel(level Level)
+}
+
+// ParseLevel 解析日志级别，不支持的级别返回错误
+func ParseLevel(level string) (Level, error) {
+	switch l := Level(level); l {
+	case LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal, LevelPanic:
+		return l, nil
+	}
+	return "", errors.Errorf("unsupported log level: %s", level)
+}
+
+// atomicLevel 同一个 Logger 及其 WithField 等派生的 Logger 共用的级别
+type atomicLevel struct {
+	value atomic.Value
+}
+
+func newAtomicLevel(level Level) *atomicLevel {
+	if level == "" {
+		level = LevelInfo
+	}
+	l := &atomicLevel{}
+	l.value.Store(level)
+	return l
+}
+
+func (l *atomicLevel) Get() Level {
+	return l.value.Load().(Level)
+}
+
+func (l *atomicLevel) Set(level Level) {
+	l.value.Store(level)
+}
+
+var levelRevert struct {
+	mu       sync.Mutex
+	timer    *time.Timer
+	original Level
+	at       time.Time
+}
+
+// GetLevel 全局 logger 当前的级别，logger 不支持 LevelController 时返回空字符串
+func GetLevel() Level {
+	if controller, ok := logger.(LevelController); ok {
+		return controller.GetLevel()
+	}
+	return ""
+}
+
+// SetLevel 运行时修改全局 logger 的级别，ttl 大于 0 时到期后恢复为修改前的级别，
+// 到期前再次修改会重新计时，恢复的仍然是第一次修改前的级别；ttl 小于等于 0 时永久生效
+func SetLevel(level Level, ttl time.Duration) error {
+	if _, err := ParseLevel(string(level)); err != nil {
+		return err
+	}
+	controller, ok := logger.(LevelController)
+	if !ok {
+		return errors.New("logger does not support changing level")
+	}
+
+	levelRevert.mu.Lock()
+	defer levelRevert.mu.Unlock()
+	pending := levelRevert.timer != nil && levelRevert.timer.Stop()
+	if !pending {
+		levelRevert.original = controller.GetLevel()
+	}
+	levelRevert.timer = nil
+	levelRevert.at = time.Time{}
+	controller.SetLevel(level)
+
+	if ttl > 0 {
+		original := levelRevert.original
+		levelRevert.at = time.Now().Add(ttl)
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			levelRevert.mu.Lock()
+			defer levelRevert.mu.Unlock()
+			if levelRevert.timer != timer {
+				return
+			}
+			levelRevert.timer = nil
+			levelRevert.at = time.Time{}
+			if controller, ok := logger.(LevelController); ok {
+				controller.SetLevel(original)
+			}
+		})
+		levelRevert.timer = timer
+	}
+	return nil
+}
+
+// LevelRevertAt SetLevel 指定 ttl 时恢复级别的时间，没有待恢复的级别时为零值
+func LevelRevertAt() time.Time {
+	levelRevert.mu.Lock()
+	defer levelRevert.mu.Unlock()
+	return levelRevert.at
+}
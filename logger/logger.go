@@ -38,6 +38,8 @@ const FieldKeyMsg = "msg"
 const FieldKeyLevel = "level"
 const FieldKeyError = "error"
 const FieldKeyTraceId = "trace_id"
+const FieldKeyRequestId = "request_id"
+const FieldKeyTenantId = "tenant_id"
 
 type Logger interface {
 	WithError(err error) Logger
@@ -91,6 +93,7 @@ func New(opts ...Option) Logger {
 	for _, opt := range opts {
 		opt(options)
 	}
+	options.runtimeLevel()
 
 	var l Logger
 	switch options.Type {
@@ -17,6 +17,7 @@ type logrusLogger struct {
 var _ Logger = &logrusLogger{}
 
 func newLogrusLogger(opt Options) *logrusLogger {
+	opt.runtimeLevel()
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{
 		TimestampFormat: time.DateTime,
@@ -47,6 +48,14 @@ func newLogrusLogger(opt Options) *logrusLogger {
 		logger.AddHook(newLogrusTraceIdHook(opt.GetTraceIdFunc))
 	}
 
+	if opt.GetRequestIdFunc != nil {
+		logger.AddHook(newLogrusRequestIdHook(opt.GetRequestIdFunc))
+	}
+
+	if opt.GetTenantIdFunc != nil {
+		logger.AddHook(newLogrusTenantIdHook(opt.GetTenantIdFunc))
+	}
+
 	if opt.LocalFsConfig.Path != "" {
 		logger.AddHook(newLogrusLocalFsHook(opt.LocalFsConfig))
 	}
@@ -89,10 +98,20 @@ func levelToLogrusLevel(level Level) logrus.Level {
 	}
 }
 
+func (l *logrusLogger) GetLevel() Level {
+	return l.Opt.runtimeLevel().Get()
+}
+
+func (l *logrusLogger) SetLevel(level Level) {
+	l.Opt.runtimeLevel().Set(level)
+	l.Logger.SetLevel(levelToLogrusLevel(level))
+}
+
 func (l *logrusLogger) WithError(err error) Logger {
 	return &logrusLogger{
 		Logger: l.Logger,
 		Entry:  l.Entry.WithError(err),
+		Opt:    l.Opt,
 	}
 }
 
@@ -100,6 +119,7 @@ func (l *logrusLogger) WithField(key string, value interface{}) Logger {
 	return &logrusLogger{
 		Logger: l.Logger,
 		Entry:  l.Entry.WithField(key, value),
+		Opt:    l.Opt,
 	}
 }
 
@@ -107,6 +127,7 @@ func (l *logrusLogger) WithFields(fields map[string]interface{}) Logger {
 	return &logrusLogger{
 		Logger: l.Logger,
 		Entry:  l.Entry.WithFields(fields),
+		Opt:    l.Opt,
 	}
 }
 
@@ -180,6 +180,54 @@ func (h *logrusTraceIdHook) Fire(entry *logrus.Entry) error {
 	return nil
 }
 
+type logrusRequestIdHook struct {
+	GetRequestIdFunc func(ctx context.Context) string
+}
+
+var _ logrus.Hook = &logrusRequestIdHook{}
+
+func newLogrusRequestIdHook(getRequestIdFunc func(ctx context.Context) string) *logrusRequestIdHook {
+	return &logrusRequestIdHook{
+		GetRequestIdFunc: getRequestIdFunc,
+	}
+}
+
+func (h *logrusRequestIdHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logrusRequestIdHook) Fire(entry *logrus.Entry) error {
+	requestId := h.GetRequestIdFunc(entry.Context)
+	if requestId != "" {
+		entry.Data[FieldKeyRequestId] = requestId
+	}
+	return nil
+}
+
+type logrusTenantIdHook struct {
+	GetTenantIdFunc func(ctx context.Context) string
+}
+
+var _ logrus.Hook = &logrusTenantIdHook{}
+
+func newLogrusTenantIdHook(getTenantIdFunc func(ctx context.Context) string) *logrusTenantIdHook {
+	return &logrusTenantIdHook{
+		GetTenantIdFunc: getTenantIdFunc,
+	}
+}
+
+func (h *logrusTenantIdHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logrusTenantIdHook) Fire(entry *logrus.Entry) error {
+	tenantId := h.GetTenantIdFunc(entry.Context)
+	if tenantId != "" {
+		entry.Data[FieldKeyTenantId] = tenantId
+	}
+	return nil
+}
+
 type logrusOtlpHook struct{}
 
 var _ logrus.Hook = &logrusOtlpHook{}
@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ihezebin/olympus/requestid"
+	"github.com/ihezebin/olympus/tenant"
 )
 
 type Options struct {
@@ -26,8 +29,22 @@ type Options struct {
 	// GetTraceId is a function to get the trace_id
 	// 默认实现使用 opentelemetry 的 trace_id
 	GetTraceIdFunc func(ctx context.Context) string
+	// GetRequestIdFunc 获取 request_id 的函数，默认从 httpserver 中间件写入的 context 中获取
+	GetRequestIdFunc func(ctx context.Context) string
+	// GetTenantIdFunc 获取 tenant_id 的函数，默认从 httpserver 租户中间件写入的 context 中获取
+	GetTenantIdFunc func(ctx context.Context) string
 	// OtlpEnabled 是否启用 otlp
 	OtlpEnabled bool
+	// level 运行时的级别，由 New 根据 Level 创建，派生的 Logger 共用
+	level *atomicLevel
+}
+
+// runtimeLevel 运行时的级别，直接调用各实现的构造函数时根据 Level 创建
+func (o *Options) runtimeLevel() *atomicLevel {
+	if o.level == nil {
+		o.level = newAtomicLevel(o.Level)
+	}
+	return o.level
 }
 
 type LocalFsConfig struct {
@@ -60,12 +77,14 @@ var DefaultGetTraceIdFunc = func(ctx context.Context) string {
 
 func defaultOptions() *Options {
 	return &Options{
-		Type:           LoggerTypeZap,
-		Level:          LevelInfo,
-		Caller:         true,
-		Timestamp:      true,
-		Output:         os.Stdout,
-		GetTraceIdFunc: DefaultGetTraceIdFunc,
+		Type:             LoggerTypeZap,
+		Level:            LevelInfo,
+		Caller:           true,
+		Timestamp:        true,
+		Output:           os.Stdout,
+		GetTraceIdFunc:   DefaultGetTraceIdFunc,
+		GetRequestIdFunc: requestid.FromContext,
+		GetTenantIdFunc:  tenant.IDFromContext,
 	}
 }
 
@@ -159,3 +178,17 @@ func WithGetTraceIdFunc(fn func(ctx context.Context) string) Option {
 		o.GetTraceIdFunc = fn
 	}
 }
+
+// WithGetRequestIdFunc 设置获取 request_id 的函数，为 nil 时不记录 request_id
+func WithGetRequestIdFunc(fn func(ctx context.Context) string) Option {
+	return func(o *Options) {
+		o.GetRequestIdFunc = fn
+	}
+}
+
+// WithGetTenantIdFunc 设置获取 tenant_id 的函数，为 nil 时不记录 tenant_id
+func WithGetTenantIdFunc(fn func(ctx context.Context) string) Option {
+	return func(o *Options) {
+		o.GetTenantIdFunc = fn
+	}
+}
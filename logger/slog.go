@@ -20,7 +20,7 @@ func newSlogLogger(opt Options) *slogLogger {
 	var handler slog.Handler
 
 	handlerOpts := &slog.HandlerOptions{
-		Level:     levelToSlogLevel(opt.Level),
+		Level:     slogLeveler{level: opt.runtimeLevel()},
 		AddSource: false,
 		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
 			if attr.Key == slog.TimeKey {
@@ -46,6 +46,23 @@ func newSlogLogger(opt Options) *slogLogger {
 	}
 }
 
+// slogLeveler 运行时的级别
+type slogLeveler struct {
+	level *atomicLevel
+}
+
+func (l slogLeveler) Level() slog.Level {
+	return levelToSlogLevel(l.level.Get())
+}
+
+func (l *slogLogger) GetLevel() Level {
+	return l.Opt.runtimeLevel().Get()
+}
+
+func (l *slogLogger) SetLevel(level Level) {
+	l.Opt.runtimeLevel().Set(level)
+}
+
 func levelToSlogLevel(level Level) slog.Level {
 	switch level {
 	case LevelDebug:
@@ -67,12 +84,12 @@ func levelToSlogLevel(level Level) slog.Level {
 
 func (l *slogLogger) WithError(err error) Logger {
 	newLogger := l.Logger.With(slog.Any(FieldKeyError, err))
-	return &slogLogger{Logger: newLogger}
+	return &slogLogger{Logger: newLogger, Opt: l.Opt}
 }
 
 func (l *slogLogger) WithField(key string, value interface{}) Logger {
 	newLogger := l.Logger.With(slog.Any(key, value))
-	return &slogLogger{Logger: newLogger}
+	return &slogLogger{Logger: newLogger, Opt: l.Opt}
 }
 
 func (l *slogLogger) WithFields(fields map[string]interface{}) Logger {
@@ -81,7 +98,7 @@ func (l *slogLogger) WithFields(fields map[string]interface{}) Logger {
 		attrs = append(attrs, slog.Any(k, v))
 	}
 	newLogger := l.Logger.With(attrs...)
-	return &slogLogger{Logger: newLogger}
+	return &slogLogger{Logger: newLogger, Opt: l.Opt}
 }
 
 func (l *slogLogger) Log(ctx context.Context, level Level, args ...interface{}) {
@@ -136,6 +136,20 @@ func (h *slogHook) Handle(ctx context.Context, r slog.Record) error {
 		}
 	}
 
+	if h.opt.GetRequestIdFunc != nil {
+		requestId := h.opt.GetRequestIdFunc(ctx)
+		if requestId != "" {
+			r.AddAttrs(slog.String(FieldKeyRequestId, requestId))
+		}
+	}
+
+	if h.opt.GetTenantIdFunc != nil {
+		tenantId := h.opt.GetTenantIdFunc(ctx)
+		if tenantId != "" {
+			r.AddAttrs(slog.String(FieldKeyTenantId, tenantId))
+		}
+	}
+
 	if h.rotateNormalHandler != nil || h.rotateErrHandler != nil {
 		var rotateHandler slog.Handler
 		if r.Level >= levelToSlogLevel(h.opt.RotateConfig.ErrorFileLevel) {
@@ -32,8 +32,11 @@ func newZapLoggerWithContext(ctx context.Context, opt Options) *zapLogger {
 
 	encoder := zapcore.NewJSONEncoder(encoderConfig)
 
-	// 设置日志级别
-	level := zap.NewAtomicLevelAt(levelToZapLevel(opt.Level))
+	// 设置日志级别，运行时可以通过 SetLevel 修改
+	runtimeLevel := opt.runtimeLevel()
+	level := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= levelToZapLevel(runtimeLevel.Get())
+	})
 
 	// 如果指定了 Output，使用自定义的 WriteSyncer
 	var ws zapcore.WriteSyncer
@@ -75,6 +78,14 @@ func levelToZapLevel(level Level) zapcore.Level {
 	}
 }
 
+func (l *zapLogger) GetLevel() Level {
+	return l.Opt.runtimeLevel().Get()
+}
+
+func (l *zapLogger) SetLevel(level Level) {
+	l.Opt.runtimeLevel().Set(level)
+}
+
 func (l *zapLogger) withContext(ctx context.Context) *zapLogger {
 	return newZapLoggerWithContext(ctx, l.Opt)
 }
@@ -104,6 +104,28 @@ func (h *zapHook) Write(entry zapcore.Entry, fields []zapcore.Field) error {
 		}
 	}
 
+	if h.opt.GetRequestIdFunc != nil {
+		requestId := h.opt.GetRequestIdFunc(h.ctx)
+		if requestId != "" {
+			newFields = append(newFields, zapcore.Field{
+				Key:    FieldKeyRequestId,
+				Type:   zapcore.StringType,
+				String: requestId,
+			})
+		}
+	}
+
+	if h.opt.GetTenantIdFunc != nil {
+		tenantId := h.opt.GetTenantIdFunc(h.ctx)
+		if tenantId != "" {
+			newFields = append(newFields, zapcore.Field{
+				Key:    FieldKeyTenantId,
+				Type:   zapcore.StringType,
+				String: tenantId,
+			})
+		}
+	}
+
 	if h.opt.RotateConfig.Path != "" {
 		var writer io.Writer
 		if entry.Level >= levelToZapLevel(h.opt.RotateConfig.ErrorFileLevel) {
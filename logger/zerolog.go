@@ -27,6 +27,7 @@ func newZerologLogger(fields map[string]interface{}, err error, opt Options) zer
 	zerolog.TimestampFieldName = FieldKeyTime
 	zerolog.TimeFieldFormat = time.DateTime
 
+	opt.runtimeLevel()
 	logger := zerolog.New(opt.Output)
 
 	if opt.Level != "" {
@@ -45,6 +46,14 @@ func newZerologLogger(fields map[string]interface{}, err error, opt Options) zer
 		logger = logger.Hook(newZerologTraceIdHook(opt.GetTraceIdFunc))
 	}
 
+	if opt.GetRequestIdFunc != nil {
+		logger = logger.Hook(newZerologRequestIdHook(opt.GetRequestIdFunc))
+	}
+
+	if opt.GetTenantIdFunc != nil {
+		logger = logger.Hook(newZerologTenantIdHook(opt.GetTenantIdFunc))
+	}
+
 	if opt.LocalFsConfig.Path != "" {
 		hook := newZerologLocalFsHook(logger, opt.LocalFsConfig)
 		logger = logger.Hook(hook)
@@ -99,6 +108,14 @@ func levelToZerologLevel(level Level) zerolog.Level {
 	}
 }
 
+func (l zerologLogger) GetLevel() Level {
+	return l.opt.runtimeLevel().Get()
+}
+
+func (l zerologLogger) SetLevel(level Level) {
+	l.opt.runtimeLevel().Set(level)
+}
+
 func (l zerologLogger) WithError(err error) Logger {
 	return newZerologLogger(l.fields, err, l.opt)
 }
@@ -129,7 +146,7 @@ func (l zerologLogger) Log(ctx context.Context, level Level, args ...interface{}
 		loggerCtx = loggerCtx.Err(l.err)
 	}
 
-	logger := loggerCtx.Ctx(ctx).Timestamp().Logger()
+	logger := loggerCtx.Ctx(ctx).Timestamp().Logger().Level(levelToZerologLevel(l.opt.runtimeLevel().Get()))
 	logger.WithLevel(levelToZerologLevel(level)).Msg(fmt.Sprint(args...))
 }
 
@@ -179,7 +196,7 @@ func (l zerologLogger) Logf(ctx context.Context, level Level, format string, arg
 		loggerCtx = loggerCtx.Err(l.err)
 	}
 
-	logger := loggerCtx.Ctx(ctx).Timestamp().Logger()
+	logger := loggerCtx.Ctx(ctx).Timestamp().Logger().Level(levelToZerologLevel(l.opt.runtimeLevel().Get()))
 	logger.WithLevel(levelToZerologLevel(level)).Msgf(format, args...)
 }
 
@@ -229,7 +246,7 @@ func (l zerologLogger) Logln(ctx context.Context, level Level, args ...interface
 		loggerCtx = loggerCtx.Err(l.err)
 	}
 
-	logger := loggerCtx.Ctx(ctx).Timestamp().Logger()
+	logger := loggerCtx.Ctx(ctx).Timestamp().Logger().Level(levelToZerologLevel(l.opt.runtimeLevel().Get()))
 	logger.WithLevel(levelToZerologLevel(level)).Msg(fmt.Sprintln(args...))
 }
 
@@ -128,6 +128,44 @@ func (h *zerologTraceIdHook) Run(e *zerolog.Event, level zerolog.Level, msg stri
 	}
 }
 
+type zerologRequestIdHook struct {
+	GetRequestIdFunc func(ctx context.Context) string
+}
+
+var _ zerolog.Hook = &zerologRequestIdHook{}
+
+func newZerologRequestIdHook(getRequestIdFunc func(ctx context.Context) string) *zerologRequestIdHook {
+	return &zerologRequestIdHook{
+		GetRequestIdFunc: getRequestIdFunc,
+	}
+}
+
+func (h *zerologRequestIdHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	requestId := h.GetRequestIdFunc(e.GetCtx())
+	if requestId != "" {
+		e.Str(FieldKeyRequestId, requestId)
+	}
+}
+
+type zerologTenantIdHook struct {
+	GetTenantIdFunc func(ctx context.Context) string
+}
+
+var _ zerolog.Hook = &zerologTenantIdHook{}
+
+func newZerologTenantIdHook(getTenantIdFunc func(ctx context.Context) string) *zerologTenantIdHook {
+	return &zerologTenantIdHook{
+		GetTenantIdFunc: getTenantIdFunc,
+	}
+}
+
+func (h *zerologTenantIdHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	tenantId := h.GetTenantIdFunc(e.GetCtx())
+	if tenantId != "" {
+		e.Str(FieldKeyTenantId, tenantId)
+	}
+}
+
 type zerologCallerHook struct {
 }
 
@@ -0,0 +1,66 @@
+// Package tenant 在 context 中传递租户，由 httpserver 中间件写入，logger 记录租户 ID，
+// 租户 ID 同时写入 otel baggage，通过 httpclient.OtelMiddleware 传递给下游服务
+package tenant
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// BaggageKey 租户 ID 在 otel baggage 中的 key
+const BaggageKey = "tenant.id"
+
+type Tenant struct {
+	ID   string `json:"id" yaml:"id" toml:"id"`
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// RateLimit 每秒请求数，覆盖默认的租户限流，为 0 时使用默认值，小于 0 表示不限流
+	RateLimit float64 `json:"rate_limit" yaml:"rate_limit" toml:"rate_limit"`
+	Burst     int     `json:"burst" yaml:"burst" toml:"burst"`
+	// Config 租户的配置覆盖，通过 Config 读取
+	Config map[string]any `json:"config" yaml:"config" toml:"config"`
+}
+
+type contextKey struct{}
+
+// NewContext 写入租户并将租户 ID 加入 baggage
+func NewContext(ctx context.Context, t *Tenant) context.Context {
+	ctx = context.WithValue(ctx, contextKey{}, t)
+	member, err := baggage.NewMemberRaw(BaggageKey, t.ID)
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+	return t, ok && t != nil
+}
+
+// IDFromContext 没有租户时返回空字符串
+func IDFromContext(ctx context.Context) string {
+	if t, ok := FromContext(ctx); ok {
+		return t.ID
+	}
+	return ""
+}
+
+// Config 读取当前租户的配置覆盖，没有租户、没有配置或类型不一致时返回 def
+func Config[T any](ctx context.Context, key string, def T) T {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return def
+	}
+	if value, ok := t.Config[key].(T); ok {
+		return value
+	}
+	return def
+}